@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// CheckpointRecord compares, at a point of the run, the participants Janus
+// reports in a room with those the tester thinks it has joined.
+type CheckpointRecord struct {
+	At                 time.Time `json:"at"`
+	RoomID             uint64    `json:"room"`
+	ExpectedPublishers int       `json:"expected_publishers"`
+	ExpectedAttendees  int       `json:"expected_attendees"`
+	Publishers         int       `json:"publishers"`
+	Attendees          int       `json:"attendees"`
+	Match              bool      `json:"match"`
+	Error              string    `json:"error,omitempty"`
+}
+
+// Occupancy is what the tester thinks it has joined in a room: the feed ids
+// of its publishers, and whether each is sending media.
+type Occupancy struct {
+	mu    sync.Mutex
+	feeds map[uint64]bool
+}
+
+func NewOccupancy() *Occupancy {
+	return &Occupancy{feeds: make(map[uint64]bool)}
+}
+
+// Join counts the publisher of feed as an attendee until it publishes.
+func (occupancy *Occupancy) Join(feed uint64) {
+	occupancy.mu.Lock()
+	defer occupancy.mu.Unlock()
+	occupancy.feeds[feed] = false
+}
+
+// Publishing records the publisher of feed started or stopped publishing.
+func (occupancy *Occupancy) Publishing(feed uint64, publishing bool) {
+	occupancy.mu.Lock()
+	defer occupancy.mu.Unlock()
+	if _, ok := occupancy.feeds[feed]; ok {
+		occupancy.feeds[feed] = publishing
+	}
+}
+
+// Leave stops counting the publisher of feed.
+func (occupancy *Occupancy) Leave(feed uint64) {
+	occupancy.mu.Lock()
+	defer occupancy.mu.Unlock()
+	delete(occupancy.feeds, feed)
+}
+
+// Counts returns the number of publishers sending media and of attendees.
+func (occupancy *Occupancy) Counts() (publishers int, attendees int) {
+	occupancy.mu.Lock()
+	defer occupancy.mu.Unlock()
+	for _, publishing := range occupancy.feeds {
+		if publishing {
+			publishers++
+		} else {
+			attendees++
+		}
+	}
+	return publishers, attendees
+}
+
+// RunCheckpoints checks the participants of roomID against occupancy at each
+// of checkpoints, in seconds after the room was set up, until ctx is done.
+func RunCheckpoints(ctx context.Context, rooms RoomAPI, report *Report, roomID uint64, occupancy *Occupancy, wg *sync.WaitGroup, checkpoints []int) {
+	defer wg.Done()
+
+	start := time.Now()
+	for _, checkpoint := range checkpoints {
+		timer := time.NewTimer(time.Until(start.Add(time.Duration(checkpoint) * time.Second)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		report.AddCheckpoint(Checkpoint(rooms, roomID, occupancy))
+	}
+}
+
+// Checkpoint compares the participants Janus reports in roomID with
+// occupancy.
+func Checkpoint(rooms RoomAPI, roomID uint64, occupancy *Occupancy) CheckpointRecord {
+	record := CheckpointRecord{At: time.Now(), RoomID: roomID}
+	record.ExpectedPublishers, record.ExpectedAttendees = occupancy.Counts()
+
+	participants, err := rooms.ListParticipants(roomID)
+	if err != nil {
+		record.Error = err.Error()
+		log.Printf("checkpoint of room %d failed : %s", roomID, err.Error())
+		return record
+	}
+
+	record.Publishers = len(participants.Publishers())
+	record.Attendees = len(participants.Attendees())
+	record.Match = record.Publishers == record.ExpectedPublishers && record.Attendees == record.ExpectedAttendees
+	if !record.Match {
+		log.Printf("checkpoint of room %d : janus reports %d publishers and %d attendees, expected %d and %d",
+			roomID, record.Publishers, record.Attendees, record.ExpectedPublishers, record.ExpectedAttendees)
+	}
+	return record
+}
+
+func (record CheckpointRecord) String() string {
+	if record.Error != "" {
+		return fmt.Sprintf("room %d : %s", record.RoomID, record.Error)
+	}
+	return fmt.Sprintf("room %d : %d/%d publishers, %d/%d attendees",
+		record.RoomID, record.Publishers, record.ExpectedPublishers, record.Attendees, record.ExpectedAttendees)
+}
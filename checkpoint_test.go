@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Hwanse/janus-tester/internal/fakejanus"
+	"github.com/Hwanse/janus-tester/internal/janus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Occupancy_Counts(t *testing.T) {
+	tests := []struct {
+		name       string
+		run        func(occupancy *Occupancy)
+		publishers int
+		attendees  int
+	}{
+		{
+			name: "empty",
+			run:  func(occupancy *Occupancy) {},
+		},
+		{
+			name: "join",
+			run: func(occupancy *Occupancy) {
+				occupancy.Join(1)
+				occupancy.Join(2)
+			},
+			attendees: 2,
+		},
+		{
+			name: "publish",
+			run: func(occupancy *Occupancy) {
+				occupancy.Join(1)
+				occupancy.Join(2)
+				occupancy.Publishing(1, true)
+			},
+			publishers: 1,
+			attendees:  1,
+		},
+		{
+			name: "unpublish",
+			run: func(occupancy *Occupancy) {
+				occupancy.Join(1)
+				occupancy.Publishing(1, true)
+				occupancy.Publishing(1, false)
+			},
+			attendees: 1,
+		},
+		{
+			name: "kick",
+			run: func(occupancy *Occupancy) {
+				occupancy.Join(1)
+				occupancy.Join(2)
+				occupancy.Publishing(1, true)
+				occupancy.Leave(1)
+			},
+			attendees: 1,
+		},
+		{
+			name: "publish after kick",
+			run: func(occupancy *Occupancy) {
+				occupancy.Join(1)
+				occupancy.Leave(1)
+				occupancy.Publishing(1, true)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			occupancy := NewOccupancy()
+			test.run(occupancy)
+
+			publishers, attendees := occupancy.Counts()
+			assert.Equal(t, test.publishers, publishers)
+			assert.Equal(t, test.attendees, attendees)
+		})
+	}
+}
+
+func Test_Checkpoint(t *testing.T) {
+	server := fakejanus.NewServer()
+	defer server.Close()
+
+	gateway, err := janus.WsConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer gateway.Close()
+	session, err := gateway.Create()
+	assert.NoError(t, err)
+
+	attach := func() *janus.Handle {
+		handle, err := session.Attach(janus.VideoRoomPluginName)
+		assert.NoError(t, err)
+		return handle
+	}
+	rooms := attach()
+	occupancy := NewOccupancy()
+
+	feeds := make([]uint64, 0, 2)
+	for i := 0; i < 2; i++ {
+		joined, err := attach().JoinPublisher(&janus.JoinPublisherRequest{
+			Request:  janus.TypeJoin,
+			RoomID:   fakejanus.DefaultRoom,
+			PeerType: janus.TypePublisher,
+		})
+		assert.NoError(t, err)
+		occupancy.Join(joined.FeedID)
+		feeds = append(feeds, joined.FeedID)
+	}
+
+	record := Checkpoint(rooms, fakejanus.DefaultRoom, occupancy)
+	assert.True(t, record.Match)
+	assert.Equal(t, 2, record.Attendees)
+	assert.Zero(t, record.Publishers)
+
+	// a kick the tester did not account for is a mismatch
+	_, err = rooms.Kick(&janus.KickRequest{Request: janus.TypeKick, RoomID: fakejanus.DefaultRoom, FeedID: feeds[0]})
+	assert.NoError(t, err)
+	record = Checkpoint(rooms, fakejanus.DefaultRoom, occupancy)
+	assert.False(t, record.Match)
+	assert.Equal(t, 1, record.Attendees)
+	assert.Equal(t, 2, record.ExpectedAttendees)
+
+	occupancy.Leave(feeds[0])
+	assert.True(t, Checkpoint(rooms, fakejanus.DefaultRoom, occupancy).Match)
+
+	record = Checkpoint(rooms, fakejanus.DefaultRoom+1, occupancy)
+	assert.False(t, record.Match)
+	assert.NotEmpty(t, record.Error)
+}
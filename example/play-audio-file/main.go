@@ -153,8 +153,7 @@ func main() {
 	// in a production application you should exchange ICE Candidates via OnICECandidate
 	<-gatherComplete
 
-	janusURL := fmt.Sprintf("ws://%s:%s/", janus.JanusLocalHost, janus.JanusWebsocketPort)
-	gateway, err := janus.WsConnect(janusURL)
+	gateway, err := janus.Connect(janus.WithURL(janus.DefaultURL))
 	if err != nil {
 		panic(err)
 	}
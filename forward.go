@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Hwanse/janus-tester/internal/janus"
+	"github.com/Hwanse/janus-tester/internal/peer"
+)
+
+// ForwardScenario forwards a stream of every publisher of a room over RTP,
+// WaitTime seconds after the room was set up, to a local listener each. The
+// forwarders run until the end of the run, when each must have received at
+// least MinPackets.
+type ForwardScenario struct {
+	WaitTime int `json:"wait_time"`
+
+	// Host is the local address the listeners bind and Janus forwards to,
+	// 127.0.0.1 when unset.
+	Host string `json:"host"`
+
+	// Mid is the stream of the publishers to forward, "0" when unset.
+	Mid string `json:"mid"`
+
+	// SSRC and PayloadType replace those of the publishers when set.
+	SSRC        uint32 `json:"ssrc"`
+	PayloadType int    `json:"pt"`
+
+	// SRTPSuite (32 or 80) and SRTPCrypto, the base64 key, forward over SRTP.
+	SRTPSuite  int    `json:"srtp_suite"`
+	SRTPCrypto string `json:"srtp_crypto"`
+
+	MinPackets uint64 `json:"min_packets"`
+}
+
+// ForwardRecord is a forwarder of the run and what its listener received.
+type ForwardRecord struct {
+	RoomID   uint64 `json:"room"`
+	FeedID   uint64 `json:"publisher_id"`
+	StreamID uint64 `json:"stream_id"`
+	Port     int    `json:"port"`
+	peer.ForwardStats
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+var errNoForwarder = errors.New("no forwarder created")
+
+// forwarding is a forwarder started by RunForwarders.
+type forwarding struct {
+	record   ForwardRecord
+	listener *peer.ForwardListener
+}
+
+// RunForwarders forwards the publishers of roomID as scenario says, and
+// records what each forwarder delivered once ctx is done.
+func RunForwarders(ctx context.Context, rooms RoomAPI, report *Report, roomID uint64, secret *RoomSecret, wg *sync.WaitGroup, scenario *ForwardScenario) {
+	defer wg.Done()
+
+	timer := time.NewTimer(time.Duration(scenario.WaitTime) * time.Second)
+	select {
+	case <-ctx.Done():
+		timer.Stop()
+		return
+	case <-timer.C:
+	}
+
+	participants, err := rooms.ListParticipants(roomID)
+	if err != nil {
+		log.Printf("failed to forward room %d : %s", roomID, err.Error())
+		report.AddForward(ForwardRecord{RoomID: roomID, Error: err.Error()})
+		return
+	}
+
+	forwardings := make([]*forwarding, 0)
+	for _, publisher := range participants.Publishers() {
+		forwardings = append(forwardings, forward(rooms, roomID, secret.Get(), publisher.FeedID, scenario))
+	}
+
+	<-ctx.Done()
+	for _, forwarding := range forwardings {
+		record := forwarding.record
+		if forwarding.listener != nil {
+			err := rooms.StopRTPForward(&janus.StopRTPForwardRequest{
+				Request:  janus.TypeStopRTPForward,
+				RoomID:   roomID,
+				Secret:   secret.Get(),
+				FeedID:   record.FeedID,
+				StreamID: record.StreamID,
+			})
+			if err != nil {
+				// the publisher may have left first, taking its forwarders
+				log.Printf("failed to stop forwarder %d of %d : %s", record.StreamID, record.FeedID, err.Error())
+			}
+			forwarding.listener.Close()
+
+			record.ForwardStats = forwarding.listener.Stats()
+			minPackets := scenario.MinPackets
+			if minPackets == 0 {
+				minPackets = 1
+			}
+			record.OK = record.Packets >= minPackets
+		}
+		report.AddForward(record)
+	}
+}
+
+// forward forwards the stream of scenario of the publisher feed to a new
+// local listener. The listener is nil when forwarding failed.
+func forward(rooms RoomAPI, roomID uint64, secret string, feed uint64, scenario *ForwardScenario) *forwarding {
+	result := &forwarding{record: ForwardRecord{RoomID: roomID, FeedID: feed}}
+	host := scenario.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	mid := scenario.Mid
+	if mid == "" {
+		mid = "0"
+	}
+
+	listener, err := peer.ListenForward(host)
+	if err != nil {
+		result.record.Error = err.Error()
+		return result
+	}
+
+	forwarders, err := rooms.RTPForward(&janus.RTPForwardRequest{
+		Request: janus.TypeRTPForward,
+		RoomID:  roomID,
+		Secret:  secret,
+		FeedID:  feed,
+		Host:    host,
+		Streams: []janus.RTPForwardStream{{
+			MID:         mid,
+			Port:        listener.Port(),
+			SSRC:        scenario.SSRC,
+			PayloadType: scenario.PayloadType,
+		}},
+		SRTPSuite:  scenario.SRTPSuite,
+		SRTPCrypto: scenario.SRTPCrypto,
+	})
+	if err == nil && len(forwarders) == 0 {
+		err = errNoForwarder
+	}
+	if err != nil {
+		log.Printf("failed to forward %d of room %d : %s", feed, roomID, err.Error())
+		listener.Close()
+		result.record.Error = err.Error()
+		return result
+	}
+
+	result.listener = listener
+	result.record.StreamID = forwarders[0].StreamID
+	result.record.Port = listener.Port()
+	return result
+}
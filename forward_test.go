@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Hwanse/janus-tester/internal/janus"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+// forwardRooms stands in for Janus forwarding the publishers of a room, each
+// sending packets[feed] packets as soon as it is forwarded, or failing to
+// be forwarded when it has none.
+type forwardRooms struct {
+	RoomAPI
+	packets map[uint64]int
+
+	mu      sync.Mutex
+	secrets []string
+	stopped []uint64
+}
+
+func (rooms *forwardRooms) ListParticipants(roomID uint64) (janus.Participants, error) {
+	participants := make(janus.Participants, 0, len(rooms.packets))
+	for feed := range rooms.packets {
+		participants = append(participants, janus.Participant{FeedID: feed, IsPublisher: true})
+	}
+	return participants, nil
+}
+
+func (rooms *forwardRooms) RTPForward(req *janus.RTPForwardRequest) ([]janus.RTPForwarder, error) {
+	rooms.mu.Lock()
+	rooms.secrets = append(rooms.secrets, req.Secret)
+	rooms.mu.Unlock()
+
+	count := rooms.packets[req.FeedID]
+	if count < 0 {
+		return nil, errors.New("no such feed")
+	}
+
+	conn, err := net.Dial("udp", net.JoinHostPort(req.Host, strconv.Itoa(req.Streams[0].Port)))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	for i := 0; i < count; i++ {
+		packet := rtp.Packet{Header: rtp.Header{Version: 2, PayloadType: 111, SequenceNumber: uint16(i), SSRC: uint32(req.FeedID)}}
+		data, err := packet.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		conn.Write(data)
+	}
+	return []janus.RTPForwarder{{StreamID: req.FeedID * 10}}, nil
+}
+
+func (rooms *forwardRooms) StopRTPForward(req *janus.StopRTPForwardRequest) error {
+	rooms.mu.Lock()
+	defer rooms.mu.Unlock()
+	rooms.secrets = append(rooms.secrets, req.Secret)
+	rooms.stopped = append(rooms.stopped, req.StreamID)
+	return nil
+}
+
+func Test_RunForwarders_MinPackets(t *testing.T) {
+	tests := []struct {
+		name       string
+		minPackets uint64
+		packets    int
+		ok         bool
+		err        bool
+	}{
+		{name: "enough", minPackets: 5, packets: 10, ok: true},
+		{name: "exactly enough", minPackets: 5, packets: 5, ok: true},
+		{name: "too few", minPackets: 5, packets: 3},
+		{name: "one by default", packets: 1, ok: true},
+		{name: "none", packets: 0},
+		{name: "not forwarded", minPackets: 1, packets: -1, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rooms := &forwardRooms{packets: map[uint64]int{7: test.packets}}
+			secret := &RoomSecret{}
+			secret.change(func(string) string { return "secret" })
+			report := NewReport()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+			go RunForwarders(ctx, rooms, report, 1234, secret, wg, &ForwardScenario{MinPackets: test.minPackets})
+
+			// the packets are sent when forwarding starts, leave them time to
+			// arrive
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+			wg.Wait()
+
+			assert.Len(t, report.Forwards, 1)
+			record := report.Forwards[0]
+			assert.Equal(t, uint64(7), record.FeedID)
+			assert.Equal(t, test.ok, record.OK)
+			assert.Equal(t, test.err, record.Error != "")
+			if !test.err {
+				assert.Equal(t, uint64(test.packets), record.Packets)
+				assert.Equal(t, []uint64{70}, rooms.stopped)
+			}
+			for _, sent := range rooms.secrets {
+				assert.Equal(t, "secret", sent)
+			}
+		})
+	}
+}
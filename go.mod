@@ -4,9 +4,10 @@ go 1.16
 
 require (
 	github.com/gorilla/websocket v1.5.0
-	github.com/mitchellh/mapstructure v1.5.0 // indirect
-	github.com/pion/webrtc/v3 v3.1.45 // indirect
+	github.com/mitchellh/mapstructure v1.5.0
+	github.com/pion/rtp v1.7.13
+	github.com/pion/webrtc/v3 v3.1.45
 	github.com/rs/xid v1.4.0
-	github.com/stretchr/testify v1.8.0 // indirect
+	github.com/stretchr/testify v1.8.0
 	github.com/tidwall/gjson v1.14.3
 )
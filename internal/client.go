@@ -2,23 +2,41 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/Hwanse/janus-tester/internal/janus"
 	"github.com/Hwanse/janus-tester/internal/peer"
-	"github.com/mitchellh/mapstructure"
 	"log"
 	"time"
 )
 
+// keepAliveTimeout bounds a single keepalive round trip, so a reply dropped by
+// Janus ends the loop instead of hanging it.
+const keepAliveTimeout = 10 * time.Second
+
 type Client struct {
 	*janus.Session
 	Peers []*peer.Peer
+
+	// Sampler, when set, samples the stats of every peer of the client,
+	// under Key.
+	Sampler *peer.StatsSampler
+	Key     string
+
+	// OnModerated, when set, is called with the feed id of the publisher of
+	// the client and "muted", "unmuted" or "kicked" when a moderator acts on
+	// it.
+	OnModerated func(feed uint64, event string)
+
+	// OnPublishing, when set, is called with the feed id of the publisher of
+	// the client when it starts or stops publishing.
+	OnPublishing func(feed uint64, publishing bool)
 }
 
 func NewClient(session *janus.Session) Client {
 	return Client{
-		session,
-		make([]*peer.Peer, 0),
+		Session: session,
+		Peers:   make([]*peer.Peer, 0),
 	}
 }
 
@@ -36,6 +54,9 @@ func (c *Client) NewPeer(ctx context.Context, roomID uint64, peerType string) (*
 		DestroyFunc:   cancel,
 	}
 	c.Peers = append(c.Peers, &peer)
+	if c.Sampler != nil {
+		c.Sampler.Add(c.Key, &peer)
+	}
 
 	return &peer, nil
 }
@@ -47,8 +68,11 @@ func (c *Client) KeepAliveLoop(ctx context.Context) {
 	for {
 		select {
 		case <-tick.C:
-			if _, err := c.Session.KeepAlive(); err != nil {
-				log.Println("failed to session keepalive : ", err.Error())
+			reqCtx, cancel := context.WithTimeout(ctx, keepAliveTimeout)
+			_, err := c.Session.KeepAliveCtx(reqCtx)
+			cancel()
+			if err != nil {
+				c.Session.Logger().Warn("failed to session keepalive", janus.F("error", err))
 				return
 			}
 
@@ -58,48 +82,65 @@ func (c *Client) KeepAliveLoop(ctx context.Context) {
 	}
 }
 
+// WatchRoomEvent logs the events of the peer's handle and subscribes to every
+// publisher that shows up in the room, until ctx is done.
 func (c *Client) WatchRoomEvent(ctx context.Context, p *peer.Peer) {
-	// wait for event
-	for {
-		select {
-		case <-ctx.Done():
-			return
+	handle := p.Handle
+	logger := handle.Logger()
+
+	unsubscribes := []func(){
+		handle.OnSlowLink(func(msg *janus.SlowLinkMsg) {
+			logger.Info("slowlink event", janus.F("uplink", msg.Uplink), janus.F("lost", msg.Lost))
+		}),
+		handle.OnMedia(func(msg *janus.MediaMsg) {
+			logger.Info("media event", janus.F("type", msg.Type), janus.F("receiving", msg.Receiving))
+		}),
+		handle.OnWebRTCUp(func(msg *janus.WebRTCUpMsg) {
+			logger.Info("webrtcup event")
+		}),
+		handle.OnHangup(func(msg *janus.HangupMsg) {
+			logger.Info("hangup event", janus.F("reason", msg.Reason))
+		}),
+		handle.OnVideoRoomEvent(func(event *janus.VideoRoomEvent) {
+			logger.Debug("videoroom event", janus.F("data", event.Msg.Plugindata.Data))
 
-		default:
-			msg := <-p.Handle.Events
-			switch msg := msg.(type) {
-			case *janus.SlowLinkMsg:
-				log.Println("SlowLinkMsg type ", p.Handle.ID)
-			case *janus.MediaMsg:
-				log.Println("MediaEvent type", msg.Type, " receiving ", msg.Receiving)
-			case *janus.WebRTCUpMsg:
-				log.Println("WebRTCUp type ", p.Handle.ID)
-			case *janus.HangupMsg:
-				log.Println("HangupEvent type ", p.Handle.ID)
-			case *janus.EventMsg:
-				log.Printf("EventMsg %+v", msg.Plugindata.Data)
-				event := janus.NewPublisherEvent{}
-				err := mapstructure.Decode(msg.Plugindata.Data, &event)
+			if p.PeerType == janus.TypePublisher {
+				if event.IsKicked() {
+					logger.Info("kicked out of the room", janus.F("room", p.EnteredRoomID))
+					c.moderated(p.MyFeedID, "kicked")
+					return
+				}
+				if event.Moderation != "" && event.FeedID == p.MyFeedID {
+					logger.Info("moderation event", janus.F("mid", event.MID), janus.F("moderation", event.Moderation))
+					c.moderated(p.MyFeedID, event.Moderation)
+				}
+			}
+
+			if len(event.Publishers) > 0 && p.MyFeedID != event.Publishers[0].FeedID {
+				subPeer, err := c.NewPeer(ctx, event.RoomID, janus.TypeSubscriber)
 				if err != nil {
-					log.Printf("parse event error : %s \n", err.Error())
-					continue
+					log.Panic("failed to Create Peer ", err.Error())
+					return
 				}
 
-				if len(event.Publishers) > 0 && p.MyFeedID != event.Publishers[0].FeedID {
-					subPeer, err := c.NewPeer(ctx, event.RoomID, janus.TypeSubscriber)
-					if err != nil {
-						log.Panic("failed to Create Peer ", err.Error())
-						continue
-					}
-
-					err = subPeer.SubscribeToPublisher(event.Publishers[0].FeedID)
-					if err != nil {
-						log.Panic("failed to Create Peer ", err.Error())
-						continue
-					}
+				err = subPeer.SubscribeToPublisher(event.Publishers[0].FeedID)
+				if err != nil {
+					log.Panic("failed to Create Peer ", err.Error())
+					return
 				}
 			}
-		}
+		}),
+	}
+
+	<-ctx.Done()
+	for _, unsubscribe := range unsubscribes {
+		unsubscribe()
+	}
+}
+
+func (c *Client) moderated(feed uint64, event string) {
+	if c.OnModerated != nil {
+		c.OnModerated(feed, event)
 	}
 }
 
@@ -158,12 +199,56 @@ func HandleLeavePeer(peer *peer.Peer) {
 
 func (c *Client) TestPublishStream(ctx context.Context) {
 	p := c.FindMyPublisherPeer()
-	peer.PublishSampleFile(ctx, p)
+	if peer.PublishSampleFile(ctx, p) != nil {
+		c.publishing(p.MyFeedID, true)
+	}
 }
 
 func (c *Client) UnpublishStream() {
 	p := c.FindMyPublisherPeer()
-	p.Handle.UnPublish(&janus.UnPublishRequest{Request: janus.TypeUnpublish})
+	if err := p.Handle.UnPublish(&janus.UnPublishRequest{Request: janus.TypeUnpublish}); err == nil {
+		c.publishing(p.MyFeedID, false)
+	}
+}
+
+func (c *Client) publishing(feed uint64, publishing bool) {
+	if c.OnPublishing != nil {
+		c.OnPublishing(feed, publishing)
+	}
+}
+
+// Configure sends a configure request for the publisher of the client.
+func (c *Client) Configure(req *janus.ConfigureRequest) error {
+	p := c.FindMyPublisherPeer()
+	if p == nil {
+		return errors.New("no publisher to configure")
+	}
+
+	req.Request = janus.TypeConfigure
+	_, err := p.Handle.Configure(req, nil)
+	return err
+}
+
+// MuteStream stops or resumes sending the stream of mid, or every stream of
+// kind ("audio" or "video") the publisher has when mid is empty.
+func (c *Client) MuteStream(kind string, mid string, mute bool) error {
+	p := c.FindMyPublisherPeer()
+	if p == nil {
+		return errors.New("no publisher to mute")
+	}
+
+	send := !mute
+	req := &janus.ConfigureRequest{}
+	for streamMid, streamKind := range p.Mids {
+		if mid == streamMid || (mid == "" && kind == streamKind) {
+			req.Streams = append(req.Streams, janus.ConfigureStream{MID: streamMid, Send: &send})
+		}
+	}
+	if len(req.Streams) == 0 {
+		return fmt.Errorf("no %s stream to mute", kind)
+	}
+
+	return c.Configure(req)
 }
 
 func (c *Client) KeepConnection(ctx context.Context) {
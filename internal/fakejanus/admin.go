@@ -0,0 +1,355 @@
+package fakejanus
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// status is the part of the core configuration the Admin API can change.
+type status struct {
+	sessionTimeout int
+	logLevel       int
+	lockingDebug   bool
+	refcountDebug  bool
+	acceptSessions bool
+}
+
+func (server *Server) dispatchAdmin(c *conn, req *request) {
+	if req.AdminSecret != server.AdminSecret {
+		c.send(errorReply(req, errorUnauthorized, "Unauthorized request (wrong or missing secret/token)"))
+		return
+	}
+
+	switch req.Janus {
+	case "ping":
+		c.send(reply(req, "pong"))
+	case "get_status":
+		c.send(server.getStatus(req))
+	case "list_sessions":
+		msg := reply(req, "success")
+		msg["sessions"] = server.Sessions()
+		c.send(msg)
+	case "set_session_timeout":
+		server.setStatus(func(status *status) { status.sessionTimeout = req.Timeout })
+		msg := reply(req, "success")
+		msg["timeout"] = req.Timeout
+		c.send(msg)
+	case "set_log_level":
+		if req.Level < 0 || req.Level > 7 {
+			c.send(errorReply(req, errorInvalidElementType, "Invalid element type (level should be between 0 and 7)"))
+			return
+		}
+		server.setStatus(func(status *status) { status.logLevel = req.Level })
+		msg := reply(req, "success")
+		msg["level"] = req.Level
+		c.send(msg)
+	case "set_locking_debug":
+		server.setStatus(func(status *status) { status.lockingDebug = req.Debug })
+		msg := reply(req, "success")
+		msg["locking_debug"] = req.Debug
+		c.send(msg)
+	case "set_refcount_debug":
+		server.setStatus(func(status *status) { status.refcountDebug = req.Debug })
+		msg := reply(req, "success")
+		msg["refcount_debug"] = req.Debug
+		c.send(msg)
+	case "accept_new_sessions":
+		server.setStatus(func(status *status) { status.acceptSessions = req.Accept })
+		msg := reply(req, "success")
+		msg["accept"] = req.Accept
+		c.send(msg)
+	case "message_plugin":
+		c.send(server.messagePlugin(req))
+	case "query_eventhandler":
+		c.send(errorReply(req, errorPluginNotFound, fmt.Sprintf("No such event handler '%s'", req.Handler)))
+	case "add_token", "list_tokens", "allow_token", "disallow_token", "remove_token":
+		c.send(server.storedToken(req))
+	case "list_handles", "handle_info", "detach_handle", "destroy_session", "hangup_webrtc":
+		server.dispatchAdminSession(c, req)
+	default:
+		c.send(errorReply(req, errorUnknownRequest, fmt.Sprintf("Unknown request '%s'", req.Janus)))
+	}
+}
+
+// dispatchAdminSession serves the Admin API requests about one session or
+// handle of the Janus API.
+func (server *Server) dispatchAdminSession(c *conn, req *request) {
+	server.mu.Lock()
+	s := server.sessions[req.SessionID]
+	var h *handle
+	if s != nil {
+		h = s.handles[req.HandleID]
+	}
+	server.mu.Unlock()
+
+	if s == nil {
+		c.send(errorReply(req, errorSessionNotFound, fmt.Sprintf("No such session %d", req.SessionID)))
+		return
+	}
+
+	switch req.Janus {
+	case "list_handles":
+		server.mu.Lock()
+		ids := make([]uint64, 0, len(s.handles))
+		for id := range s.handles {
+			ids = append(ids, id)
+		}
+		server.mu.Unlock()
+
+		msg := reply(req, "success")
+		msg["handles"] = ids
+		c.send(msg)
+		return
+	case "destroy_session":
+		server.sendTo(s, object{"janus": "timeout", "session_id": s.id})
+		server.destroy(s)
+		c.send(reply(req, "success"))
+		return
+	}
+
+	if h == nil {
+		c.send(errorReply(req, errorHandleNotFound, fmt.Sprintf("No such handle %d in session %d", req.HandleID, s.id)))
+		return
+	}
+
+	switch req.Janus {
+	case "handle_info":
+		msg := reply(req, "success")
+		msg["handle_id"] = h.id
+		msg["info"] = server.handleInfo(h, req.PluginOnly)
+		c.send(msg)
+	case "detach_handle":
+		server.detach(h, true)
+		c.send(reply(req, "success"))
+	case "hangup_webrtc":
+		server.hangup(h)
+		c.send(reply(req, "success"))
+	}
+}
+
+// storedToken serves the Admin API requests that manage the tokens of
+// TokenAuth.
+func (server *Server) storedToken(req *request) object {
+	if !server.TokenAuth {
+		return errorReply(req, errorUnknown, "Stored-Token based authentication disabled")
+	}
+	if req.Janus == "list_tokens" {
+		return server.listTokens(req)
+	}
+	if req.Token == "" {
+		return errorReply(req, errorMissingMandatoryElement, "Missing mandatory element (token)")
+	}
+	for _, plugin := range req.Plugins {
+		if plugin != VideoRoomPluginName {
+			return errorReply(req, errorInvalidElementType, "Invalid element type (some of the provided plugins are invalid)")
+		}
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	plugins, ok := server.tokens[req.Token]
+	switch req.Janus {
+	case "add_token":
+		if ok {
+			return errorReply(req, errorUnknown, fmt.Sprintf("Error adding token '%s'", req.Token))
+		}
+		plugins = make(map[string]bool)
+		if len(req.Plugins) == 0 {
+			plugins[VideoRoomPluginName] = true
+		}
+		server.tokens[req.Token] = plugins
+	case "remove_token":
+		if !ok {
+			return errorReply(req, errorTokenNotFound, fmt.Sprintf("Token %s not found", req.Token))
+		}
+		delete(server.tokens, req.Token)
+		return reply(req, "success")
+	default:
+		if !ok {
+			return errorReply(req, errorTokenNotFound, fmt.Sprintf("Token %s not found", req.Token))
+		}
+		if len(req.Plugins) == 0 {
+			return errorReply(req, errorMissingMandatoryElement, "Missing mandatory element (plugins)")
+		}
+	}
+
+	for _, plugin := range req.Plugins {
+		plugins[plugin] = req.Janus != "disallow_token"
+	}
+	msg := reply(req, "success")
+	msg["data"] = object{"plugins": allowedPlugins(plugins)}
+	return msg
+}
+
+func (server *Server) listTokens(req *request) object {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	tokens := make([]object, 0, len(server.tokens))
+	for token, plugins := range server.tokens {
+		tokens = append(tokens, object{"token": token, "allowed_plugins": allowedPlugins(plugins)})
+	}
+	msg := reply(req, "success")
+	msg["data"] = object{"tokens": tokens}
+	return msg
+}
+
+func allowedPlugins(plugins map[string]bool) []string {
+	allowed := make([]string, 0, len(plugins))
+	for plugin, ok := range plugins {
+		if ok {
+			allowed = append(allowed, plugin)
+		}
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+func (server *Server) getStatus(req *request) object {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	msg := reply(req, "success")
+	msg["status"] = object{
+		"token_auth":         server.TokenAuth,
+		"api_secret":         server.APISecret != "",
+		"admin_secret":       true,
+		"session_timeout":    server.status.sessionTimeout,
+		"log_level":          server.status.logLevel,
+		"log_timestamps":     false,
+		"log_colors":         false,
+		"locking_debug":      server.status.lockingDebug,
+		"refcount_debug":     server.status.refcountDebug,
+		"libnice_debug":      false,
+		"min_nack_queue":     200,
+		"no_media_timer":     1,
+		"slowlink_threshold": 0,
+	}
+	return msg
+}
+
+func (server *Server) setStatus(change func(status *status)) {
+	server.mu.Lock()
+	change(&server.status)
+	server.mu.Unlock()
+}
+
+// handleInfo describes h the way Janus does, with the videoroom state as
+// plugin_specific. pluginOnly leaves the core part out.
+func (server *Server) handleInfo(h *handle, pluginOnly bool) object {
+	server.mu.Lock()
+	specific := object{"type": "none"}
+	if h.room != nil {
+		specific = object{
+			"type":    h.peerType,
+			"room":    h.room.id,
+			"display": h.display,
+		}
+		if h.peerType == "publisher" {
+			specific["id"] = h.feed
+			specific["audio_active"] = h.publishing && !h.muted["0"]
+			specific["video_active"] = h.publishing
+			specific["bitrate"] = h.bitrate
+			specific["recording_active"] = h.recording
+		} else {
+			specific["feeds"] = h.feeds
+		}
+	}
+	pc := h.pc
+	server.mu.Unlock()
+
+	info := object{"plugin": VideoRoomPluginName, "plugin_specific": specific}
+	if pluginOnly {
+		return info
+	}
+
+	info["session_id"] = h.session.id
+	info["session_transport"] = "janus.transport.websockets"
+	info["handle_id"] = h.id
+	info["current_time"] = time.Now().UnixNano() / int64(time.Microsecond)
+	info["flags"] = object{
+		"got-offer":  pc != nil,
+		"got-answer": pc != nil,
+		"ready":      pc != nil,
+		"stopped":    false,
+		"alert":      pc == nil,
+	}
+	if pc != nil {
+		info["webrtc"] = webrtcInfo(pc)
+	}
+	return info
+}
+
+// webrtcInfo describes pc like the webrtc part of a Janus 1.x handle_info,
+// with one medium adding up the RTP streams of the PeerConnection.
+func webrtcInfo(pc *webrtc.PeerConnection) object {
+	ice := object{"state": pc.ICEConnectionState().String()}
+	dtls := object{"dtls-state": "new"}
+	if transport := pc.SCTP().Transport(); transport != nil {
+		dtls["dtls-state"] = transport.State().String()
+		if pair, err := transport.ICETransport().GetSelectedCandidatePair(); err == nil && pair != nil {
+			ice["selected-pair"] = pair.String()
+		}
+	}
+
+	var rtt int
+	var packetsIn, packetsOut, nacksIn, nacksOut uint32
+	var bytesIn, bytesOut uint64
+	var lost int32
+	for _, stats := range pc.GetStats() {
+		switch stats := stats.(type) {
+		case webrtc.InboundRTPStreamStats:
+			packetsIn += stats.PacketsReceived
+			bytesIn += stats.BytesReceived
+			nacksIn += stats.NACKCount
+			lost += stats.PacketsLost
+		case webrtc.OutboundRTPStreamStats:
+			packetsOut += stats.PacketsSent
+			bytesOut += stats.BytesSent
+			nacksOut += stats.NACKCount
+		case webrtc.ICECandidatePairStats:
+			if stats.Nominated {
+				rtt = int(stats.CurrentRoundTripTime * 1000)
+			}
+		}
+	}
+
+	return object{
+		"ice":  ice,
+		"dtls": dtls,
+		"media": object{
+			"0": object{
+				"mid":        "0",
+				"type":       "audio",
+				"in_stats":   object{"packets": packetsIn, "bytes": bytesIn, "nacks": nacksIn},
+				"out_stats":  object{"packets": packetsOut, "bytes": bytesOut, "nacks": nacksOut},
+				"rtcp_stats": object{"main": object{"base": 48000, "rtt": rtt, "lost": lost, "lost-by-remote": 0}},
+			},
+		},
+	}
+}
+
+// messagePlugin hands a synchronous request to the videoroom plugin outside
+// of any handle, the way Janus passes it to handle_admin_message.
+func (server *Server) messagePlugin(req *request) object {
+	if req.Plugin != VideoRoomPluginName {
+		return errorReply(req, errorPluginNotFound, fmt.Sprintf("No such plugin '%s'", req.Plugin))
+	}
+
+	body := &videoroomRequest{}
+	if err := json.Unmarshal(req.Request, body); err != nil {
+		return errorReply(req, errorInvalidJSON, err.Error())
+	}
+	if !syncRequests[body.Request] {
+		return errorReply(req, errorPluginMessage, fmt.Sprintf("Request '%s' is not allowed through the Admin API", body.Request))
+	}
+
+	msg := reply(req, "success")
+	msg["response"] = server.syncRequest(nil, body)
+	return msg
+}
@@ -0,0 +1,199 @@
+package fakejanus
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+)
+
+// forwarder sends the RTP of a publisher stream to a UDP address. The fake
+// does not encrypt for SRTP forwarders, which leaves the RTP headers a
+// receiver looks at the same.
+type forwarder struct {
+	id   uint64
+	mid  string
+	kind string
+	host string
+	port int
+	ssrc uint32
+	pt   int
+	srtp bool
+	conn net.Conn
+}
+
+func (fwd *forwarder) info() object {
+	return object{
+		"stream_id": fwd.id,
+		"type":      fwd.kind,
+		"host":      fwd.host,
+		"port":      fwd.port,
+		"ssrc":      fwd.ssrc,
+		"pt":        fwd.pt,
+		"srtp":      fwd.srtp,
+	}
+}
+
+// send forwards packet, with the SSRC and payload type of the forwarder
+// when it has them.
+func (fwd *forwarder) send(packet []byte) {
+	if len(packet) < 12 {
+		return
+	}
+	if fwd.ssrc != 0 || fwd.pt != 0 {
+		packet = append([]byte(nil), packet...)
+		if fwd.pt != 0 {
+			packet[1] = packet[1]&0x80 | byte(fwd.pt&0x7f)
+		}
+		if fwd.ssrc != 0 {
+			packet[8], packet[9], packet[10], packet[11] = byte(fwd.ssrc>>24), byte(fwd.ssrc>>16), byte(fwd.ssrc>>8), byte(fwd.ssrc)
+		}
+	}
+	fwd.conn.Write(packet)
+}
+
+func (server *Server) rtpForward(body *videoroomRequest) object {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	r, failure := server.roomWithSecret(body)
+	if failure != nil {
+		return failure
+	}
+	if body.PublisherID == 0 {
+		return videoroomError(errorVideoRoomMissingElement, "Missing mandatory element (publisher_id)")
+	}
+	h := r.participants[body.PublisherID]
+	if h == nil || !h.publishing {
+		return videoroomError(errorVideoRoomNoSuchFeed, fmt.Sprintf("No such publisher (%d)", body.PublisherID))
+	}
+	if body.SRTPSuite != 0 && body.SRTPCrypto == "" {
+		return videoroomError(errorVideoRoomMissingElement, "Missing mandatory element (srtp_crypto)")
+	}
+	if len(body.Streams) == 0 {
+		return videoroomError(errorVideoRoomMissingElement, "Missing mandatory element (streams)")
+	}
+
+	forwarders := make([]*forwarder, 0, len(body.Streams))
+	for _, stream := range body.Streams {
+		// the fake publishers only send the audio of mid 0
+		if stream.Mid != "0" {
+			closeForwarders(forwarders)
+			return videoroomError(errorVideoRoomInvalidElement, fmt.Sprintf("No such stream (%s)", stream.Mid))
+		}
+		host := stream.Host
+		if host == "" {
+			host = body.Host
+		}
+		if host == "" || stream.Port == 0 {
+			closeForwarders(forwarders)
+			return videoroomError(errorVideoRoomMissingElement, "Missing mandatory element (host/port)")
+		}
+
+		conn, err := net.Dial("udp", net.JoinHostPort(host, strconv.Itoa(stream.Port)))
+		if err != nil {
+			closeForwarders(forwarders)
+			return videoroomError(errorVideoRoomUnknown, err.Error())
+		}
+		forwarders = append(forwarders, &forwarder{
+			id:   uint64(rand.Uint32()),
+			mid:  stream.Mid,
+			kind: "audio",
+			host: host,
+			port: stream.Port,
+			ssrc: stream.SSRC,
+			pt:   stream.PT,
+			srtp: body.SRTPSuite != 0,
+			conn: conn,
+		})
+	}
+
+	if h.forwarders == nil {
+		h.forwarders = make(map[uint64]*forwarder)
+	}
+	infos := make([]object, 0, len(forwarders))
+	for _, fwd := range forwarders {
+		h.forwarders[fwd.id] = fwd
+		infos = append(infos, fwd.info())
+	}
+	return object{"videoroom": "rtp_forward", "room": r.id, "publisher_id": h.feed, "forwarders": infos}
+}
+
+func (server *Server) stopRTPForward(body *videoroomRequest) object {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	r, failure := server.roomWithSecret(body)
+	if failure != nil {
+		return failure
+	}
+	h := r.participants[body.PublisherID]
+	if h == nil {
+		return videoroomError(errorVideoRoomNoSuchFeed, fmt.Sprintf("No such publisher (%d)", body.PublisherID))
+	}
+	fwd := h.forwarders[body.StreamID]
+	if fwd == nil {
+		return videoroomError(errorVideoRoomNoSuchFeed, fmt.Sprintf("No such stream (%d)", body.StreamID))
+	}
+	delete(h.forwarders, body.StreamID)
+	fwd.conn.Close()
+
+	return object{"videoroom": "stop_rtp_forward", "room": r.id, "publisher_id": h.feed, "stream_id": fwd.id}
+}
+
+func (server *Server) listForwarders(body *videoroomRequest) object {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	r, failure := server.roomWithSecret(body)
+	if failure != nil {
+		return failure
+	}
+
+	publishers := make([]object, 0)
+	for _, h := range r.sortedParticipants() {
+		if len(h.forwarders) == 0 {
+			continue
+		}
+		infos := make([]object, 0, len(h.forwarders))
+		for _, fwd := range h.sortedForwarders() {
+			infos = append(infos, fwd.info())
+		}
+		publishers = append(publishers, object{"publisher_id": h.feed, "display": h.display, "forwarders": infos})
+	}
+	return object{"videoroom": "forwarders", "room": r.id, "publishers": publishers}
+}
+
+// onRTP returns what forwards the RTP the publisher h sends.
+func (server *Server) onRTP(h *handle) func(kind string, packet []byte) {
+	return func(kind string, packet []byte) {
+		server.mu.Lock()
+		forwarders := make([]*forwarder, 0, len(h.forwarders))
+		for _, fwd := range h.forwarders {
+			if fwd.kind == kind {
+				forwarders = append(forwarders, fwd)
+			}
+		}
+		server.mu.Unlock()
+
+		for _, fwd := range forwarders {
+			fwd.send(packet)
+		}
+	}
+}
+
+func (h *handle) sortedForwarders() []*forwarder {
+	forwarders := make([]*forwarder, 0, len(h.forwarders))
+	for _, fwd := range h.forwarders {
+		forwarders = append(forwarders, fwd)
+	}
+	sort.Slice(forwarders, func(i, j int) bool { return forwarders[i].id < forwarders[j].id })
+	return forwarders
+}
+
+func closeForwarders(forwarders []*forwarder) {
+	for _, fwd := range forwarders {
+		fwd.conn.Close()
+	}
+}
@@ -0,0 +1,190 @@
+package fakejanus
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpPollTimeout is how long a long poll waits for an event before it is
+// answered with a keepalive, as the Janus HTTP transport does.
+const httpPollTimeout = 30 * time.Second
+
+// eventQueue holds what is sent to a session created over HTTP until its
+// long poll fetches it.
+type eventQueue struct {
+	mu     sync.Mutex
+	events []json.RawMessage
+	queued chan struct{}
+}
+
+func newEventQueue() *eventQueue {
+	return &eventQueue{queued: make(chan struct{}, 1)}
+}
+
+func (queue *eventQueue) push(data []byte) error {
+	queue.mu.Lock()
+	queue.events = append(queue.events, append(json.RawMessage(nil), data...))
+	queue.mu.Unlock()
+
+	select {
+	case queue.queued <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// pop takes up to max queued events, none when the queue is empty.
+func (queue *eventQueue) pop(max int) []json.RawMessage {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	if max > len(queue.events) {
+		max = len(queue.events)
+	}
+	events := queue.events[:max]
+	queue.events = append([]json.RawMessage(nil), queue.events[max:]...)
+	if len(queue.events) > 0 {
+		select {
+		case queue.queued <- struct{}{}:
+		default:
+		}
+	}
+	return events
+}
+
+// HttpURL is the API root to hand to janus.HttpConnect, https:// for a
+// server started with NewTLSServer.
+func (server *Server) HttpURL() string {
+	return server.URL + "/janus"
+}
+
+// serveHttp serves the Janus API the way the Janus HTTP transport does:
+// requests are POSTed to /janus/<session>/<handle> and answered right away,
+// events are fetched with a long poll, GET /janus/<session>.
+func (server *Server) serveHttp(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/janus"), "/"), "/")
+	ids := make([]uint64, 0, 2)
+	for _, part := range path {
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err != nil || len(ids) == 2 {
+			http.NotFound(w, r)
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	switch {
+	case r.Method == http.MethodPost:
+		server.post(w, r, ids)
+	case r.Method == http.MethodGet && len(ids) == 1:
+		server.longPoll(w, r, ids[0])
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// post serves one request and writes its reply. The session and handle come
+// from the path, a session created this way gets its events queued for the
+// long poll.
+func (server *Server) post(w http.ResponseWriter, r *http.Request, ids []uint64) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	req := &request{}
+	if err := json.Unmarshal(data, req); err != nil {
+		writeJSON(w, errorReply(req, errorInvalidJSON, err.Error()))
+		return
+	}
+	if len(ids) > 0 {
+		req.SessionID = ids[0]
+	}
+	if len(ids) > 1 {
+		req.HandleID = ids[1]
+	}
+
+	if req.Janus == "create" && server.authorized(req) {
+		queue := newEventQueue()
+		writeJSON(w, server.create(&conn{write: queue.push, close: func() error { return nil }, events: queue}, req))
+		return
+	}
+
+	// Every request is answered once, before dispatch returns
+	replies := make(chan []byte, 1)
+	c := &conn{
+		write: func(data []byte) error {
+			select {
+			case replies <- data:
+			default:
+			}
+			return nil
+		},
+		close: func() error { return nil },
+	}
+	server.dispatch(c, req)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(<-replies)
+}
+
+// longPoll answers with up to maxev queued events of the session, or with a
+// keepalive when none arrives in httpPollTimeout. Like any request, it has to
+// carry the apisecret or token, in the query.
+func (server *Server) longPoll(w http.ResponseWriter, r *http.Request, id uint64) {
+	query := r.URL.Query()
+	req := &request{Janus: "keepalive", SessionID: id, APISecret: query.Get("apisecret"), Token: query.Get("token")}
+	if !server.authorized(req) {
+		writeJSON(w, errorReply(req, errorUnauthorized, "Unauthorized request (wrong or missing secret/token)"))
+		return
+	}
+
+	server.mu.Lock()
+	var queue *eventQueue
+	if s := server.sessions[id]; s != nil && s.conn != nil {
+		queue = s.conn.events
+	}
+	server.mu.Unlock()
+	if queue == nil {
+		writeJSON(w, errorReply(req, errorSessionNotFound, fmt.Sprintf("No such session %d", id)))
+		return
+	}
+
+	max, err := strconv.Atoi(query.Get("maxev"))
+	if err != nil || max < 1 {
+		max = 1
+	}
+
+	select {
+	case <-queue.queued:
+	case <-time.After(httpPollTimeout):
+		writeJSON(w, object{"janus": "keepalive"})
+		return
+	case <-r.Context().Done():
+		return
+	case <-server.closing:
+		return
+	}
+
+	events := queue.pop(max)
+	switch {
+	case len(events) == 0:
+		writeJSON(w, object{"janus": "keepalive"})
+	case max == 1:
+		writeJSON(w, events[0])
+	default:
+		writeJSON(w, events)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, msg interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
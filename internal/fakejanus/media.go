@@ -0,0 +1,97 @@
+package fakejanus
+
+import (
+	"fmt"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// newPublisherPeer answers a publisher's offer, receiving whatever it sends.
+// onUp runs once ICE connects, onMedia for every track that arrives and
+// onRTP for every packet of the tracks.
+func newPublisherPeer(offer string, onUp func(), onMedia func(kind string), onRTP func(kind string, packet []byte)) (*webrtc.PeerConnection, string, error) {
+	pc, err := newPeer(onUp)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		kind := track.Kind().String()
+		onMedia(kind)
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := track.Read(buf)
+			if err != nil {
+				return
+			}
+			onRTP(kind, buf[:n])
+		}
+	})
+
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer}); err != nil {
+		pc.Close()
+		return nil, "", err
+	}
+
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		pc.Close()
+		return nil, "", err
+	}
+	return complete(pc, answer)
+}
+
+// newSubscriberPeer offers one audio stream per subscribed feed. Nothing is
+// sent on them, the fake only relays signaling.
+func newSubscriberPeer(streams int, onUp func()) (*webrtc.PeerConnection, string, error) {
+	pc, err := newPeer(onUp)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := 0; i < streams; i++ {
+		track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", fmt.Sprintf("feed%d", i))
+		if err != nil {
+			pc.Close()
+			return nil, "", err
+		}
+		if _, err := pc.AddTrack(track); err != nil {
+			pc.Close()
+			return nil, "", err
+		}
+	}
+
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		pc.Close()
+		return nil, "", err
+	}
+	return complete(pc, offer)
+}
+
+func newPeer(onUp func()) (*webrtc.PeerConnection, error) {
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return nil, err
+	}
+
+	pc.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		if state == webrtc.ICEConnectionStateConnected {
+			onUp()
+		}
+	})
+	return pc, nil
+}
+
+// complete sets the local description and waits for ICE gathering, as the
+// fake sends its SDP with every candidate instead of trickling them.
+func complete(pc *webrtc.PeerConnection, description webrtc.SessionDescription) (*webrtc.PeerConnection, string, error) {
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(description); err != nil {
+		pc.Close()
+		return nil, "", err
+	}
+	<-gatherComplete
+
+	return pc, pc.LocalDescription().SDP, nil
+}
@@ -0,0 +1,565 @@
+// Package fakejanus is an in-process stand-in for a Janus gateway, so the
+// client stack can be tested with go test and no running Janus. It speaks the
+// websocket API, janus-protocol and janus-admin-protocol, the Janus API over
+// HTTP with long polls and over a Unix socket like pfunix, and carries a
+// videoroom plugin whose PeerConnections are pion peers.
+//
+// Only what the tester uses is implemented, and the package deliberately does
+// not import internal/janus so the janus tests can use it.
+package fakejanus
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	WebsocketSubProtocol      = "janus-protocol"
+	WebsocketAdminSubProtocol = "janus-admin-protocol"
+	DefaultAdminSecret        = "janusoverlord"
+
+	// DefaultRoom exists from the start, like the demo room of the sample
+	// videoroom configuration.
+	DefaultRoom = uint64(1234)
+)
+
+// Janus core error codes
+const (
+	errorUnauthorized            = 403
+	errorUnauthorizedPlugin      = 405
+	errorUnknownRequest          = 453
+	errorInvalidJSON             = 454
+	errorMissingMandatoryElement = 456
+	errorInvalidElementType      = 457
+	errorSessionNotFound         = 458
+	errorHandleNotFound          = 459
+	errorPluginNotFound          = 460
+	errorTokenNotFound           = 470
+	errorNotAcceptingSessions    = 472
+	errorPluginMessage           = 462
+	errorUnknown                 = 490
+)
+
+type object map[string]interface{}
+
+// request is every field of a Janus API request the fake looks at.
+type request struct {
+	Janus       string          `json:"janus"`
+	Transaction string          `json:"transaction"`
+	SessionID   uint64          `json:"session_id"`
+	HandleID    uint64          `json:"handle_id"`
+	Plugin      string          `json:"plugin"`
+	ID          uint64          `json:"id"`
+	AdminSecret string          `json:"admin_secret"`
+	APISecret   string          `json:"apisecret"`
+	Token       string          `json:"token"`
+	Body        json.RawMessage `json:"body"`
+	Jsep        *jsep           `json:"jsep"`
+
+	// Admin API request fields
+	Timeout    int             `json:"timeout"`
+	Level      int             `json:"level"`
+	Debug      bool            `json:"debug"`
+	Accept     bool            `json:"accept"`
+	PluginOnly bool            `json:"plugin_only"`
+	Handler    string          `json:"handler"`
+	Plugins    []string        `json:"plugins"`
+	Request    json.RawMessage `json:"request"`
+}
+
+type jsep struct {
+	Type string `json:"type"`
+	SDP  string `json:"sdp"`
+}
+
+// Server is a fake Janus listening on a local port.
+type Server struct {
+	*httptest.Server
+
+	// AdminSecret is the admin_secret admin requests must carry. Change it
+	// before connecting.
+	AdminSecret string
+
+	// APISecret, when set, is the apisecret Janus API requests must carry,
+	// like api_secret in the Janus configuration.
+	APISecret string
+
+	// TokenAuth makes Janus API requests carry a token added with AddToken,
+	// like token_auth in the Janus configuration. With an APISecret as well,
+	// either one is enough.
+	TokenAuth bool
+
+	mu       sync.Mutex
+	tokens   map[string]map[string]bool
+	status   status
+	sessions map[uint64]*session
+	handles  map[uint64]*handle
+	rooms    map[uint64]*room
+	conns    map[*conn]struct{}
+	unix     []*unixListener
+	closing  chan struct{}
+}
+
+type session struct {
+	id      uint64
+	conn    *conn
+	handles map[uint64]*handle
+}
+
+// conn is one client connection, over whatever transport. Writes come from
+// the read loop and from the plugin workers, so they are serialized.
+type conn struct {
+	write func(data []byte) error
+	close func() error
+	admin bool
+
+	// events is set on the conn of a session created over HTTP, what is
+	// sent to it waits there for the long poll.
+	events *eventQueue
+
+	mu sync.Mutex
+}
+
+func (c *conn) send(msg object) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Println("fakejanus : marshal failed : ", err.Error())
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.write(data); err != nil {
+		log.Println("fakejanus : write failed : ", err.Error())
+	}
+}
+
+// NewServer starts a fake Janus with the videoroom DefaultRoom.
+func NewServer() *Server {
+	server := newServer()
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+	return server
+}
+
+// NewTLSServer is NewServer behind TLS, with the self-signed certificate of
+// httptest. config, when not nil, is used instead of the default, to require
+// client certificates for example.
+func NewTLSServer(config *tls.Config) *Server {
+	server := newServer()
+	server.Server = httptest.NewUnstartedServer(http.HandlerFunc(server.serve))
+	if config != nil {
+		server.Server.TLS = config
+	}
+	server.Server.StartTLS()
+	return server
+}
+
+func newServer() *Server {
+	server := &Server{
+		AdminSecret: DefaultAdminSecret,
+		tokens:      make(map[string]map[string]bool),
+		status:      status{sessionTimeout: 60, logLevel: 4, acceptSessions: true},
+		sessions:    make(map[uint64]*session),
+		handles:     make(map[uint64]*handle),
+		rooms:       make(map[uint64]*room),
+		conns:       make(map[*conn]struct{}),
+		closing:     make(chan struct{}),
+	}
+	server.rooms[DefaultRoom] = newRoom(DefaultRoom, "Demo Room", 6, false)
+	return server
+}
+
+// WebsocketURL is the address to hand to janus.WsConnect, wss:// for a
+// server started with NewTLSServer.
+func (server *Server) WebsocketURL() string {
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/"
+}
+
+// Close hangs up every peer, drops the connections and stops the server.
+func (server *Server) Close() {
+	server.mu.Lock()
+	handles := make([]*handle, 0, len(server.handles))
+	for _, h := range server.handles {
+		handles = append(handles, h)
+	}
+	conns := make([]*conn, 0, len(server.conns))
+	for c := range server.conns {
+		conns = append(conns, c)
+	}
+	server.mu.Unlock()
+
+	for _, h := range handles {
+		server.detach(h, false)
+	}
+	for _, c := range conns {
+		c.close()
+	}
+	server.closeUnix()
+	close(server.closing)
+	server.Server.Close()
+}
+
+// Notify pushes an unsolicited event to the connection owning the session,
+// the way Janus pushes webrtcup, slowlink or timeout. handleID is left out
+// of the event when it is zero.
+func (server *Server) Notify(sessionID, handleID uint64, event map[string]interface{}) {
+	server.mu.Lock()
+	s := server.sessions[sessionID]
+	server.mu.Unlock()
+	if s == nil {
+		return
+	}
+
+	msg := object{"session_id": sessionID}
+	if handleID != 0 {
+		msg["sender"] = handleID
+	}
+	for key, value := range event {
+		msg[key] = value
+	}
+	server.sendTo(s, msg)
+}
+
+// ExpireSession times the session out the way Janus does when it is not kept
+// alive: the client is sent a timeout event and the session is destroyed.
+func (server *Server) ExpireSession(sessionID uint64) {
+	server.mu.Lock()
+	s := server.sessions[sessionID]
+	server.mu.Unlock()
+	if s == nil {
+		return
+	}
+
+	server.sendTo(s, object{"janus": "timeout", "session_id": sessionID})
+	server.destroy(s)
+}
+
+// AddToken makes token valid while TokenAuth is on, with access to every
+// plugin.
+func (server *Server) AddToken(token string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.tokens[token] = map[string]bool{VideoRoomPluginName: true}
+}
+
+// RemoveToken revokes a token added with AddToken.
+func (server *Server) RemoveToken(token string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	delete(server.tokens, token)
+}
+
+// authorized reports whether req may be served. Like Janus, info needs
+// neither apisecret nor token.
+func (server *Server) authorized(req *request) bool {
+	if req.Janus == "info" || (server.APISecret == "" && !server.TokenAuth) {
+		return true
+	}
+	if server.APISecret != "" && req.APISecret == server.APISecret {
+		return true
+	}
+	if server.TokenAuth {
+		server.mu.Lock()
+		_, ok := server.tokens[req.Token]
+		server.mu.Unlock()
+		return ok
+	}
+	return false
+}
+
+// Sessions returns the ids of the sessions alive on the server.
+func (server *Server) Sessions() []uint64 {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	ids := make([]uint64, 0, len(server.sessions))
+	for id := range server.sessions {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+var upgrader = websocket.Upgrader{
+	Subprotocols: []string{WebsocketSubProtocol, WebsocketAdminSubProtocol},
+}
+
+func (server *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		server.serveHttp(w, r)
+		return
+	}
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("fakejanus : upgrade failed : ", err.Error())
+		return
+	}
+
+	c := &conn{
+		write: func(data []byte) error { return ws.WriteMessage(websocket.TextMessage, data) },
+		close: ws.Close,
+		admin: ws.Subprotocol() == WebsocketAdminSubProtocol,
+	}
+	server.addConn(c)
+	defer server.removeConn(c)
+
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		server.receive(c, data)
+	}
+}
+
+func (server *Server) addConn(c *conn) {
+	server.mu.Lock()
+	server.conns[c] = struct{}{}
+	server.mu.Unlock()
+}
+
+func (server *Server) removeConn(c *conn) {
+	server.mu.Lock()
+	delete(server.conns, c)
+	server.mu.Unlock()
+	c.close()
+}
+
+// receive decodes one request of c and serves it.
+func (server *Server) receive(c *conn, data []byte) {
+	req := &request{}
+	if err := json.Unmarshal(data, req); err != nil {
+		c.send(errorReply(req, errorInvalidJSON, err.Error()))
+		return
+	}
+
+	if c.admin {
+		server.dispatchAdmin(c, req)
+	} else {
+		server.dispatch(c, req)
+	}
+}
+
+func (server *Server) dispatch(c *conn, req *request) {
+	if !server.authorized(req) {
+		c.send(errorReply(req, errorUnauthorized, "Unauthorized request (wrong or missing secret/token)"))
+		return
+	}
+
+	switch req.Janus {
+	case "info":
+		c.send(server.info(req))
+		return
+	case "create":
+		c.send(server.create(c, req))
+		return
+	}
+
+	server.mu.Lock()
+	s := server.sessions[req.SessionID]
+	server.mu.Unlock()
+	if s == nil {
+		c.send(errorReply(req, errorSessionNotFound, fmt.Sprintf("No such session %d", req.SessionID)))
+		return
+	}
+
+	switch req.Janus {
+	case "keepalive":
+		c.send(reply(req, "ack"))
+	case "claim":
+		server.mu.Lock()
+		s.conn = c
+		server.mu.Unlock()
+		c.send(reply(req, "success"))
+	case "destroy":
+		server.destroy(s)
+		c.send(reply(req, "success"))
+	case "attach":
+		c.send(server.attach(s, req))
+	case "detach", "message", "trickle":
+		server.dispatchHandle(c, s, req)
+	default:
+		c.send(errorReply(req, errorUnknownRequest, fmt.Sprintf("Unknown request '%s'", req.Janus)))
+	}
+}
+
+func (server *Server) dispatchHandle(c *conn, s *session, req *request) {
+	server.mu.Lock()
+	h := s.handles[req.HandleID]
+	server.mu.Unlock()
+	if h == nil {
+		c.send(errorReply(req, errorHandleNotFound, fmt.Sprintf("No such handle %d in session %d", req.HandleID, s.id)))
+		return
+	}
+
+	switch req.Janus {
+	case "detach":
+		server.detach(h, true)
+		c.send(reply(req, "success"))
+	case "trickle":
+		// the peers gather all their candidates up front, there is nothing
+		// to do with the client's
+		c.send(reply(req, "ack"))
+	case "message":
+		if len(req.Body) == 0 {
+			c.send(errorReply(req, errorMissingMandatoryElement, "Missing mandatory element (body)"))
+			return
+		}
+		server.message(c, h, req)
+	}
+}
+
+func (server *Server) info(req *request) object {
+	msg := reply(req, "server_info")
+	msg["name"] = "Janus WebRTC Server (fake)"
+	msg["version"] = 1200
+	msg["version_string"] = "1.2.0"
+	msg["author"] = "fakejanus"
+	msg["data_channels"] = false
+	msg["ipv6"] = false
+	msg["local-ip"] = "127.0.0.1"
+	msg["ice-tcp"] = false
+	msg["transports"] = object{
+		"janus.transport.websockets": object{"name": "JANUS WebSockets transport plugin", "version": 1, "version_string": "0.0.1"},
+	}
+	msg["plugins"] = object{
+		VideoRoomPluginName: object{"name": "JANUS VideoRoom plugin", "version": 9, "version_string": "0.0.9"},
+	}
+	return msg
+}
+
+func (server *Server) create(c *conn, req *request) object {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if !server.status.acceptSessions {
+		return errorReply(req, errorNotAcceptingSessions, "Not accepting new sessions")
+	}
+
+	id := req.ID
+	if id == 0 {
+		id = server.newID()
+	} else if server.sessions[id] != nil {
+		return errorReply(req, 468, fmt.Sprintf("Session ID %d already in use", id))
+	}
+
+	server.sessions[id] = &session{id: id, conn: c, handles: make(map[uint64]*handle)}
+
+	msg := reply(req, "success")
+	msg["data"] = object{"id": id}
+	return msg
+}
+
+func (server *Server) destroy(s *session) {
+	server.mu.Lock()
+	handles := make([]*handle, 0, len(s.handles))
+	for _, h := range s.handles {
+		handles = append(handles, h)
+	}
+	server.mu.Unlock()
+
+	for _, h := range handles {
+		server.detach(h, false)
+	}
+
+	server.mu.Lock()
+	delete(server.sessions, s.id)
+	server.mu.Unlock()
+}
+
+func (server *Server) attach(s *session, req *request) object {
+	if req.Plugin != VideoRoomPluginName {
+		return errorReply(req, errorPluginNotFound, fmt.Sprintf("No such plugin '%s'", req.Plugin))
+	}
+
+	server.mu.Lock()
+	if plugins, ok := server.tokens[req.Token]; server.TokenAuth && ok && !plugins[req.Plugin] {
+		server.mu.Unlock()
+		return errorReply(req, errorUnauthorizedPlugin, fmt.Sprintf("Provided token can't access plugin '%s'", req.Plugin))
+	}
+	h := newHandle(server.newID(), s)
+	s.handles[h.id] = h
+	server.handles[h.id] = h
+	server.mu.Unlock()
+
+	go server.work(h)
+
+	msg := reply(req, "success")
+	msg["data"] = object{"id": h.id}
+	return msg
+}
+
+// detach tears the handle down: it leaves its room, closes its peer and
+// stops its worker. notify sends the "detached" event Janus sends.
+func (server *Server) detach(h *handle, notify bool) {
+	server.leave(h)
+
+	server.mu.Lock()
+	if _, ok := server.handles[h.id]; !ok {
+		server.mu.Unlock()
+		return
+	}
+	delete(server.handles, h.id)
+	delete(h.session.handles, h.id)
+	close(h.done)
+	server.mu.Unlock()
+
+	if notify {
+		server.push(h, object{"janus": "detached"})
+	}
+}
+
+// push sends an event about h to the connection owning its session. event
+// is copied, the same one is often pushed to a whole room.
+func (server *Server) push(h *handle, event object) {
+	msg := object{"session_id": h.session.id, "sender": h.id}
+	for key, value := range event {
+		msg[key] = value
+	}
+	server.sendTo(h.session, msg)
+}
+
+func (server *Server) sendTo(s *session, msg object) {
+	server.mu.Lock()
+	c := s.conn
+	server.mu.Unlock()
+
+	if c != nil {
+		c.send(msg)
+	}
+}
+
+// newID draws an unused id the way Janus does, at random below 2^53 so
+// JavaScript clients can hold it. Must be called with mu held.
+func (server *Server) newID() uint64 {
+	for {
+		id := uint64(rand.Int63n(1<<53)) + 1
+		if server.sessions[id] == nil && server.handles[id] == nil {
+			return id
+		}
+	}
+}
+
+func reply(req *request, janus string) object {
+	msg := object{"janus": janus, "transaction": req.Transaction}
+	if req.SessionID != 0 {
+		msg["session_id"] = req.SessionID
+	}
+	return msg
+}
+
+func errorReply(req *request, code int, reason string) object {
+	msg := reply(req, "error")
+	msg["error"] = object{"code": code, "reason": reason}
+	return msg
+}
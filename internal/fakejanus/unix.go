@@ -0,0 +1,139 @@
+package fakejanus
+
+import (
+	"log"
+	"net"
+	"os"
+	"sync"
+)
+
+// unixPacketSize fits any request a client sends in one packet.
+const unixPacketSize = 1 << 20
+
+// unixListener serves the Janus API on a Unix socket path. It is either a
+// SOCK_SEQPACKET listener with a conn per accepted connection, or a
+// SOCK_DGRAM socket with a conn per client address, as pfunix does.
+type unixListener struct {
+	path     string
+	listener *net.UnixListener
+	packet   *net.UnixConn
+}
+
+// ListenUnix serves the Janus API on a Unix socket at path too, next to the
+// websocket one. network is "unixpacket" for SOCK_SEQPACKET or "unixgram"
+// for SOCK_DGRAM, where clients have to bind an address of their own to be
+// answered. The socket is removed when the server is closed.
+func (server *Server) ListenUnix(network string, path string) error {
+	addr := &net.UnixAddr{Name: path, Net: network}
+	unix := &unixListener{path: path}
+
+	switch network {
+	case "unixgram":
+		packet, err := net.ListenUnixgram(network, addr)
+		if err != nil {
+			return err
+		}
+		unix.packet = packet
+		go server.serveUnixgram(packet)
+	default:
+		listener, err := net.ListenUnix(network, addr)
+		if err != nil {
+			return err
+		}
+		unix.listener = listener
+		go server.acceptUnix(listener)
+	}
+
+	server.mu.Lock()
+	server.unix = append(server.unix, unix)
+	server.mu.Unlock()
+	return nil
+}
+
+func (server *Server) acceptUnix(listener *net.UnixListener) {
+	for {
+		socket, err := listener.AcceptUnix()
+		if err != nil {
+			return
+		}
+		go server.serveUnix(socket)
+	}
+}
+
+func (server *Server) serveUnix(socket *net.UnixConn) {
+	c := &conn{
+		write: func(data []byte) error {
+			_, err := socket.Write(data)
+			return err
+		},
+		close: socket.Close,
+	}
+	server.addConn(c)
+	defer server.removeConn(c)
+
+	buf := make([]byte, unixPacketSize)
+	for {
+		n, err := socket.Read(buf)
+		if err != nil {
+			return
+		}
+		server.receive(c, append([]byte(nil), buf[:n]...))
+	}
+}
+
+func (server *Server) serveUnixgram(packet *net.UnixConn) {
+	clients := make(map[string]*conn)
+	mu := sync.Mutex{}
+
+	buf := make([]byte, unixPacketSize)
+	for {
+		n, addr, err := packet.ReadFromUnix(buf)
+		if err != nil {
+			return
+		}
+		if addr == nil || addr.Name == "" {
+			log.Println("fakejanus : datagram from an unbound socket dropped")
+			continue
+		}
+
+		mu.Lock()
+		c := clients[addr.Name]
+		if c == nil {
+			to := addr
+			c = &conn{
+				write: func(data []byte) error {
+					_, err := packet.WriteToUnix(data, to)
+					return err
+				},
+				close: func() error {
+					mu.Lock()
+					delete(clients, to.Name)
+					mu.Unlock()
+					return nil
+				},
+			}
+			clients[addr.Name] = c
+			server.addConn(c)
+		}
+		mu.Unlock()
+
+		server.receive(c, append([]byte(nil), buf[:n]...))
+	}
+}
+
+func (server *Server) closeUnix() {
+	server.mu.Lock()
+	listeners := server.unix
+	server.unix = nil
+	server.mu.Unlock()
+
+	for _, unix := range listeners {
+		if unix.listener != nil {
+			unix.listener.Close()
+		}
+		if unix.packet != nil {
+			unix.packet.Close()
+		}
+		os.Remove(unix.path)
+	}
+}
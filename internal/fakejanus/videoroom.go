@@ -0,0 +1,933 @@
+package fakejanus
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const VideoRoomPluginName = "janus.plugin.videoroom"
+
+// videoroom error codes
+const (
+	errorVideoRoomUnknown          = 499
+	errorVideoRoomInvalidRequest   = 423
+	errorVideoRoomJoinFirst        = 424
+	errorVideoRoomAlreadyJoined    = 425
+	errorVideoRoomNoSuchRoom       = 426
+	errorVideoRoomRoomExists       = 427
+	errorVideoRoomNoSuchFeed       = 428
+	errorVideoRoomMissingElement   = 429
+	errorVideoRoomInvalidElement   = 430
+	errorVideoRoomInvalidSDPType   = 431
+	errorVideoRoomPublishersFull   = 432
+	errorVideoRoomUnauthorized     = 433
+	errorVideoRoomAlreadyPublished = 434
+	errorVideoRoomNotPublished     = 435
+	errorVideoRoomIDExists         = 436
+	errorVideoRoomInvalidSDP       = 437
+)
+
+// syncRequests are answered right away with a success, everything else is
+// acked and answered later with an event, like the real plugin does.
+var syncRequests = map[string]bool{
+	"create":           true,
+	"destroy":          true,
+	"exists":           true,
+	"list":             true,
+	"listparticipants": true,
+	"moderate":         true,
+	"kick":             true,
+	"enable_recording": true,
+	"listforwarders":   true,
+	"edit":             true,
+	"allowed":          true,
+	"rtp_forward":      true,
+	"stop_rtp_forward": true,
+}
+
+// videoroomRequest is the union of the request bodies the fake understands.
+type videoroomRequest struct {
+	Request       string `json:"request"`
+	Room          uint64 `json:"room"`
+	Description   string `json:"description"`
+	Publishers    int    `json:"publishers"`
+	NotifyJoining bool   `json:"notify_joining"`
+	Secret        string `json:"secret"`
+	Pin           string `json:"pin"`
+	Token         string `json:"token"`
+	PeerType      string `json:"ptype"`
+	ID            uint64 `json:"id"`
+	Display       string `json:"display"`
+	Feed          uint64 `json:"feed"`
+	Streams       []struct {
+		Feed uint64 `json:"feed"`
+		Mid  string `json:"mid"`
+		Send *bool  `json:"send"`
+
+		// rtp_forward
+		Host string `json:"host"`
+		Port int    `json:"port"`
+		SSRC uint32 `json:"ssrc"`
+		PT   int    `json:"pt"`
+	} `json:"streams"`
+
+	// configure, and moderate with Mid and Mute
+	Mid          string `json:"mid"`
+	Mute         bool   `json:"mute"`
+	Bitrate      int    `json:"bitrate"`
+	Record       *bool  `json:"record"`
+	Filename     string `json:"filename"`
+	Descriptions []struct {
+		Mid         string `json:"mid"`
+		Description string `json:"description"`
+	} `json:"descriptions"`
+
+	// edit
+	NewDescription string `json:"new_description"`
+	NewSecret      string `json:"new_secret"`
+	NewPin         string `json:"new_pin"`
+	NewBitrate     int    `json:"new_bitrate"`
+	NewPublishers  int    `json:"new_publishers"`
+	NewRecDir      string `json:"new_rec_dir"`
+
+	// allowed
+	Action  string   `json:"action"`
+	Allowed []string `json:"allowed"`
+
+	// rtp_forward and stop_rtp_forward
+	PublisherID uint64 `json:"publisher_id"`
+	Host        string `json:"host"`
+	SRTPSuite   int    `json:"srtp_suite"`
+	SRTPCrypto  string `json:"srtp_crypto"`
+	StreamID    uint64 `json:"stream_id"`
+}
+
+type room struct {
+	id            uint64
+	description   string
+	maxPublishers int
+	notifyJoining bool
+	secret        string
+	pin           string
+	bitrate       int
+	recDir        string
+	record        bool
+
+	// checkAllowed is set once the allowed tokens are enabled, only those
+	// in allowed can join then.
+	checkAllowed bool
+	allowed      map[string]bool
+
+	// participants holds the joined publisher handles by feed id,
+	// subscribers holds the joined subscriber handles.
+	participants map[uint64]*handle
+	subscribers  map[*handle]struct{}
+}
+
+func newRoom(id uint64, description string, maxPublishers int, notifyJoining bool) *room {
+	if maxPublishers <= 0 {
+		maxPublishers = 3
+	}
+	if description == "" {
+		description = fmt.Sprintf("Room %d", id)
+	}
+	return &room{
+		id:            id,
+		description:   description,
+		maxPublishers: maxPublishers,
+		notifyJoining: notifyJoining,
+		participants:  make(map[uint64]*handle),
+		subscribers:   make(map[*handle]struct{}),
+		allowed:       make(map[string]bool),
+	}
+}
+
+// handle is a videoroom plugin handle. Its videoroom state is guarded by
+// Server.mu, its messages are processed in order by its worker.
+type handle struct {
+	id      uint64
+	session *session
+	queue   chan *request
+	done    chan struct{}
+
+	room       *room
+	peerType   string
+	feed       uint64
+	display    string
+	publishing bool
+	feeds      []uint64
+	pc         *webrtc.PeerConnection
+
+	// what configure changed, muted and descriptions by mid
+	bitrate      int
+	recording    bool
+	filename     string
+	muted        map[string]bool
+	descriptions map[string]string
+
+	// moderated holds the mids a moderator muted
+	moderated map[string]bool
+
+	// forwarders are the RTP forwarders of the publisher by stream id
+	forwarders map[uint64]*forwarder
+}
+
+func newHandle(id uint64, s *session) *handle {
+	return &handle{id: id, session: s, queue: make(chan *request, 32), done: make(chan struct{})}
+}
+
+// message answers a plugin message, sync requests directly, the others with
+// an ack now and an event from the handle's worker later.
+func (server *Server) message(c *conn, h *handle, req *request) {
+	body := &videoroomRequest{}
+	if err := json.Unmarshal(req.Body, body); err != nil {
+		c.send(errorReply(req, errorInvalidJSON, err.Error()))
+		return
+	}
+
+	if syncRequests[body.Request] {
+		msg := reply(req, "success")
+		msg["sender"] = h.id
+		msg["plugindata"] = object{"plugin": VideoRoomPluginName, "data": server.syncRequest(h, body)}
+		c.send(msg)
+		return
+	}
+
+	c.send(reply(req, "ack"))
+	select {
+	case h.queue <- req:
+	case <-h.done:
+	}
+}
+
+func (server *Server) work(h *handle) {
+	for {
+		select {
+		case <-h.done:
+			return
+		case req := <-h.queue:
+			body := &videoroomRequest{}
+			json.Unmarshal(req.Body, body)
+
+			data, answer := server.asyncRequest(h, body, req.Jsep)
+			event := object{
+				"janus":       "event",
+				"transaction": req.Transaction,
+				"plugindata":  object{"plugin": VideoRoomPluginName, "data": data},
+			}
+			if answer != nil {
+				event["jsep"] = answer
+			}
+			server.push(h, event)
+		}
+	}
+}
+
+func (server *Server) syncRequest(h *handle, body *videoroomRequest) object {
+	switch body.Request {
+	case "create":
+		return server.createRoom(body)
+	case "destroy":
+		return server.destroyRoom(body)
+	case "exists":
+		server.mu.Lock()
+		exists := server.rooms[body.Room] != nil
+		server.mu.Unlock()
+		return object{"videoroom": "success", "room": body.Room, "exists": exists}
+	case "list":
+		return server.listRooms()
+	case "listparticipants":
+		return server.listParticipants(body)
+	case "moderate":
+		return server.moderate(body)
+	case "kick":
+		return server.kick(body)
+	case "enable_recording":
+		return server.enableRecording(body)
+	case "listforwarders":
+		return server.listForwarders(body)
+	case "rtp_forward":
+		return server.rtpForward(body)
+	case "stop_rtp_forward":
+		return server.stopRTPForward(body)
+	case "edit":
+		return server.editRoom(body)
+	case "allowed":
+		return server.allowedTokens(body)
+	}
+	return videoroomError(errorVideoRoomInvalidRequest, fmt.Sprintf("Unknown request '%s'", body.Request))
+}
+
+func (server *Server) asyncRequest(h *handle, body *videoroomRequest, offer *jsep) (object, object) {
+	switch body.Request {
+	case "join":
+		switch body.PeerType {
+		case "publisher":
+			return server.joinPublisher(h, body), nil
+		case "subscriber", "listener":
+			return server.joinSubscriber(h, body)
+		}
+		return videoroomError(errorVideoRoomInvalidRequest, fmt.Sprintf("Invalid element (ptype '%s')", body.PeerType)), nil
+	case "publish":
+		if offer == nil {
+			return videoroomError(errorVideoRoomMissingElement, "Missing mandatory element (jsep)"), nil
+		}
+		return server.publish(h, offer, false)
+	case "configure":
+		if offer != nil {
+			return server.publish(h, offer, true)
+		}
+		return server.configure(h, body), nil
+	case "unpublish":
+		return server.unpublish(h), nil
+	case "start":
+		return server.start(h, offer), nil
+	case "leave":
+		return server.leaveRequest(h), nil
+	}
+	return videoroomError(errorVideoRoomInvalidRequest, fmt.Sprintf("Unknown request '%s'", body.Request)), nil
+}
+
+func (server *Server) createRoom(body *videoroomRequest) object {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	id := body.Room
+	if id == 0 {
+		id = uint64(rand.Uint32())
+	}
+	if server.rooms[id] != nil {
+		return videoroomError(errorVideoRoomRoomExists, fmt.Sprintf("Room %d already exists", id))
+	}
+
+	server.rooms[id] = newRoom(id, body.Description, body.Publishers, body.NotifyJoining)
+	r := server.rooms[id]
+	r.secret, r.pin, r.bitrate = body.Secret, body.Pin, body.Bitrate
+	return object{"videoroom": "created", "room": id, "permanent": false}
+}
+
+func (server *Server) destroyRoom(body *videoroomRequest) object {
+	server.mu.Lock()
+	r, failure := server.roomWithSecret(body)
+	if failure != nil {
+		server.mu.Unlock()
+		return failure
+	}
+	delete(server.rooms, body.Room)
+	members := r.members(nil)
+	server.mu.Unlock()
+
+	for _, member := range members {
+		server.push(member, pluginEvent(object{"videoroom": "destroyed", "room": r.id}))
+		server.leave(member)
+	}
+
+	return object{"videoroom": "destroyed", "room": r.id, "permanent": false}
+}
+
+func (server *Server) listRooms() object {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	list := make([]object, 0, len(server.rooms))
+	for _, r := range server.rooms {
+		list = append(list, object{
+			"room":             r.id,
+			"description":      r.description,
+			"is_private":       false,
+			"max_publishers":   r.maxPublishers,
+			"notify_joining":   r.notifyJoining,
+			"audiocodec":       "opus",
+			"videocodec":       "vp8",
+			"record":           r.record,
+			"bitrate":          r.bitrate,
+			"pin_required":     r.pin != "",
+			"rec_dir":          r.recDir,
+			"num_participants": len(r.participants),
+		})
+	}
+	return object{"videoroom": "success", "list": list}
+}
+
+func (server *Server) listParticipants(body *videoroomRequest) object {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	r := server.rooms[body.Room]
+	if r == nil {
+		return videoroomError(errorVideoRoomNoSuchRoom, fmt.Sprintf("No such room (%d)", body.Room))
+	}
+
+	participants := make([]object, 0, len(r.participants))
+	for feed, h := range r.participants {
+		participant := object{"id": feed, "publisher": h.publishing, "talking": false}
+		if h.display != "" {
+			participant["display"] = h.display
+		}
+		participants = append(participants, participant)
+	}
+	return object{"videoroom": "participants", "room": r.id, "participants": participants}
+}
+
+// roomWithSecret returns the room of body when body carries its secret, or
+// the error to answer with. server.mu must be held.
+func (server *Server) roomWithSecret(body *videoroomRequest) (*room, object) {
+	r := server.rooms[body.Room]
+	if r == nil {
+		return nil, videoroomError(errorVideoRoomNoSuchRoom, fmt.Sprintf("No such room (%d)", body.Room))
+	}
+	if r.secret != "" && body.Secret != r.secret {
+		return nil, videoroomError(errorVideoRoomUnauthorized, "Unauthorized (wrong secret)")
+	}
+	return r, nil
+}
+
+func (server *Server) editRoom(body *videoroomRequest) object {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	r, failure := server.roomWithSecret(body)
+	if failure != nil {
+		return failure
+	}
+	if body.NewDescription != "" {
+		r.description = body.NewDescription
+	}
+	if body.NewSecret != "" {
+		r.secret = body.NewSecret
+	}
+	if body.NewPin != "" {
+		r.pin = body.NewPin
+	}
+	if body.NewBitrate > 0 {
+		r.bitrate = body.NewBitrate
+	}
+	if body.NewPublishers > 0 {
+		r.maxPublishers = body.NewPublishers
+	}
+	if body.NewRecDir != "" {
+		r.recDir = body.NewRecDir
+	}
+	return object{"videoroom": "edited", "room": r.id, "permanent": false}
+}
+
+func (server *Server) allowedTokens(body *videoroomRequest) object {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	r, failure := server.roomWithSecret(body)
+	if failure != nil {
+		return failure
+	}
+	switch body.Action {
+	case "enable":
+		r.checkAllowed = true
+	case "disable":
+		r.checkAllowed = false
+		return object{"videoroom": "success", "room": r.id}
+	case "add", "remove":
+		if len(body.Allowed) == 0 {
+			return videoroomError(errorVideoRoomMissingElement, "Missing mandatory element (allowed)")
+		}
+		for _, token := range body.Allowed {
+			if body.Action == "add" {
+				r.allowed[token] = true
+			} else {
+				delete(r.allowed, token)
+			}
+		}
+	default:
+		return videoroomError(errorVideoRoomInvalidElement, fmt.Sprintf("Unsupported action '%s' (allowed)", body.Action))
+	}
+
+	allowed := make([]string, 0, len(r.allowed))
+	for token := range r.allowed {
+		allowed = append(allowed, token)
+	}
+	sort.Strings(allowed)
+	return object{"videoroom": "success", "room": r.id, "allowed": allowed}
+}
+
+func (server *Server) moderate(body *videoroomRequest) object {
+	server.mu.Lock()
+	r, failure := server.roomWithSecret(body)
+	if failure != nil {
+		server.mu.Unlock()
+		return failure
+	}
+	h := r.participants[body.ID]
+	if h == nil {
+		server.mu.Unlock()
+		return videoroomError(errorVideoRoomNoSuchFeed, fmt.Sprintf("No such user %d in room %d", body.ID, r.id))
+	}
+	if body.Mid == "" {
+		server.mu.Unlock()
+		return videoroomError(errorVideoRoomMissingElement, "Missing mandatory element (mid)")
+	}
+	if h.moderated == nil {
+		h.moderated = make(map[string]bool)
+	}
+	h.moderated[body.Mid] = body.Mute
+	members := r.members(nil)
+	server.mu.Unlock()
+
+	moderation := "unmuted"
+	if body.Mute {
+		moderation = "muted"
+	}
+	event := pluginEvent(object{"videoroom": "event", "room": r.id, "id": body.ID, "mid": body.Mid, "moderation": moderation})
+	for _, member := range members {
+		server.push(member, event)
+	}
+	return object{"videoroom": "success"}
+}
+
+func (server *Server) kick(body *videoroomRequest) object {
+	server.mu.Lock()
+	r, failure := server.roomWithSecret(body)
+	if failure != nil {
+		server.mu.Unlock()
+		return failure
+	}
+	h := r.participants[body.ID]
+	if h == nil {
+		server.mu.Unlock()
+		return videoroomError(errorVideoRoomNoSuchFeed, fmt.Sprintf("No such user %d in room %d", body.ID, r.id))
+	}
+	others := r.members(h)
+	server.mu.Unlock()
+
+	kicked := pluginEvent(object{"videoroom": "event", "room": r.id, "kicked": body.ID})
+	for _, other := range others {
+		server.push(other, kicked)
+	}
+	server.push(h, pluginEvent(object{"videoroom": "event", "room": r.id, "leaving": "ok", "reason": "kicked"}))
+	server.leave(h)
+	return object{"videoroom": "success"}
+}
+
+func (server *Server) enableRecording(body *videoroomRequest) object {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	r, failure := server.roomWithSecret(body)
+	if failure != nil {
+		return failure
+	}
+	if body.Record == nil {
+		return videoroomError(errorVideoRoomMissingElement, "Missing mandatory element (record)")
+	}
+	r.record = *body.Record
+	for _, h := range r.participants {
+		h.recording = r.record
+	}
+	return object{"videoroom": "success", "record": r.record}
+}
+
+func (server *Server) joinPublisher(h *handle, body *videoroomRequest) object {
+	server.mu.Lock()
+	r := server.rooms[body.Room]
+	if r == nil {
+		server.mu.Unlock()
+		return videoroomError(errorVideoRoomNoSuchRoom, fmt.Sprintf("No such room (%d)", body.Room))
+	}
+	if h.room != nil {
+		server.mu.Unlock()
+		return videoroomError(errorVideoRoomAlreadyJoined, "Already in as a publisher on this handle")
+	}
+	if r.checkAllowed && !r.allowed[body.Token] {
+		server.mu.Unlock()
+		return videoroomError(errorVideoRoomUnauthorized, "Unauthorized (not in the allowed list)")
+	}
+
+	feed := body.ID
+	if feed != 0 && r.participants[feed] != nil {
+		server.mu.Unlock()
+		return videoroomError(errorVideoRoomIDExists, fmt.Sprintf("User ID %d already exists", feed))
+	}
+	for feed == 0 || r.participants[feed] != nil {
+		feed = uint64(rand.Int63n(1<<53)) + 1
+	}
+
+	h.room, h.peerType, h.feed, h.display = r, "publisher", feed, body.Display
+	joined := object{
+		"videoroom":   "joined",
+		"room":        r.id,
+		"description": r.description,
+		"id":          feed,
+		"private_id":  rand.Uint32(),
+		"publishers":  r.publishers(h),
+	}
+	if r.notifyJoining {
+		joined["attendees"] = r.attendees(h)
+	}
+	others := r.members(h)
+	r.participants[feed] = h
+	server.mu.Unlock()
+
+	if r.notifyJoining {
+		joining := pluginEvent(object{"videoroom": "event", "room": r.id, "joining": object{"id": feed, "display": body.Display}})
+		for _, other := range others {
+			server.push(other, joining)
+		}
+	}
+
+	return joined
+}
+
+func (server *Server) joinSubscriber(h *handle, body *videoroomRequest) (object, object) {
+	feeds := make([]uint64, 0, len(body.Streams)+1)
+	for _, stream := range body.Streams {
+		feeds = append(feeds, stream.Feed)
+	}
+	if body.Feed != 0 {
+		feeds = append(feeds, body.Feed)
+	}
+	if len(feeds) == 0 {
+		return videoroomError(errorVideoRoomMissingElement, "Missing mandatory element (streams)"), nil
+	}
+
+	server.mu.Lock()
+	r := server.rooms[body.Room]
+	if r == nil {
+		server.mu.Unlock()
+		return videoroomError(errorVideoRoomNoSuchRoom, fmt.Sprintf("No such room (%d)", body.Room)), nil
+	}
+	if h.room != nil {
+		server.mu.Unlock()
+		return videoroomError(errorVideoRoomAlreadyJoined, "Already in as a subscriber on this handle"), nil
+	}
+
+	streams := make([]object, 0, len(feeds))
+	for i, feed := range feeds {
+		publisher := r.participants[feed]
+		if publisher == nil || !publisher.publishing {
+			server.mu.Unlock()
+			return videoroomError(errorVideoRoomNoSuchFeed, fmt.Sprintf("No such feed (%d)", feed)), nil
+		}
+		streams = append(streams, object{
+			"mindex":       i,
+			"mid":          fmt.Sprint(i),
+			"type":         "audio",
+			"feed_id":      feed,
+			"feed_mid":     "0",
+			"feed_display": publisher.display,
+			"send":         true,
+			"ready":        false,
+		})
+	}
+	h.room, h.peerType, h.feeds = r, "subscriber", feeds
+	r.subscribers[h] = struct{}{}
+	server.mu.Unlock()
+
+	pc, offer, err := newSubscriberPeer(len(feeds), server.onWebRTCUp(h))
+	if err != nil {
+		server.leave(h)
+		return videoroomError(errorVideoRoomUnknown, err.Error()), nil
+	}
+	server.setPeer(h, pc)
+
+	return object{"videoroom": "attached", "room": r.id, "streams": streams}, object{"type": "offer", "sdp": offer}
+}
+
+// publish answers a publisher's offer. configure may renegotiate a running
+// publisher, publish may not.
+func (server *Server) publish(h *handle, offer *jsep, configure bool) (object, object) {
+	if offer.Type != "offer" {
+		return videoroomError(errorVideoRoomInvalidSDPType, fmt.Sprintf("Unsupported SDP type '%s'", offer.Type)), nil
+	}
+
+	server.mu.Lock()
+	r := h.room
+	switch {
+	case r == nil || h.peerType != "publisher":
+		server.mu.Unlock()
+		return videoroomError(errorVideoRoomJoinFirst, "Can't handle requests until joined"), nil
+	case h.publishing && !configure:
+		server.mu.Unlock()
+		return videoroomError(errorVideoRoomAlreadyPublished, "Can't publish, already published"), nil
+	case !h.publishing && r.publishingCount() >= r.maxPublishers:
+		server.mu.Unlock()
+		return videoroomError(errorVideoRoomPublishersFull, fmt.Sprintf("Maximum number of publishers (%d) already reached", r.maxPublishers)), nil
+	}
+	renegotiate := h.publishing
+	server.mu.Unlock()
+
+	pc, answer, err := newPublisherPeer(offer.SDP, server.onWebRTCUp(h), server.onMedia(h), server.onRTP(h))
+	if err != nil {
+		return videoroomError(errorVideoRoomInvalidSDP, err.Error()), nil
+	}
+
+	server.mu.Lock()
+	old := h.pc
+	h.pc, h.publishing = pc, true
+	info := h.publisherInfo()
+	others := r.members(h)
+	server.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+
+	if !renegotiate {
+		publishers := pluginEvent(object{"videoroom": "event", "room": r.id, "publishers": []object{info}})
+		for _, other := range others {
+			server.push(other, publishers)
+		}
+	}
+
+	data := object{"videoroom": "event", "room": r.id, "configured": "ok", "audio_codec": "opus"}
+	return data, object{"type": "answer", "sdp": answer}
+}
+
+func (server *Server) configure(h *handle, body *videoroomRequest) object {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if h.room == nil {
+		return videoroomError(errorVideoRoomJoinFirst, "Can't handle requests until joined")
+	}
+
+	if body.Bitrate > 0 {
+		h.bitrate = body.Bitrate
+	}
+	if body.Record != nil {
+		h.recording = *body.Record
+		h.filename = body.Filename
+	}
+	if body.Display != "" {
+		h.display = body.Display
+	}
+	for _, stream := range body.Streams {
+		if stream.Mid == "" {
+			return videoroomError(errorVideoRoomMissingElement, "Missing mandatory element (mid)")
+		}
+		if stream.Send != nil {
+			if h.muted == nil {
+				h.muted = make(map[string]bool)
+			}
+			h.muted[stream.Mid] = !*stream.Send
+		}
+	}
+	for _, description := range body.Descriptions {
+		if h.descriptions == nil {
+			h.descriptions = make(map[string]string)
+		}
+		h.descriptions[description.Mid] = description.Description
+	}
+	return object{"videoroom": "event", "room": h.room.id, "configured": "ok"}
+}
+
+func (server *Server) unpublish(h *handle) object {
+	server.mu.Lock()
+	r := h.room
+	if r == nil || h.peerType != "publisher" {
+		server.mu.Unlock()
+		return videoroomError(errorVideoRoomJoinFirst, "Can't handle requests until joined")
+	}
+	if !h.publishing {
+		server.mu.Unlock()
+		return videoroomError(errorVideoRoomNotPublished, "Can't unpublish, not published")
+	}
+	h.publishing = false
+	others := r.members(h)
+	server.mu.Unlock()
+
+	server.hangup(h)
+	unpublished := pluginEvent(object{"videoroom": "event", "room": r.id, "unpublished": h.feed})
+	for _, other := range others {
+		server.push(other, unpublished)
+	}
+
+	return object{"videoroom": "event", "room": r.id, "unpublished": "ok"}
+}
+
+func (server *Server) start(h *handle, answer *jsep) object {
+	server.mu.Lock()
+	r, pc := h.room, h.pc
+	subscriber := h.peerType == "subscriber"
+	server.mu.Unlock()
+
+	if r == nil || !subscriber || pc == nil {
+		return videoroomError(errorVideoRoomJoinFirst, "Can't handle requests until joined")
+	}
+	if answer == nil || answer.Type != "answer" {
+		return videoroomError(errorVideoRoomInvalidSDPType, "Missing or invalid answer")
+	}
+
+	err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer.SDP})
+	if err != nil {
+		return videoroomError(errorVideoRoomInvalidSDP, err.Error())
+	}
+
+	return object{"videoroom": "event", "room": r.id, "started": "ok"}
+}
+
+func (server *Server) leaveRequest(h *handle) object {
+	server.mu.Lock()
+	subscriber := h.peerType == "subscriber"
+	server.mu.Unlock()
+
+	server.leave(h)
+	if subscriber {
+		return object{"videoroom": "event", "left": "ok"}
+	}
+	return object{"videoroom": "event", "leaving": "ok"}
+}
+
+// leave takes h out of its room, telling the others when a publisher goes.
+func (server *Server) leave(h *handle) {
+	server.mu.Lock()
+	r := h.room
+	if r == nil {
+		server.mu.Unlock()
+		server.hangup(h)
+		return
+	}
+
+	publisher := h.peerType == "publisher"
+	delete(r.participants, h.feed)
+	delete(r.subscribers, h)
+	others := r.members(h)
+	feed := h.feed
+	forwarders := h.sortedForwarders()
+	h.room, h.peerType, h.feed, h.publishing, h.feeds, h.forwarders = nil, "", 0, false, nil, nil
+	server.mu.Unlock()
+
+	closeForwarders(forwarders)
+
+	server.hangup(h)
+	if publisher {
+		leaving := pluginEvent(object{"videoroom": "event", "room": r.id, "leaving": feed})
+		for _, other := range others {
+			server.push(other, leaving)
+		}
+	}
+}
+
+// hangup closes the peer of h, and tells the client like Janus does.
+func (server *Server) hangup(h *handle) {
+	server.mu.Lock()
+	pc := h.pc
+	h.pc = nil
+	server.mu.Unlock()
+
+	if pc == nil {
+		return
+	}
+	pc.Close()
+	server.push(h, object{"janus": "hangup", "reason": "Close PC"})
+}
+
+func (server *Server) setPeer(h *handle, pc *webrtc.PeerConnection) {
+	server.mu.Lock()
+	old := h.pc
+	h.pc = pc
+	server.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+}
+
+func (server *Server) onWebRTCUp(h *handle) func() {
+	return func() {
+		server.push(h, object{"janus": "webrtcup"})
+	}
+}
+
+func (server *Server) onMedia(h *handle) func(kind string) {
+	return func(kind string) {
+		server.push(h, object{"janus": "media", "type": kind, "receiving": true})
+	}
+}
+
+// members returns every handle joined to the room except skip.
+func (r *room) members(skip *handle) []*handle {
+	members := make([]*handle, 0, len(r.participants)+len(r.subscribers))
+	for _, participant := range r.participants {
+		if participant != skip {
+			members = append(members, participant)
+		}
+	}
+	for subscriber := range r.subscribers {
+		if subscriber != skip {
+			members = append(members, subscriber)
+		}
+	}
+	return members
+}
+
+func (r *room) publishingCount() int {
+	count := 0
+	for _, participant := range r.participants {
+		if participant.publishing {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *room) publishers(skip *handle) []object {
+	publishers := make([]object, 0)
+	for _, participant := range r.sortedParticipants() {
+		if participant != skip && participant.publishing {
+			publishers = append(publishers, participant.publisherInfo())
+		}
+	}
+	return publishers
+}
+
+func (r *room) attendees(skip *handle) []object {
+	attendees := make([]object, 0)
+	for _, participant := range r.sortedParticipants() {
+		if participant != skip && !participant.publishing {
+			attendees = append(attendees, object{"id": participant.feed, "display": participant.display})
+		}
+	}
+	return attendees
+}
+
+func (r *room) sortedParticipants() []*handle {
+	participants := make([]*handle, 0, len(r.participants))
+	for _, participant := range r.participants {
+		participants = append(participants, participant)
+	}
+	sort.Slice(participants, func(i, j int) bool { return participants[i].feed < participants[j].feed })
+	return participants
+}
+
+func (h *handle) publisherInfo() object {
+	return object{
+		"id":      h.feed,
+		"display": h.display,
+		"streams": []object{h.streamInfo("0")},
+	}
+}
+
+// streamInfo describes the audio stream of a publisher, with what configure
+// changed about it.
+func (h *handle) streamInfo(mid string) object {
+	stream := object{"type": "audio", "mindex": 0, "mid": mid, "codec": "opus"}
+	if description := h.descriptions[mid]; description != "" {
+		stream["description"] = description
+	}
+	if h.muted[mid] {
+		stream["disabled"] = true
+	}
+	if h.moderated[mid] {
+		stream["moderated"] = true
+	}
+	return stream
+}
+
+func pluginEvent(data object) object {
+	return object{"janus": "event", "plugindata": object{"plugin": VideoRoomPluginName, "data": data}}
+}
+
+func videoroomError(code int, reason string) object {
+	return object{"videoroom": "event", "error_code": code, "error": reason}
+}
@@ -1,49 +1,430 @@
 package janus
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
-	"github.com/gorilla/websocket"
-	"github.com/rs/xid"
-	"github.com/tidwall/gjson"
 )
 
+// WsAdminConnect initiates a websocket connection with the Janus Admin API,
+// using the stock admin secret. See Connect and WithAdminSecret for others.
 func WsAdminConnect(wsURL string) (*Gateway, error) {
-	websocket.DefaultDialer.Subprotocols = []string{WebsocketAdminSubProtocol}
+	return Connect(WithURL(wsURL), WithSubprotocol(WebsocketAdminSubProtocol))
+}
 
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+// adminCall sends an Admin API request made of method and fields and decodes
+// the success Janus answers with into response.
+func (gateway *Gateway) adminCall(ctx context.Context, method string, fields map[string]interface{}, response interface{}) error {
+	req, ch := gateway.newAdminRequest(method)
+	for key, value := range fields {
+		req[key] = value
+	}
+	id, err := gateway.send(req, ch)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	msg, err := gateway.wait(ctx, method, id, ch)
+	if err != nil {
+		return err
+	}
+	switch msg := msg.(type) {
+	case *SuccessMsg:
+		if err := decodeSuccess(msg, response); err != nil {
+			return wrapRequestError(method, err)
+		}
+		return nil
+	case *ErrorMsg:
+		return msg
 	}
 
-	gateway := new(Gateway)
-	gateway.conn = conn
-	gateway.transactions = make(map[xid.ID]chan interface{})
-	gateway.transactionsUsed = make(map[xid.ID]bool)
-	gateway.Sessions = make(map[uint64]*Session)
-	gateway.sendChan = make(chan []byte, 100)
-	gateway.errors = make(chan error)
-	gateway.debug = true
+	return unexpected(method)
+}
 
-	go gateway.ping()
-	go gateway.recv()
-	return gateway, nil
+// GetStatus returns the core configuration of Janus.
+func (gateway *Gateway) GetStatus() (*AdminStatus, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.GetStatusCtx(ctx)
 }
 
-func (gateway *Gateway) GetStatus() (interface{}, error) {
-	req, ch := newAdminRequest("get_status")
-	gateway.send(req, ch)
+// GetStatusCtx is like GetStatus but gives up with a *TimeoutError once ctx
+// is done.
+func (gateway *Gateway) GetStatusCtx(ctx context.Context) (*AdminStatus, error) {
+	response := &statusResponse{}
+	if err := gateway.adminCall(ctx, "get_status", nil, response); err != nil {
+		return nil, err
+	}
+	if response.Status == nil {
+		return nil, errors.New("get_status response not contains status field")
+	}
+	return response.Status, nil
+}
+
+// Ping checks that the Admin API answers.
+func (gateway *Gateway) Ping() (*PongMsg, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.PingCtx(ctx)
+}
 
-	msg := <-ch
+// PingCtx is like Ping but gives up with a *TimeoutError once ctx is done.
+func (gateway *Gateway) PingCtx(ctx context.Context) (*PongMsg, error) {
+	req, ch := gateway.newAdminRequest("ping")
+	id, err := gateway.send(req, ch)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := gateway.wait(ctx, "ping", id, ch)
+	if err != nil {
+		return nil, err
+	}
 	switch msg := msg.(type) {
-	case *SuccessMsg:
-		if !gjson.GetBytes(msg.response, "status").Exists() {
-			return nil, errors.New("get_status response not contains status field")
-		}
-		statusInfo := gjson.GetBytes(msg.response, "status").Value()
-		return statusInfo, nil
+	case *PongMsg:
+		return msg, nil
 	case *ErrorMsg:
 		return nil, msg
 	}
 
-	return nil, unexpected("get_status")
+	return nil, unexpected("ping")
+}
+
+// ListSessions returns the ids of all the sessions Janus knows.
+func (gateway *Gateway) ListSessions() ([]uint64, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.ListSessionsCtx(ctx)
+}
+
+// ListSessionsCtx is like ListSessions but gives up with a *TimeoutError once
+// ctx is done.
+func (gateway *Gateway) ListSessionsCtx(ctx context.Context) ([]uint64, error) {
+	response := &sessionsResponse{}
+	if err := gateway.adminCall(ctx, "list_sessions", nil, response); err != nil {
+		return nil, err
+	}
+	return response.Sessions, nil
+}
+
+// ListHandles returns the ids of the handles of a session.
+func (gateway *Gateway) ListHandles(sessionID uint64) ([]uint64, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.ListHandlesCtx(ctx, sessionID)
+}
+
+// ListHandlesCtx is like ListHandles but gives up with a *TimeoutError once
+// ctx is done.
+func (gateway *Gateway) ListHandlesCtx(ctx context.Context, sessionID uint64) ([]uint64, error) {
+	response := &handlesResponse{}
+	fields := map[string]interface{}{"session_id": sessionID}
+	if err := gateway.adminCall(ctx, "list_handles", fields, response); err != nil {
+		return nil, err
+	}
+	return response.Handles, nil
+}
+
+// HandleInfo returns what Janus knows about a handle. With pluginOnly only
+// the plugin and its plugin_specific part are filled in.
+func (gateway *Gateway) HandleInfo(sessionID, handleID uint64, pluginOnly bool) (*HandleInfo, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.HandleInfoCtx(ctx, sessionID, handleID, pluginOnly)
+}
+
+// HandleInfoCtx is like HandleInfo but gives up with a *TimeoutError once ctx
+// is done.
+func (gateway *Gateway) HandleInfoCtx(ctx context.Context, sessionID, handleID uint64, pluginOnly bool) (*HandleInfo, error) {
+	response := &handleInfoResponse{}
+	fields := map[string]interface{}{"session_id": sessionID, "handle_id": handleID}
+	if pluginOnly {
+		fields["plugin_only"] = true
+	}
+	if err := gateway.adminCall(ctx, "handle_info", fields, response); err != nil {
+		return nil, err
+	}
+	if response.Info == nil {
+		return nil, errors.New("handle_info response not contains info field")
+	}
+	return response.Info, nil
+}
+
+// SetSessionTimeout changes how many seconds a session may stay silent
+// before Janus drops it, 0 meaning never.
+func (gateway *Gateway) SetSessionTimeout(timeout int) (*SessionTimeoutResponse, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.SetSessionTimeoutCtx(ctx, timeout)
+}
+
+// SetSessionTimeoutCtx is like SetSessionTimeout but gives up with a
+// *TimeoutError once ctx is done.
+func (gateway *Gateway) SetSessionTimeoutCtx(ctx context.Context, timeout int) (*SessionTimeoutResponse, error) {
+	response := &SessionTimeoutResponse{}
+	fields := map[string]interface{}{"timeout": timeout}
+	if err := gateway.adminCall(ctx, "set_session_timeout", fields, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// SetLogLevel changes the log level of Janus, from 0 (none) to 7 (huge).
+func (gateway *Gateway) SetLogLevel(level int) (*LogLevelResponse, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.SetLogLevelCtx(ctx, level)
+}
+
+// SetLogLevelCtx is like SetLogLevel but gives up with a *TimeoutError once
+// ctx is done.
+func (gateway *Gateway) SetLogLevelCtx(ctx context.Context, level int) (*LogLevelResponse, error) {
+	response := &LogLevelResponse{}
+	fields := map[string]interface{}{"level": level}
+	if err := gateway.adminCall(ctx, "set_log_level", fields, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// SetLockingDebug turns the debugging of the Janus mutexes on or off.
+func (gateway *Gateway) SetLockingDebug(debug bool) (*LockingDebugResponse, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.SetLockingDebugCtx(ctx, debug)
+}
+
+// SetLockingDebugCtx is like SetLockingDebug but gives up with a
+// *TimeoutError once ctx is done.
+func (gateway *Gateway) SetLockingDebugCtx(ctx context.Context, debug bool) (*LockingDebugResponse, error) {
+	response := &LockingDebugResponse{}
+	fields := map[string]interface{}{"debug": debug}
+	if err := gateway.adminCall(ctx, "set_locking_debug", fields, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// SetRefcountDebug turns the debugging of the Janus reference counters on or
+// off.
+func (gateway *Gateway) SetRefcountDebug(debug bool) (*RefcountDebugResponse, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.SetRefcountDebugCtx(ctx, debug)
+}
+
+// SetRefcountDebugCtx is like SetRefcountDebug but gives up with a
+// *TimeoutError once ctx is done.
+func (gateway *Gateway) SetRefcountDebugCtx(ctx context.Context, debug bool) (*RefcountDebugResponse, error) {
+	response := &RefcountDebugResponse{}
+	fields := map[string]interface{}{"debug": debug}
+	if err := gateway.adminCall(ctx, "set_refcount_debug", fields, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// AcceptNewSessions tells Janus whether to accept new sessions. While it
+// does not, create fails with error 472.
+func (gateway *Gateway) AcceptNewSessions(accept bool) (*AcceptNewSessionsResponse, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.AcceptNewSessionsCtx(ctx, accept)
+}
+
+// AcceptNewSessionsCtx is like AcceptNewSessions but gives up with a
+// *TimeoutError once ctx is done.
+func (gateway *Gateway) AcceptNewSessionsCtx(ctx context.Context, accept bool) (*AcceptNewSessionsResponse, error) {
+	response := &AcceptNewSessionsResponse{}
+	fields := map[string]interface{}{"accept": accept}
+	if err := gateway.adminCall(ctx, "accept_new_sessions", fields, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// DetachHandle detaches a handle of any session, as if its owner had.
+func (gateway *Gateway) DetachHandle(sessionID, handleID uint64) (*AdminResponse, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.DetachHandleCtx(ctx, sessionID, handleID)
+}
+
+// DetachHandleCtx is like DetachHandle but gives up with a *TimeoutError once
+// ctx is done.
+func (gateway *Gateway) DetachHandleCtx(ctx context.Context, sessionID, handleID uint64) (*AdminResponse, error) {
+	return gateway.adminHandleCall(ctx, "detach_handle", sessionID, handleID)
+}
+
+// DestroySession destroys a session of any client, as if it had timed out.
+func (gateway *Gateway) DestroySession(sessionID uint64) (*AdminResponse, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.DestroySessionCtx(ctx, sessionID)
+}
+
+// DestroySessionCtx is like DestroySession but gives up with a *TimeoutError
+// once ctx is done.
+func (gateway *Gateway) DestroySessionCtx(ctx context.Context, sessionID uint64) (*AdminResponse, error) {
+	return gateway.adminHandleCall(ctx, "destroy_session", sessionID, 0)
+}
+
+// HangupWebRTC closes the PeerConnection of a handle, leaving the handle
+// itself attached.
+func (gateway *Gateway) HangupWebRTC(sessionID, handleID uint64) (*AdminResponse, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.HangupWebRTCCtx(ctx, sessionID, handleID)
+}
+
+// HangupWebRTCCtx is like HangupWebRTC but gives up with a *TimeoutError once
+// ctx is done.
+func (gateway *Gateway) HangupWebRTCCtx(ctx context.Context, sessionID, handleID uint64) (*AdminResponse, error) {
+	return gateway.adminHandleCall(ctx, "hangup_webrtc", sessionID, handleID)
+}
+
+// adminHandleCall sends a request about a session, or one of its handles
+// when handleID is not 0, that Janus answers with a bare success.
+func (gateway *Gateway) adminHandleCall(ctx context.Context, method string, sessionID, handleID uint64) (*AdminResponse, error) {
+	fields := map[string]interface{}{"session_id": sessionID}
+	if handleID != 0 {
+		fields["handle_id"] = handleID
+	}
+	response := &AdminResponse{}
+	if err := gateway.adminCall(ctx, method, fields, response); err != nil {
+		return nil, err
+	}
+	response.SessionID, response.HandleID = sessionID, handleID
+	return response, nil
+}
+
+// AddToken stores a token for the token based authentication of Janus,
+// token_auth. The token gives access to plugins, or to all of them when
+// plugins is empty.
+func (gateway *Gateway) AddToken(token string, plugins []string) (*TokenResponse, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.AddTokenCtx(ctx, token, plugins)
+}
+
+// AddTokenCtx is like AddToken but gives up with a *TimeoutError once ctx is
+// done.
+func (gateway *Gateway) AddTokenCtx(ctx context.Context, token string, plugins []string) (*TokenResponse, error) {
+	return gateway.tokenCall(ctx, "add_token", token, plugins)
+}
+
+// ListTokens returns the tokens stored with AddToken.
+func (gateway *Gateway) ListTokens() ([]StoredToken, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.ListTokensCtx(ctx)
+}
+
+// ListTokensCtx is like ListTokens but gives up with a *TimeoutError once ctx
+// is done.
+func (gateway *Gateway) ListTokensCtx(ctx context.Context) ([]StoredToken, error) {
+	response := &tokensResponse{}
+	if err := gateway.adminCall(ctx, "list_tokens", nil, response); err != nil {
+		return nil, err
+	}
+	return response.Data.Tokens, nil
+}
+
+// AllowToken gives a stored token access to more plugins.
+func (gateway *Gateway) AllowToken(token string, plugins []string) (*TokenResponse, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.AllowTokenCtx(ctx, token, plugins)
+}
+
+// AllowTokenCtx is like AllowToken but gives up with a *TimeoutError once ctx
+// is done.
+func (gateway *Gateway) AllowTokenCtx(ctx context.Context, token string, plugins []string) (*TokenResponse, error) {
+	return gateway.tokenCall(ctx, "allow_token", token, plugins)
+}
+
+// DisallowToken takes the access to plugins away from a stored token.
+func (gateway *Gateway) DisallowToken(token string, plugins []string) (*TokenResponse, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.DisallowTokenCtx(ctx, token, plugins)
+}
+
+// DisallowTokenCtx is like DisallowToken but gives up with a *TimeoutError
+// once ctx is done.
+func (gateway *Gateway) DisallowTokenCtx(ctx context.Context, token string, plugins []string) (*TokenResponse, error) {
+	return gateway.tokenCall(ctx, "disallow_token", token, plugins)
+}
+
+// RemoveToken revokes a stored token. The sessions created with it live on.
+func (gateway *Gateway) RemoveToken(token string) (*TokenResponse, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.RemoveTokenCtx(ctx, token)
+}
+
+// RemoveTokenCtx is like RemoveToken but gives up with a *TimeoutError once
+// ctx is done.
+func (gateway *Gateway) RemoveTokenCtx(ctx context.Context, token string) (*TokenResponse, error) {
+	return gateway.tokenCall(ctx, "remove_token", token, nil)
+}
+
+func (gateway *Gateway) tokenCall(ctx context.Context, method, token string, plugins []string) (*TokenResponse, error) {
+	fields := map[string]interface{}{"token": token}
+	if len(plugins) > 0 {
+		fields["plugins"] = plugins
+	}
+
+	response := &tokenResponse{}
+	if err := gateway.adminCall(ctx, method, fields, response); err != nil {
+		return nil, err
+	}
+	if response.Data == nil {
+		response.Data = &TokenResponse{}
+	}
+	response.Data.Token = token
+	return response.Data, nil
+}
+
+// MessagePlugin hands request to a plugin outside of any handle, such as a
+// videoroom "list" or "create". Plugins only accept their synchronous
+// requests this way.
+func (gateway *Gateway) MessagePlugin(plugin string, request interface{}) (*PluginResponse, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.MessagePluginCtx(ctx, plugin, request)
+}
+
+// MessagePluginCtx is like MessagePlugin but gives up with a *TimeoutError
+// once ctx is done.
+func (gateway *Gateway) MessagePluginCtx(ctx context.Context, plugin string, request interface{}) (*PluginResponse, error) {
+	return gateway.pluginCall(ctx, "message_plugin", "plugin", plugin, request)
+}
+
+// QueryEventHandler hands request to an event handler, such as
+// "janus.eventhandler.sampleevh".
+func (gateway *Gateway) QueryEventHandler(handler string, request interface{}) (*PluginResponse, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.QueryEventHandlerCtx(ctx, handler, request)
+}
+
+// QueryEventHandlerCtx is like QueryEventHandler but gives up with a
+// *TimeoutError once ctx is done.
+func (gateway *Gateway) QueryEventHandlerCtx(ctx context.Context, handler string, request interface{}) (*PluginResponse, error) {
+	return gateway.pluginCall(ctx, "query_eventhandler", "handler", handler, request)
+}
+
+func (gateway *Gateway) pluginCall(ctx context.Context, method, key, name string, request interface{}) (*PluginResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, wrapRequestError(method, err)
+	}
+	fields := map[string]interface{}{key: name, "request": json.RawMessage(body)}
+
+	response := &PluginResponse{}
+	if err := gateway.adminCall(ctx, method, fields, response); err != nil {
+		return nil, err
+	}
+	return response, nil
 }
@@ -0,0 +1,204 @@
+package janus
+
+import (
+	"testing"
+
+	"github.com/Hwanse/janus-tester/internal/fakejanus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AdminSettings(t *testing.T) {
+	server := newFakeJanus(t)
+	admin, err := WsAdminConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer admin.Close()
+
+	_, err = admin.Ping()
+	assert.NoError(t, err)
+
+	timeout, err := admin.SetSessionTimeout(120)
+	assert.NoError(t, err)
+	assert.Equal(t, 120, timeout.Timeout)
+
+	level, err := admin.SetLogLevel(7)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, level.Level)
+	_, err = admin.SetLogLevel(9)
+	assert.IsType(t, &ErrorMsg{}, err)
+
+	locking, err := admin.SetLockingDebug(true)
+	assert.NoError(t, err)
+	assert.True(t, locking.LockingDebug)
+
+	refcount, err := admin.SetRefcountDebug(true)
+	assert.NoError(t, err)
+	assert.True(t, refcount.RefcountDebug)
+
+	status, err := admin.GetStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, 120, status.SessionTimeout)
+	assert.Equal(t, 7, status.LogLevel)
+	assert.True(t, status.LockingDebug)
+	assert.True(t, status.RefcountDebug)
+
+	accept, err := admin.AcceptNewSessions(false)
+	assert.NoError(t, err)
+	assert.False(t, accept.Accept)
+
+	client, err := WsConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer client.Close()
+	_, err = client.Create()
+	assert.Error(t, err, "sessions are refused")
+
+	_, err = admin.AcceptNewSessions(true)
+	assert.NoError(t, err)
+	_, err = client.Create()
+	assert.NoError(t, err)
+
+	_, err = admin.QueryEventHandler("janus.eventhandler.sampleevh", map[string]interface{}{"request": "info"})
+	assert.IsType(t, &ErrorMsg{}, err)
+}
+
+func Test_AdminSessions(t *testing.T) {
+	server := newFakeJanus(t)
+	admin, err := WsAdminConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer admin.Close()
+
+	client, err := WsConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	session, err := client.Create()
+	assert.NoError(t, err)
+	publisher, err := session.Attach(VideoRoomPluginName)
+	assert.NoError(t, err)
+	joined, err := publisher.JoinPublisher(&JoinPublisherRequest{
+		Request:     TypeJoin,
+		RoomID:      fakejanus.DefaultRoom,
+		PeerType:    TypePublisher,
+		DisplayName: "alice",
+	})
+	assert.NoError(t, err)
+	other, err := session.Attach(VideoRoomPluginName)
+	assert.NoError(t, err)
+
+	sessions, err := admin.ListSessions()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{session.ID}, sessions)
+
+	handles, err := admin.ListHandles(session.ID)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []uint64{publisher.ID, other.ID}, handles)
+
+	info, err := admin.HandleInfo(session.ID, publisher.ID, false)
+	assert.NoError(t, err)
+	assert.Equal(t, session.ID, info.SessionID)
+	assert.Equal(t, publisher.ID, info.HandleID)
+	assert.Equal(t, VideoRoomPluginName, info.Plugin)
+
+	videoroom := &VideoRoomHandleInfo{}
+	assert.NoError(t, info.DecodePluginSpecific(videoroom))
+	assert.Equal(t, TypePublisher, videoroom.Type)
+	assert.Equal(t, fakejanus.DefaultRoom, videoroom.Room)
+	assert.Equal(t, joined.FeedID, videoroom.ID)
+	assert.Equal(t, "alice", videoroom.Display)
+
+	info, err = admin.HandleInfo(session.ID, other.ID, true)
+	assert.NoError(t, err)
+	assert.Zero(t, info.SessionID, "plugin_only leaves the core part out")
+	assert.NoError(t, info.DecodePluginSpecific(videoroom))
+	assert.Equal(t, "none", videoroom.Type)
+
+	_, err = admin.HangupWebRTC(session.ID, publisher.ID)
+	assert.NoError(t, err)
+
+	detached, err := admin.DetachHandle(session.ID, other.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, other.ID, detached.HandleID)
+	handles, err = admin.ListHandles(session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{publisher.ID}, handles)
+
+	_, err = admin.DestroySession(session.ID)
+	assert.NoError(t, err)
+	sessions, err = admin.ListSessions()
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	_, err = admin.ListHandles(session.ID)
+	assert.IsType(t, &ErrorMsg{}, err)
+}
+
+func Test_AdminMessagePlugin(t *testing.T) {
+	server := newFakeJanus(t)
+	admin, err := WsAdminConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer admin.Close()
+
+	response, err := admin.MessagePlugin(VideoRoomPluginName, &ExistsRoomRequest{Request: TypeExists, RoomID: fakejanus.DefaultRoom})
+	assert.NoError(t, err)
+	exists := &ExistsRoomResponse{}
+	assert.NoError(t, response.Decode(exists))
+	assert.True(t, exists.IsExists)
+
+	response, err = admin.MessagePlugin(VideoRoomPluginName, &RoomListRequest{Request: TypeList})
+	assert.NoError(t, err)
+	list := &RoomListResponse{}
+	assert.NoError(t, response.Decode(list))
+	assert.NotEmpty(t, list.List)
+
+	_, err = admin.MessagePlugin(VideoRoomPluginName, &JoinPublisherRequest{Request: TypeJoin, RoomID: fakejanus.DefaultRoom})
+	assert.IsType(t, &ErrorMsg{}, err)
+
+	_, err = admin.MessagePlugin("janus.plugin.nosuch", &RoomListRequest{Request: TypeList})
+	assert.IsType(t, &ErrorMsg{}, err)
+}
+
+func Test_AdminTokens(t *testing.T) {
+	server := newFakeJanus(t)
+	server.TokenAuth = true
+	admin, err := WsAdminConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer admin.Close()
+
+	added, err := admin.AddToken("alice", []string{VideoRoomPluginName})
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", added.Token)
+	assert.Equal(t, []string{VideoRoomPluginName}, added.Plugins)
+	_, err = admin.AddToken("bob", nil)
+	assert.NoError(t, err)
+
+	tokens, err := admin.ListTokens()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []StoredToken{
+		{Token: "alice", AllowedPlugins: []string{VideoRoomPluginName}},
+		{Token: "bob", AllowedPlugins: []string{VideoRoomPluginName}},
+	}, tokens)
+
+	client, err := WsConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	session, err := client.CreateWithToken("bob")
+	assert.NoError(t, err)
+	disallowed, err := admin.DisallowToken("bob", []string{VideoRoomPluginName})
+	assert.NoError(t, err)
+	assert.Empty(t, disallowed.Plugins)
+	_, err = session.Attach(VideoRoomPluginName)
+	assert.True(t, IsUnauthorized(err))
+
+	_, err = admin.AllowToken("bob", []string{VideoRoomPluginName})
+	assert.NoError(t, err)
+	_, err = session.Attach(VideoRoomPluginName)
+	assert.NoError(t, err)
+
+	_, err = admin.RemoveToken("alice")
+	assert.NoError(t, err)
+	_, err = client.CreateWithToken("alice")
+	assert.True(t, IsUnauthorized(err))
+
+	_, err = admin.RemoveToken("alice")
+	assert.IsType(t, &ErrorMsg{}, err)
+}
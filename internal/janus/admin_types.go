@@ -0,0 +1,178 @@
+package janus
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// AdminStatus is the core configuration returned by get_status.
+type AdminStatus struct {
+	TokenAuth             bool `json:"token_auth"`
+	APISecret             bool `json:"api_secret"`
+	AdminSecret           bool `json:"admin_secret"`
+	SessionTimeout        int  `json:"session_timeout"`
+	ReclaimSessionTimeout int  `json:"reclaim_session_timeout"`
+	CandidatesTimeout     int  `json:"candidates_timeout"`
+	LogLevel              int  `json:"log_level"`
+	LogTimestamps         bool `json:"log_timestamps"`
+	LogColors             bool `json:"log_colors"`
+	LockingDebug          bool `json:"locking_debug"`
+	RefcountDebug         bool `json:"refcount_debug"`
+	LibniceDebug          bool `json:"libnice_debug"`
+	MinNackQueue          int  `json:"min_nack_queue"`
+	NackOptimizations     bool `json:"nack-optimizations"`
+	NoMediaTimer          int  `json:"no_media_timer"`
+	SlowlinkThreshold     int  `json:"slowlink_threshold"`
+}
+
+type statusResponse struct {
+	Status *AdminStatus `json:"status"`
+}
+
+type sessionsResponse struct {
+	Sessions []uint64 `json:"sessions"`
+}
+
+type handlesResponse struct {
+	Handles []uint64 `json:"handles"`
+}
+
+type handleInfoResponse struct {
+	Info *HandleInfo `json:"info"`
+}
+
+// HandleInfo is what handle_info tells about a handle. The WebRTC state is
+// kept undecoded, its layout changes between Janus versions.
+type HandleInfo struct {
+	SessionID           uint64 `json:"session_id"`
+	SessionLastActivity int64  `json:"session_last_activity"`
+	SessionTimeout      int    `json:"session_timeout"`
+	SessionTransport    string `json:"session_transport"`
+	HandleID            uint64 `json:"handle_id"`
+	OpaqueID            string `json:"opaque_id"`
+	LoopRunning         bool   `json:"loop-running"`
+	Created             int64  `json:"created"`
+	CurrentTime         int64  `json:"current_time"`
+
+	Plugin         string                 `json:"plugin"`
+	PluginSpecific map[string]interface{} `json:"plugin_specific"`
+
+	Flags         map[string]bool `json:"flags"`
+	AgentCreated  int64           `json:"agent-created"`
+	IceMode       string          `json:"ice-mode"`
+	IceRole       string          `json:"ice-role"`
+	SDPs          *HandleSDPs     `json:"sdps"`
+	QueuedPackets int             `json:"queued-packets"`
+
+	// Streams is the WebRTC state of Janus 0.x, WebRTC that of Janus 1.x.
+	Streams []map[string]interface{} `json:"streams"`
+	WebRTC  map[string]interface{}   `json:"webrtc"`
+}
+
+// HandleSDPs are the last local and remote session descriptions of a handle.
+type HandleSDPs struct {
+	Profile string `json:"profile"`
+	Local   string `json:"local"`
+	Remote  string `json:"remote"`
+}
+
+// DecodePluginSpecific decodes the plugin_specific part of the info into v,
+// such as a *VideoRoomHandleInfo for a videoroom handle.
+func (info *HandleInfo) DecodePluginSpecific(v interface{}) error {
+	return mapstructure.WeakDecode(info.PluginSpecific, v)
+}
+
+// VideoRoomHandleInfo is the plugin_specific part of the info of a
+// videoroom handle.
+type VideoRoomHandleInfo struct {
+	// Type is "publisher", "subscriber" or "none" before joining a room.
+	Type        string   `mapstructure:"type"`
+	Room        uint64   `mapstructure:"room"`
+	ID          uint64   `mapstructure:"id"`
+	PrivateID   uint64   `mapstructure:"private_id"`
+	Display     string   `mapstructure:"display"`
+	AudioActive bool     `mapstructure:"audio_active"`
+	VideoActive bool     `mapstructure:"video_active"`
+	Bitrate     uint64   `mapstructure:"bitrate"`
+	Feeds       []uint64 `mapstructure:"feeds"`
+	Hangingup   int      `mapstructure:"hangingup"`
+	Destroyed   int      `mapstructure:"destroyed"`
+}
+
+// SessionTimeoutResponse answers set_session_timeout.
+type SessionTimeoutResponse struct {
+	Timeout int `json:"timeout"`
+}
+
+// LogLevelResponse answers set_log_level.
+type LogLevelResponse struct {
+	Level int `json:"level"`
+}
+
+// LockingDebugResponse answers set_locking_debug.
+type LockingDebugResponse struct {
+	LockingDebug bool `json:"locking_debug"`
+}
+
+// RefcountDebugResponse answers set_refcount_debug.
+type RefcountDebugResponse struct {
+	RefcountDebug bool `json:"refcount_debug"`
+}
+
+// AcceptNewSessionsResponse answers accept_new_sessions.
+type AcceptNewSessionsResponse struct {
+	Accept bool `json:"accept"`
+}
+
+// AdminResponse answers the Admin API requests about a session or handle
+// that only succeed or fail, detach_handle, destroy_session and
+// hangup_webrtc.
+type AdminResponse struct {
+	SessionID uint64 `json:"session_id"`
+	HandleID  uint64 `json:"handle_id"`
+}
+
+// TokenResponse answers add_token, allow_token and disallow_token with the
+// plugins the token gives access to, and remove_token.
+type TokenResponse struct {
+	Token   string   `json:"-"`
+	Plugins []string `json:"plugins"`
+}
+
+type tokenResponse struct {
+	Data *TokenResponse `json:"data"`
+}
+
+// StoredToken is a token of list_tokens and the plugins it gives access to.
+type StoredToken struct {
+	Token          string   `json:"token"`
+	AllowedPlugins []string `json:"allowed_plugins"`
+}
+
+type tokensResponse struct {
+	Data struct {
+		Tokens []StoredToken `json:"tokens"`
+	} `json:"data"`
+}
+
+// PluginResponse is what a plugin answered to message_plugin, or an event
+// handler to query_eventhandler.
+type PluginResponse struct {
+	Response map[string]interface{} `json:"response"`
+}
+
+// Decode decodes the response into v, with the field names of the plugin as
+// mapstructure tags, like the videoroom response types.
+func (response *PluginResponse) Decode(v interface{}) error {
+	return mapstructure.Decode(response.Response, v)
+}
+
+// decodeSuccess decodes the body of a success into v. Numbers are kept as
+// json.Number so ids survive a map[string]interface{}.
+func decodeSuccess(msg *SuccessMsg, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(msg.response))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
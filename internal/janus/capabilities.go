@@ -0,0 +1,131 @@
+package janus
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Requirements is what a run needs from the Janus it talks to.
+type Requirements struct {
+	// MinVersion is the oldest acceptable Janus, such as "1.1.0".
+	MinVersion string `json:"min_version"`
+
+	// Plugins and Transports are package names such as VideoRoomPluginName
+	// or "janus.transport.websockets".
+	Plugins    []string `json:"plugins"`
+	Transports []string `json:"transports"`
+
+	DataChannels bool `json:"data_channels"`
+	IPv6         bool `json:"ipv6"`
+	IceTCP       bool `json:"ice_tcp"`
+}
+
+// CapabilityError is returned when Janus lacks something the Requirements
+// ask for. Missing lists each shortcoming.
+type CapabilityError struct {
+	// Server is the name and version Janus reported.
+	Server string
+
+	Missing []string
+}
+
+func (err *CapabilityError) Error() string {
+	return fmt.Sprintf("%s does not meet the requirements : %s", err.Server, strings.Join(err.Missing, ", "))
+}
+
+// Check compares the info Janus reported with requirements and returns a
+// *CapabilityError listing what is missing, or nil.
+func (info *InfoMsg) Check(requirements Requirements) error {
+	missing := make([]string, 0)
+
+	if requirements.MinVersion != "" {
+		min, err := parseVersion(requirements.MinVersion)
+		if err != nil {
+			return err
+		}
+		if info.version() < min {
+			missing = append(missing, fmt.Sprintf("version %s or newer (has %s)", requirements.MinVersion, info.VersionString))
+		}
+	}
+
+	for _, plugin := range requirements.Plugins {
+		if _, ok := info.Plugins[plugin]; !ok {
+			missing = append(missing, "plugin "+plugin)
+		}
+	}
+	for _, transport := range requirements.Transports {
+		if _, ok := info.Transports[transport]; !ok {
+			missing = append(missing, "transport "+transport)
+		}
+	}
+
+	if requirements.DataChannels && !info.DataChannels {
+		missing = append(missing, "data channels")
+	}
+	if requirements.IPv6 && !info.IPv6 {
+		missing = append(missing, "IPv6")
+	}
+	if requirements.IceTCP && !info.IceTCP {
+		missing = append(missing, "ICE-TCP")
+	}
+
+	if len(missing) > 0 {
+		return &CapabilityError{Server: fmt.Sprintf("%s %s", info.Name, info.VersionString), Missing: missing}
+	}
+	return nil
+}
+
+// version is the version of Janus on the scale of parseVersion, from
+// version_string when it can be parsed, otherwise from Version. Janus packs
+// that as major*1000 + minor*100 + patch since 1.0, and as minor*10 + patch
+// before, so 0.10.7 is 107.
+func (info *InfoMsg) version() int {
+	if version, err := parseVersion(info.VersionString); err == nil {
+		return version
+	}
+	major, minor, patch := info.Version/1000, info.Version%1000/100, info.Version%100
+	if major == 0 {
+		minor, patch = info.Version/10, info.Version%10
+	}
+	return (major*1000+minor)*1000 + patch
+}
+
+// parseVersion turns "major.minor.patch" into a number that orders like the
+// version, with room for minor and patch numbers above 9.
+func parseVersion(version string) (int, error) {
+	parts := strings.SplitN(version, ".", 3)
+	number := 0
+	for i := 0; i < 3; i++ {
+		number *= 1000
+		if i >= len(parts) {
+			continue
+		}
+		part, err := strconv.Atoi(parts[i])
+		if err != nil || part < 0 || part > 999 {
+			return 0, fmt.Errorf("invalid janus version '%s'", version)
+		}
+		number += part
+	}
+	return number, nil
+}
+
+// CheckCapabilities asks Janus for its info and checks it against
+// requirements. The info is returned with the *CapabilityError too, so the
+// caller can report what it talked to.
+func (gateway *Gateway) CheckCapabilities(requirements Requirements) (*InfoMsg, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.CheckCapabilitiesCtx(ctx, requirements)
+}
+
+// CheckCapabilitiesCtx is like CheckCapabilities but gives up with a
+// *TimeoutError once ctx is done.
+func (gateway *Gateway) CheckCapabilitiesCtx(ctx context.Context, requirements Requirements) (*InfoMsg, error) {
+	info, err := gateway.InfoCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return info, info.Check(requirements)
+}
@@ -0,0 +1,92 @@
+package janus
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_InfoMsg_Check(t *testing.T) {
+	info := &InfoMsg{
+		Name:          "Janus WebRTC Server",
+		Version:       1103,
+		VersionString: "1.1.3",
+		DataChannels:  true,
+		Plugins:       map[string]PluginInfo{VideoRoomPluginName: {}},
+		Transports:    map[string]PluginInfo{"janus.transport.websockets": {}},
+	}
+
+	assert.NoError(t, info.Check(Requirements{
+		MinVersion:   "1.1.3",
+		Plugins:      []string{VideoRoomPluginName},
+		Transports:   []string{"janus.transport.websockets"},
+		DataChannels: true,
+	}))
+	assert.NoError(t, info.Check(Requirements{MinVersion: "1.0"}))
+
+	err := info.Check(Requirements{
+		MinVersion: "1.1.10",
+		Plugins:    []string{VideoRoomPluginName, "janus.plugin.streaming"},
+		IPv6:       true,
+		IceTCP:     true,
+	})
+	var capability *CapabilityError
+	assert.True(t, errors.As(err, &capability))
+	assert.Equal(t, []string{
+		"version 1.1.10 or newer (has 1.1.3)",
+		"plugin janus.plugin.streaming",
+		"IPv6",
+		"ICE-TCP",
+	}, capability.Missing)
+
+	// without a usable version_string the packed version is compared
+	info.VersionString = "1.1.3-dev"
+	assert.NoError(t, info.Check(Requirements{MinVersion: "1.1.3"}))
+	assert.Error(t, info.Check(Requirements{MinVersion: "1.2.0"}))
+
+	assert.Error(t, info.Check(Requirements{MinVersion: "one"}))
+}
+
+func Test_InfoMsg_Version(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		want    string
+	}{
+		{name: "1.x", version: 1103, want: "1.1.3"},
+		{name: "1.x patch above 9", version: 1112, want: "1.1.12"},
+		{name: "0.x", version: 95, want: "0.9.5"},
+		{name: "0.x minor above 9", version: 107, want: "0.10.7"},
+		{name: "0.x last", version: 150, want: "0.15.0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the packed version is only read without a usable version_string
+			info := &InfoMsg{Version: test.version, VersionString: test.want + "-dev"}
+			want, err := parseVersion(test.want)
+			assert.NoError(t, err)
+			assert.Equal(t, want, info.version())
+		})
+	}
+
+	info := &InfoMsg{Version: 107}
+	assert.NoError(t, info.Check(Requirements{MinVersion: "0.10.0"}))
+	assert.Error(t, info.Check(Requirements{MinVersion: "0.11.0"}))
+}
+
+func Test_CheckCapabilities(t *testing.T) {
+	server := newFakeJanus(t)
+	client, err := WsConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	info, err := client.CheckCapabilities(Requirements{Plugins: []string{VideoRoomPluginName}})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, info.VersionString)
+
+	info, err = client.CheckCapabilities(Requirements{MinVersion: "99.0.0"})
+	assert.NotNil(t, info)
+	assert.IsType(t, &CapabilityError{}, err)
+}
@@ -0,0 +1,113 @@
+package janus
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TimeoutError is returned by the ...Ctx request methods when the context is
+// cancelled or its deadline passes before the gateway answers the request.
+type TimeoutError struct {
+	// Request is the janus request type that was abandoned, e.g. "attach".
+	Request string
+
+	// Transaction is the transaction id the request was sent with.
+	Transaction string
+
+	// Err is the context error, context.DeadlineExceeded or context.Canceled.
+	Err error
+}
+
+func (err *TimeoutError) Error() string {
+	return fmt.Sprintf("no response to '%s' request (transaction %s) : %s", err.Request, err.Transaction, err.Err)
+}
+
+func (err *TimeoutError) Unwrap() error {
+	return err.Err
+}
+
+// Timeout reports true so TimeoutError satisfies the net.Error style check.
+func (err *TimeoutError) Timeout() bool {
+	return true
+}
+
+// IsTimeout reports whether err, or any error it wraps, is a *TimeoutError.
+func IsTimeout(err error) bool {
+	var timeout *TimeoutError
+	return errors.As(err, &timeout)
+}
+
+// Janus core error codes of a rejected request. Janus has no authorization
+// errors in the 490s, 490 is JANUS_ERROR_UNKNOWN, so a missing or wrong
+// apisecret or token is only ever reported as 403 or 405. A room secret or
+// pin is checked by the videoroom plugin, which answers 433, see
+// VideoRoomErrorCode.
+const (
+	errorUnauthorized       = 403
+	errorUnauthorizedPlugin = 405
+	errorHandleNotFound     = 459
+)
+
+// UnauthorizedError is returned for a request Janus rejected because it
+// carried a wrong or missing apisecret or token, or a token that does not
+// give access to the plugin.
+type UnauthorizedError struct {
+	// Request is the janus request type that was rejected, e.g. "create".
+	Request string
+
+	// Code is the Janus error code, 403 or 405.
+	Code int
+
+	// Reason is the error text Janus sent.
+	Reason string
+}
+
+func (err *UnauthorizedError) Error() string {
+	return fmt.Sprintf("'%s' request unauthorized (%d) : %s", err.Request, err.Code, err.Reason)
+}
+
+// IsUnauthorized reports whether err, or any error it wraps, is an
+// *UnauthorizedError.
+func IsUnauthorized(err error) bool {
+	var unauthorized *UnauthorizedError
+	return errors.As(err, &unauthorized)
+}
+
+// IsNotFound reports whether err is Janus saying the session or handle a
+// request was about does not exist (anymore).
+func IsNotFound(err error) bool {
+	var msg *ErrorMsg
+	if !errors.As(err, &msg) {
+		return false
+	}
+	return msg.Err.Code == errorSessionNotFound || msg.Err.Code == errorHandleNotFound
+}
+
+// ErrSessionExpired is the cause of a *SessionError for a session Janus timed
+// out, because it was not kept alive.
+var ErrSessionExpired = errors.New("session expired")
+
+// ErrSessionDestroyed is the cause of a *SessionError for a session that was
+// destroyed.
+var ErrSessionDestroyed = errors.New("session destroyed")
+
+// SessionError is returned for a request that failed because its session is
+// gone, whether the request was pending at the time or sent afterwards.
+type SessionError struct {
+	// Session is the session_id of the session.
+	Session uint64
+
+	// Request is the janus request type that failed, e.g. "message".
+	Request string
+
+	// Err is ErrSessionExpired or ErrSessionDestroyed.
+	Err error
+}
+
+func (err *SessionError) Error() string {
+	return fmt.Sprintf("'%s' request on session %d : %s", err.Request, err.Session, err.Err)
+}
+
+func (err *SessionError) Unwrap() error {
+	return err.Err
+}
@@ -0,0 +1,207 @@
+package janus
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	// handleQueueSize is how many events a handle queues for its
+	// subscribers before further ones overflow and are dropped.
+	handleQueueSize = 64
+
+	// handleEventsChanSize is the capacity of Handle.Events.
+	handleEventsChanSize = 8
+)
+
+// EventStats counts what happened to the asynchronous events of a handle.
+// Overflows are events lost because the handle's queue was full, its
+// subscribers, or the reader of Handle.Events, being too slow.
+type EventStats struct {
+	Delivered uint64 `json:"delivered"`
+	Overflows uint64 `json:"overflows"`
+}
+
+// handleEvents delivers the events of a handle, in the order the gateway
+// received them, on a goroutine of its own.
+type handleEvents struct {
+	queue chan interface{}
+	done  chan struct{}
+
+	subscriptions map[string][]*subscription
+	nextID        uint64
+
+	delivered uint64
+	overflows uint64
+}
+
+type subscription struct {
+	id uint64
+	fn func(msg interface{})
+}
+
+func newHandleEvents() *handleEvents {
+	return &handleEvents{
+		queue:         make(chan interface{}, handleQueueSize),
+		done:          make(chan struct{}),
+		subscriptions: make(map[string][]*subscription),
+	}
+}
+
+// deliver queues msg for the handle without blocking the receive loop.
+func (handle *Handle) deliver(msg interface{}) {
+	select {
+	case handle.events.queue <- msg:
+	case <-handle.events.done:
+	default:
+		atomic.AddUint64(&handle.events.overflows, 1)
+		handle.Logger().Warn("handle event queue full, event dropped", F("event", messageType(msg)))
+	}
+}
+
+func (handle *Handle) dispatch() {
+	events := handle.events
+	for {
+		select {
+		case <-events.done:
+			return
+		case msg := <-events.queue:
+			handle.mu.Lock()
+			subscriptions := events.subscriptions[messageType(msg)]
+			handle.mu.Unlock()
+
+			// events nobody subscribed to wait for Handle.Events to be read,
+			// the queue holding the later ones meanwhile
+			if len(subscriptions) == 0 {
+				select {
+				case handle.Events <- msg:
+					atomic.AddUint64(&events.delivered, 1)
+				case <-events.done:
+					return
+				}
+				continue
+			}
+
+			for _, subscription := range subscriptions {
+				subscription.fn(msg)
+			}
+			atomic.AddUint64(&events.delivered, 1)
+		}
+	}
+}
+
+// close stops the delivery of events, the ones still queued are discarded.
+func (handle *Handle) close() {
+	handle.mu.Lock()
+	defer handle.mu.Unlock()
+
+	select {
+	case <-handle.events.done:
+	default:
+		close(handle.events.done)
+	}
+}
+
+// EventStats returns the event counters of the handle.
+func (handle *Handle) EventStats() EventStats {
+	return EventStats{
+		Delivered: atomic.LoadUint64(&handle.events.delivered),
+		Overflows: atomic.LoadUint64(&handle.events.overflows),
+	}
+}
+
+// subscribe registers fn for the events of a type and returns the function
+// that removes it again.
+func (handle *Handle) subscribe(janus string, fn func(msg interface{})) func() {
+	handle.mu.Lock()
+	defer handle.mu.Unlock()
+
+	events := handle.events
+	events.nextID++
+	id := events.nextID
+
+	// the dispatcher holds on to the slice it read, so it is never modified
+	// in place
+	subscriptions := make([]*subscription, 0, len(events.subscriptions[janus])+1)
+	subscriptions = append(subscriptions, events.subscriptions[janus]...)
+	events.subscriptions[janus] = append(subscriptions, &subscription{id: id, fn: fn})
+
+	return func() {
+		handle.mu.Lock()
+		defer handle.mu.Unlock()
+
+		remaining := make([]*subscription, 0, len(events.subscriptions[janus]))
+		for _, subscription := range events.subscriptions[janus] {
+			if subscription.id != id {
+				remaining = append(remaining, subscription)
+			}
+		}
+		events.subscriptions[janus] = remaining
+	}
+}
+
+// The On methods register a callback for one type of asynchronous event of
+// the handle, and return the function that unregisters it. Callbacks run one
+// at a time, in the order the events arrived, so a slow callback holds up the
+// events behind it. Events of a type nobody subscribed to go to Handle.Events.
+
+// OnVideoRoomEvent calls fn for every videoroom notification, such as a
+// publisher joining or leaving the room.
+func (handle *Handle) OnVideoRoomEvent(fn func(event *VideoRoomEvent)) func() {
+	return handle.subscribe("event", func(msg interface{}) {
+		event, err := decodeVideoRoomEvent(msg.(*EventMsg))
+		if err != nil {
+			handle.Logger().Warn("parse videoroom event error", F("error", err))
+			return
+		}
+		fn(event)
+	})
+}
+
+// OnWebRTCUp calls fn once the PeerConnection of the handle is up.
+func (handle *Handle) OnWebRTCUp(fn func(msg *WebRTCUpMsg)) func() {
+	return handle.subscribe("webrtcup", func(msg interface{}) { fn(msg.(*WebRTCUpMsg)) })
+}
+
+// OnHangup calls fn when the PeerConnection of the handle is closed.
+func (handle *Handle) OnHangup(fn func(msg *HangupMsg)) func() {
+	return handle.subscribe("hangup", func(msg interface{}) { fn(msg.(*HangupMsg)) })
+}
+
+// OnSlowLink calls fn when Janus reports lost packets on the PeerConnection.
+func (handle *Handle) OnSlowLink(fn func(msg *SlowLinkMsg)) func() {
+	return handle.subscribe("slowlink", func(msg interface{}) { fn(msg.(*SlowLinkMsg)) })
+}
+
+// OnMedia calls fn when Janus starts or stops receiving a kind of media.
+func (handle *Handle) OnMedia(fn func(msg *MediaMsg)) func() {
+	return handle.subscribe("media", func(msg interface{}) { fn(msg.(*MediaMsg)) })
+}
+
+func decodeVideoRoomEvent(msg *EventMsg) (*VideoRoomEvent, error) {
+	event := &VideoRoomEvent{Msg: msg}
+	if err := mapstructure.Decode(msg.Plugindata.Data, event); err != nil {
+		return nil, err
+	}
+
+	// these are a feed id when about someone else, and "ok" when about us
+	event.Leaving = feedID(msg.Plugindata.Data["leaving"])
+	event.Unpublished = feedID(msg.Plugindata.Data["unpublished"])
+	return event, nil
+}
+
+func feedID(value interface{}) uint64 {
+	switch value := value.(type) {
+	case json.Number:
+		id, _ := strconv.ParseUint(value.String(), 10, 64)
+		return id
+	case float64:
+		return uint64(value)
+	case uint64:
+		return value
+	}
+	return 0
+}
@@ -0,0 +1,111 @@
+package janus
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Hwanse/janus-tester/internal/fakejanus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HandleEvents_Ordered(t *testing.T) {
+	server := newFakeJanus(t)
+	handle, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+
+	mu := sync.Mutex{}
+	lost := make([]int64, 0)
+	handle.OnSlowLink(func(msg *SlowLinkMsg) {
+		mu.Lock()
+		lost = append(lost, msg.Lost)
+		mu.Unlock()
+	})
+
+	for i := 0; i < 50; i++ {
+		server.Notify(handle.session.ID, handle.ID, map[string]interface{}{"janus": "slowlink", "uplink": true, "lost": i})
+	}
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(lost) == 50
+	}, time.Second, 10*time.Millisecond)
+	for i, value := range lost {
+		assert.Equal(t, int64(i), value)
+	}
+	assert.Equal(t, uint64(50), handle.EventStats().Delivered)
+}
+
+func Test_HandleEvents_WaitAndOverflow(t *testing.T) {
+	server := newFakeJanus(t)
+	handle, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+
+	// events beyond the capacity of Events wait until it is read
+	for i := 0; i < handleEventsChanSize+4; i++ {
+		server.Notify(handle.session.ID, handle.ID, map[string]interface{}{"janus": "webrtcup"})
+	}
+	assert.Eventually(t, func() bool {
+		return len(handle.Events) == handleEventsChanSize
+	}, time.Second, 10*time.Millisecond)
+	for i := 0; i < handleEventsChanSize+4; i++ {
+		select {
+		case msg := <-handle.Events:
+			assert.IsType(t, &WebRTCUpMsg{}, msg)
+		case <-time.After(time.Second):
+			t.Fatalf("event %d was lost", i)
+		}
+	}
+	assert.Equal(t, EventStats{Delivered: handleEventsChanSize + 4}, handle.EventStats())
+
+	// a stuck subscriber makes the queue overflow
+	release := make(chan struct{})
+	handle.OnMedia(func(msg *MediaMsg) { <-release })
+	for i := 0; i < handleQueueSize+5; i++ {
+		server.Notify(handle.session.ID, handle.ID, map[string]interface{}{"janus": "media", "type": "audio", "receiving": true})
+	}
+	assert.Eventually(t, func() bool {
+		return handle.EventStats().Overflows > 0
+	}, time.Second, 10*time.Millisecond)
+	close(release)
+}
+
+func Test_OnVideoRoomEvent(t *testing.T) {
+	server := newFakeJanus(t)
+	watcher, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+	publisher, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+
+	events := make(chan *VideoRoomEvent, 4)
+	watcher.OnVideoRoomEvent(func(event *VideoRoomEvent) { events <- event })
+
+	join := &JoinPublisherRequest{Request: TypeJoin, RoomID: fakejanus.DefaultRoom, PeerType: TypePublisher}
+	_, err = watcher.JoinPublisher(join)
+	assert.NoError(t, err)
+	joined, err := publisher.JoinPublisher(join)
+	assert.NoError(t, err)
+
+	pc, offer := newTestPeer(t, true)
+	defer pc.Close()
+	_, err = publisher.Publish(&PublishRequest{Request: TypePublish}, offer)
+	assert.NoError(t, err)
+
+	select {
+	case event := <-events:
+		assert.Equal(t, fakejanus.DefaultRoom, event.RoomID)
+		assert.Len(t, event.Publishers, 1)
+		assert.Equal(t, joined.FeedID, event.Publishers[0].FeedID)
+	case <-time.After(time.Second):
+		t.Fatal("publishers event not delivered")
+	}
+
+	assert.NoError(t, publisher.LeavePublisher(&LeaveRequest{Request: TypeLeave}))
+	select {
+	case event := <-events:
+		assert.Equal(t, joined.FeedID, event.Leaving)
+	case <-time.After(time.Second):
+		t.Fatal("leaving event not delivered")
+	}
+}
@@ -1,37 +1,113 @@
 package janus
 
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/xid"
+)
+
 // Handle represents a handle to a plugin instance on the Gateway.
 type Handle struct {
 	// ID is the handle_id of this plugin handle
 	ID uint64
 
-	// Type   // pub  or sub
+	// Type is the videoroom role the handle joined as, TypePublisher or
+	// TypeSubscriber, and empty while it is in no room. Read it with Joined.
 	Type string
 
 	//User   // Userid
 	User string
 
 	// Events is a receive only channel that can be used to receive events
-	// related to this handle from the gateway.
+	// related to this handle from the gateway. It gets the events of the
+	// types no callback is registered for, see OnVideoRoomEvent.
 	Events chan interface{}
 
 	session *Session
+
+	// mu guards Type and the subscriptions of events
+	mu     sync.Mutex
+	events *handleEvents
 }
 
-func (handle *Handle) send(msg map[string]interface{}, transaction chan interface{}) {
+func newHandle(session *Session, id uint64) *Handle {
+	handle := &Handle{
+		ID:      id,
+		Events:  make(chan interface{}, handleEventsChanSize),
+		session: session,
+		events:  newHandleEvents(),
+	}
+	go handle.dispatch()
+	return handle
+}
+
+// Joined returns the videoroom role the handle joined a room as, or "" while
+// it is in none.
+func (handle *Handle) Joined() string {
+	return handle.joined()
+}
+
+func (handle *Handle) joined() string {
+	handle.mu.Lock()
+	defer handle.mu.Unlock()
+	return handle.Type
+}
+
+func (handle *Handle) setJoined(peerType string) {
+	handle.mu.Lock()
+	handle.Type = peerType
+	handle.mu.Unlock()
+}
+
+// SessionID returns the session_id of the session the handle belongs to, as
+// the Admin API wants it along with the handle_id.
+func (handle *Handle) SessionID() uint64 {
+	return handle.session.ID
+}
+
+// Logger returns the logger of the Gateway with the session and handle ids
+// attached.
+func (handle *Handle) Logger() Logger {
+	return handle.session.Logger().With(F("handle", handle.ID))
+}
+
+func (handle *Handle) send(msg map[string]interface{}, transaction chan interface{}) (xid.ID, error) {
 	msg["handle_id"] = handle.ID
-	handle.session.send(msg, transaction)
+	return handle.session.send(msg, transaction)
+}
+
+func (handle *Handle) wait(ctx context.Context, request string, id xid.ID, transaction chan interface{}) (interface{}, error) {
+	return handle.session.gateway.wait(ctx, request, id, transaction)
+}
+
+func (handle *Handle) requestContext() (context.Context, context.CancelFunc) {
+	return handle.session.gateway.requestContext()
 }
 
 // Request sends a sync request
 func (handle *Handle) Request(body interface{}) (*SuccessMsg, error) {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.RequestCtx(ctx, body)
+}
+
+// RequestCtx is like Request but gives up with a *TimeoutError once ctx is
+// done.
+func (handle *Handle) RequestCtx(ctx context.Context, body interface{}) (*SuccessMsg, error) {
 	req, ch := newRequest("message")
 	if body != nil {
 		req["body"] = body
 	}
-	handle.send(req, ch)
+	id, err := handle.send(req, ch)
+	if err != nil {
+		return nil, err
+	}
 
-	msg := <-ch
+	msg, err := handle.wait(ctx, "message", id, ch)
+	if err != nil {
+		return nil, err
+	}
 
 	switch msg := msg.(type) {
 	case *SuccessMsg:
@@ -48,6 +124,14 @@ func (handle *Handle) Request(body interface{}) (*SuccessMsg, error) {
 // contain an optional SDP offer/answer to establish a WebRTC PeerConnection.
 // On success, an EventMsg will be returned and error will be nil.
 func (handle *Handle) Message(body, jsep interface{}) (*EventMsg, error) {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.MessageCtx(ctx, body, jsep)
+}
+
+// MessageCtx is like Message but gives up with a *TimeoutError once ctx is
+// done, whether it is still waiting for the ack or for the plugin event.
+func (handle *Handle) MessageCtx(ctx context.Context, body, jsep interface{}) (*EventMsg, error) {
 	req, ch := newRequest("message")
 	if body != nil {
 		req["body"] = body
@@ -55,10 +139,16 @@ func (handle *Handle) Message(body, jsep interface{}) (*EventMsg, error) {
 	if jsep != nil {
 		req["jsep"] = jsep
 	}
-	handle.send(req, ch)
+	id, err := handle.send(req, ch)
+	if err != nil {
+		return nil, err
+	}
 
 GetMessage: // No tears..
-	msg := <-ch
+	msg, err := handle.wait(ctx, "message", id, ch)
+	if err != nil {
+		return nil, err
+	}
 	switch msg := msg.(type) {
 	case *AckMsg:
 		goto GetMessage // ..only dreams.
@@ -80,19 +170,17 @@ GetMessage: // No tears..
 //		}
 // On success, an AckMsg will be returned and error will be nil.
 func (handle *Handle) Trickle(candidate interface{}) (*AckMsg, error) {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.TrickleCtx(ctx, candidate)
+}
+
+// TrickleCtx is like Trickle but gives up with a *TimeoutError once ctx is
+// done.
+func (handle *Handle) TrickleCtx(ctx context.Context, candidate interface{}) (*AckMsg, error) {
 	req, ch := newRequest("trickle")
 	req["candidate"] = candidate
-	handle.send(req, ch)
-
-	msg := <-ch
-	switch msg := msg.(type) {
-	case *AckMsg:
-		return msg, nil
-	case *ErrorMsg:
-		return nil, msg
-	}
-
-	return nil, unexpected("trickle")
+	return handle.trickle(ctx, req, ch)
 }
 
 // TrickleMany sends a trickle request to the Gateway as part of establishing
@@ -100,11 +188,29 @@ func (handle *Handle) Trickle(candidate interface{}) (*AckMsg, error) {
 // candidates should be an array of ICE candidates.
 // On success, an AckMsg will be returned and error will be nil.
 func (handle *Handle) TrickleMany(candidates interface{}) (*AckMsg, error) {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.TrickleManyCtx(ctx, candidates)
+}
+
+// TrickleManyCtx is like TrickleMany but gives up with a *TimeoutError once
+// ctx is done.
+func (handle *Handle) TrickleManyCtx(ctx context.Context, candidates interface{}) (*AckMsg, error) {
 	req, ch := newRequest("trickle")
 	req["candidates"] = candidates
-	handle.send(req, ch)
+	return handle.trickle(ctx, req, ch)
+}
+
+func (handle *Handle) trickle(ctx context.Context, req map[string]interface{}, ch chan interface{}) (*AckMsg, error) {
+	id, err := handle.send(req, ch)
+	if err != nil {
+		return nil, err
+	}
 
-	msg := <-ch
+	msg, err := handle.wait(ctx, "trickle", id, ch)
+	if err != nil {
+		return nil, err
+	}
 	switch msg := msg.(type) {
 	case *AckMsg:
 		return msg, nil
@@ -118,22 +224,42 @@ func (handle *Handle) TrickleMany(candidates interface{}) (*AckMsg, error) {
 // Detach sends a detach request to the Gateway to remove this handle.
 // On success, an AckMsg will be returned and error will be nil.
 func (handle *Handle) Detach() (*AckMsg, error) {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.DetachCtx(ctx)
+}
+
+// DetachCtx is like Detach but gives up with a *TimeoutError once ctx is
+// done. The handle stays in Session.Handles when the request times out.
+func (handle *Handle) DetachCtx(ctx context.Context) (*AckMsg, error) {
 	req, ch := newRequest("detach")
-	handle.send(req, ch)
+	id, err := handle.send(req, ch)
+	if err != nil {
+		return nil, err
+	}
 
 	var ack *AckMsg
-	msg := <-ch
+	msg, err := handle.wait(ctx, "detach", id, ch)
+	if err != nil {
+		return nil, err
+	}
 	switch msg := msg.(type) {
 	case *AckMsg:
 		ack = msg
+	case *SuccessMsg:
+		// Janus answers detach with success, only some older gateways ack it
+		ack = &AckMsg{}
 	case *ErrorMsg:
 		return nil, msg
+	default:
+		return nil, unexpected("detach")
 	}
 
 	// Remove this handle from the session
 	handle.session.Lock()
 	delete(handle.session.Handles, handle.ID)
 	handle.session.Unlock()
+	handle.close()
 
 	return ack, nil
 }
@@ -0,0 +1,151 @@
+package janus
+
+import (
+	"github.com/mitchellh/mapstructure"
+)
+
+// HandleStats is what Janus thinks of the PeerConnection of a handle, taken
+// from its handle_info. Counters add up every medium of the handle and are
+// totals since the PeerConnection was set up.
+type HandleStats struct {
+	ICEState     string `json:"ice_state"`
+	DTLSState    string `json:"dtls_state"`
+	SelectedPair string `json:"selected_pair,omitempty"`
+
+	// In is what Janus received from us, Out what it sent to us.
+	BytesIn    uint64 `json:"bytes_in"`
+	BytesOut   uint64 `json:"bytes_out"`
+	PacketsIn  uint64 `json:"packets_in"`
+	PacketsOut uint64 `json:"packets_out"`
+	NacksIn    uint64 `json:"nacks_in"`
+	NacksOut   uint64 `json:"nacks_out"`
+
+	// Lost is what Janus lost of what we sent, LostByRemote what we
+	// reported lost of what it sent.
+	Lost         int64 `json:"lost"`
+	LostByRemote int64 `json:"lost_by_remote"`
+
+	// RTT is the highest round trip time of the media, in milliseconds.
+	RTT uint32 `json:"rtt_ms"`
+}
+
+// webrtcInfo is the webrtc part of a Janus 1.x handle_info, where media is an
+// object keyed by m-line index.
+type webrtcInfo struct {
+	ICE   iceInfo              `mapstructure:"ice"`
+	DTLS  dtlsInfo             `mapstructure:"dtls"`
+	Media map[string]mediaInfo `mapstructure:"media"`
+}
+
+type iceInfo struct {
+	State        string `mapstructure:"state"`
+	SelectedPair string `mapstructure:"selected-pair"`
+}
+
+type dtlsInfo struct {
+	State string `mapstructure:"dtls-state"`
+}
+
+type mediaInfo struct {
+	InStats  mediaCounters       `mapstructure:"in_stats"`
+	OutStats mediaCounters       `mapstructure:"out_stats"`
+	RTCP     map[string]rtcpInfo `mapstructure:"rtcp_stats"`
+}
+
+type mediaCounters struct {
+	Packets uint64 `mapstructure:"packets"`
+	Bytes   uint64 `mapstructure:"bytes"`
+	Nacks   uint64 `mapstructure:"nacks"`
+}
+
+type rtcpInfo struct {
+	RTT          uint32 `mapstructure:"rtt"`
+	Lost         int64  `mapstructure:"lost"`
+	LostByRemote int64  `mapstructure:"lost-by-remote"`
+}
+
+// streamInfo is a stream of a Janus 0.x handle_info, where the counters are
+// kept per component and split by media type.
+type streamInfo struct {
+	RTCP       map[string]rtcpInfo `mapstructure:"rtcp_stats"`
+	Components []componentInfo     `mapstructure:"components"`
+}
+
+type componentInfo struct {
+	State        string         `mapstructure:"state"`
+	SelectedPair string         `mapstructure:"selected-pair"`
+	DTLS         dtlsInfo       `mapstructure:"dtls"`
+	InStats      legacyCounters `mapstructure:"in_stats"`
+	OutStats     legacyCounters `mapstructure:"out_stats"`
+}
+
+type legacyCounters struct {
+	AudioPackets uint64 `mapstructure:"audio_packets"`
+	AudioBytes   uint64 `mapstructure:"audio_bytes"`
+	AudioNacks   uint64 `mapstructure:"audio_nacks"`
+	VideoPackets uint64 `mapstructure:"video_packets"`
+	VideoBytes   uint64 `mapstructure:"video_bytes"`
+	VideoNacks   uint64 `mapstructure:"video_nacks"`
+	DataPackets  uint64 `mapstructure:"data_packets"`
+	DataBytes    uint64 `mapstructure:"data_bytes"`
+}
+
+// Stats extracts the WebRTC state and counters of the handle, from the
+// layout of Janus 1.x or, failing that, of Janus 0.x. A handle without a
+// PeerConnection has empty stats.
+func (info *HandleInfo) Stats() (*HandleStats, error) {
+	stats := &HandleStats{}
+
+	if info.WebRTC != nil {
+		webrtc := webrtcInfo{}
+		if err := mapstructure.WeakDecode(info.WebRTC, &webrtc); err != nil {
+			return nil, wrapRequestError("handle_info webrtc", err)
+		}
+		stats.ICEState = webrtc.ICE.State
+		stats.SelectedPair = webrtc.ICE.SelectedPair
+		stats.DTLSState = webrtc.DTLS.State
+		for _, media := range webrtc.Media {
+			stats.PacketsIn += media.InStats.Packets
+			stats.BytesIn += media.InStats.Bytes
+			stats.NacksIn += media.InStats.Nacks
+			stats.PacketsOut += media.OutStats.Packets
+			stats.BytesOut += media.OutStats.Bytes
+			stats.NacksOut += media.OutStats.Nacks
+			stats.addRTCP(media.RTCP)
+		}
+		return stats, nil
+	}
+
+	streams := make([]streamInfo, 0, len(info.Streams))
+	if err := mapstructure.WeakDecode(info.Streams, &streams); err != nil {
+		return nil, wrapRequestError("handle_info streams", err)
+	}
+	for _, stream := range streams {
+		stats.addRTCP(stream.RTCP)
+		for _, component := range stream.Components {
+			if stats.ICEState == "" {
+				stats.ICEState = component.State
+				stats.SelectedPair = component.SelectedPair
+				stats.DTLSState = component.DTLS.State
+			}
+			in, out := component.InStats, component.OutStats
+			stats.PacketsIn += in.AudioPackets + in.VideoPackets + in.DataPackets
+			stats.BytesIn += in.AudioBytes + in.VideoBytes + in.DataBytes
+			stats.NacksIn += in.AudioNacks + in.VideoNacks
+			stats.PacketsOut += out.AudioPackets + out.VideoPackets + out.DataPackets
+			stats.BytesOut += out.AudioBytes + out.VideoBytes + out.DataBytes
+			stats.NacksOut += out.AudioNacks + out.VideoNacks
+		}
+	}
+	return stats, nil
+}
+
+func (stats *HandleStats) addRTCP(rtcp map[string]rtcpInfo) {
+	for _, media := range rtcp {
+		stats.Lost += media.Lost
+		stats.LostByRemote += media.LostByRemote
+		if media.RTT > stats.RTT {
+			stats.RTT = media.RTT
+		}
+	}
+}
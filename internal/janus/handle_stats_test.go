@@ -0,0 +1,108 @@
+package janus
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/Hwanse/janus-tester/internal/fakejanus"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeHandleInfo(t *testing.T, data string) *HandleInfo {
+	info := &HandleInfo{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(data)))
+	decoder.UseNumber()
+	assert.NoError(t, decoder.Decode(info))
+	return info
+}
+
+func Test_HandleInfo_Stats(t *testing.T) {
+	info := decodeHandleInfo(t, `{
+		"handle_id": 2,
+		"webrtc": {
+			"ice": {"state": "connected", "selected-pair": "10.0.0.1:5000 [host,udp] <-> 10.0.0.2:6000 [srflx,udp]"},
+			"dtls": {"dtls-state": "connected"},
+			"media": {
+				"0": {"mid": "0", "type": "audio", "in_stats": {"packets": 100, "bytes": 12000, "nacks": 1},
+				 "out_stats": {"packets": 50, "bytes": 6000, "nacks": 2},
+				 "rtcp_stats": {"main": {"rtt": 12, "lost": 3, "lost-by-remote": 4}}},
+				"1": {"mid": "1", "type": "video", "in_stats": {"packets": 200, "bytes": 240000, "nacks": 5},
+				 "out_stats": {"packets": 0, "bytes": 0, "nacks": 0},
+				 "rtcp_stats": {"main": {"rtt": 30, "lost": -1, "lost-by-remote": 0}}}
+			}
+		}
+	}`)
+
+	stats, err := info.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, &HandleStats{
+		ICEState:     "connected",
+		DTLSState:    "connected",
+		SelectedPair: "10.0.0.1:5000 [host,udp] <-> 10.0.0.2:6000 [srflx,udp]",
+		BytesIn:      252000,
+		BytesOut:     6000,
+		PacketsIn:    300,
+		PacketsOut:   50,
+		NacksIn:      6,
+		NacksOut:     2,
+		Lost:         2,
+		LostByRemote: 4,
+		RTT:          30,
+	}, stats)
+
+	// the layout of Janus 0.x
+	info = decodeHandleInfo(t, `{
+		"handle_id": 2,
+		"streams": [{
+			"rtcp_stats": {"audio": {"rtt": 7, "lost": 1, "lost-by-remote": 2}},
+			"components": [{
+				"state": "ready",
+				"selected-pair": "10.0.0.1:5000 [host,udp] <-> 10.0.0.2:6000 [host,udp]",
+				"dtls": {"dtls-state": "connected"},
+				"in_stats": {"audio_packets": 10, "audio_bytes": 1000, "audio_nacks": 1, "data_packets": 1, "data_bytes": 20},
+				"out_stats": {"video_packets": 5, "video_bytes": 5000, "video_nacks": 3}
+			}]
+		}]
+	}`)
+
+	stats, err = info.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, "ready", stats.ICEState)
+	assert.Equal(t, "connected", stats.DTLSState)
+	assert.Equal(t, uint64(1020), stats.BytesIn)
+	assert.Equal(t, uint64(11), stats.PacketsIn)
+	assert.Equal(t, uint64(5000), stats.BytesOut)
+	assert.Equal(t, uint64(3), stats.NacksOut)
+	assert.Equal(t, uint32(7), stats.RTT)
+
+	stats, err = decodeHandleInfo(t, `{"handle_id": 2}`).Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, &HandleStats{}, stats)
+}
+
+func Test_HandleInfo_Stats_Live(t *testing.T) {
+	server := newFakeJanus(t)
+	admin, err := WsAdminConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer admin.Close()
+
+	handle, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+	_, err = handle.JoinPublisher(&JoinPublisherRequest{Request: TypeJoin, RoomID: fakejanus.DefaultRoom, PeerType: TypePublisher})
+	assert.NoError(t, err)
+	pc, offer := newTestPeer(t, true)
+	defer pc.Close()
+	_, err = handle.Publish(&PublishRequest{Request: TypePublish}, offer)
+	assert.NoError(t, err)
+
+	info, err := admin.HandleInfo(handle.SessionID(), handle.ID, false)
+	assert.NoError(t, err)
+	stats, err := info.Stats()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, stats.ICEState)
+	assert.NotEmpty(t, stats.DTLSState)
+
+	_, err = admin.HandleInfo(handle.SessionID(), handle.ID+1, false)
+	assert.True(t, IsNotFound(err))
+}
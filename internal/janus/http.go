@@ -0,0 +1,262 @@
+package janus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	JanusHttpPort      = "8088"
+	JanusAdminHttpPort = "7088"
+
+	// httpRequestTimeout bounds a single POST. Janus answers those right away,
+	// plugin results arrive later as events through the long poll.
+	httpRequestTimeout = 30 * time.Second
+
+	// httpMaxEvents is how many queued events one long poll may return.
+	httpMaxEvents = 10
+
+	// httpPollRetry is how long a session poller backs off after a failure.
+	httpPollRetry = time.Second
+
+	// errorSessionNotFound is JANUS_ERROR_SESSION_NOT_FOUND.
+	errorSessionNotFound = 458
+)
+
+var errTransportClosed = errors.New("transport closed")
+
+// httpTransport speaks the Janus API over the REST interface. Requests are
+// POSTed to the /<session>/<handle> path they address and the synchronous
+// reply is queued for Read. Events are fetched with one long poll
+// (GET /<session>) per session the Gateway created. The first POST is
+// traced for HandshakeTiming, as it opens the connection.
+type httpTransport struct {
+	baseURL    string
+	header     http.Header
+	client     *http.Client
+	pollClient *http.Client
+	incoming   chan []byte
+	closed     chan struct{}
+	closeOnce  sync.Once
+
+	mu      sync.Mutex
+	pollers map[uint64]context.CancelFunc
+	traced  bool
+	timing  HandshakeTiming
+}
+
+// HttpConnect prepares a Gateway talking to the Janus HTTP transport, where
+// httpURL is the API root such as http://127.0.0.1:8088/janus. No request is
+// made until the first Gateway call.
+func HttpConnect(httpURL string) (*Gateway, error) {
+	return Connect(WithURL(httpURL))
+}
+
+// HttpAdminConnect is HttpConnect for the Admin API root, such as
+// http://127.0.0.1:7088/admin.
+func HttpAdminConnect(httpURL string) (*Gateway, error) {
+	return HttpConnect(httpURL)
+}
+
+func newHttpTransport(httpURL string) *httpTransport {
+	return &httpTransport{
+		baseURL:    strings.TrimRight(httpURL, "/"),
+		client:     &http.Client{Timeout: httpRequestTimeout},
+		pollClient: &http.Client{},
+		incoming:   make(chan []byte, 100),
+		closed:     make(chan struct{}),
+		pollers:    make(map[uint64]context.CancelFunc),
+	}
+}
+
+func (transport *httpTransport) Write(data []byte) error {
+	path := transport.baseURL
+	if session := gjson.GetBytes(data, "session_id").Uint(); session != 0 {
+		path += "/" + strconv.FormatUint(session, 10)
+		if handle := gjson.GetBytes(data, "handle_id").Uint(); handle != 0 {
+			path += "/" + strconv.FormatUint(handle, 10)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	transport.setHeader(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	transport.mu.Lock()
+	var trace *handshakeTrace
+	if !transport.traced {
+		transport.traced = true
+		trace = newHandshakeTrace()
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+	}
+	transport.mu.Unlock()
+
+	resp, err := transport.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if trace != nil {
+		transport.mu.Lock()
+		transport.timing = trace.timing()
+		transport.mu.Unlock()
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("janus http: %s", resp.Status)
+	}
+
+	transport.deliver(body)
+	return nil
+}
+
+// HandshakeTiming is the timing of the first POST, zero until it is answered.
+func (transport *httpTransport) HandshakeTiming() HandshakeTiming {
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	return transport.timing
+}
+
+func (transport *httpTransport) Read() ([]byte, error) {
+	select {
+	case data := <-transport.incoming:
+		return data, nil
+	case <-transport.closed:
+		return nil, errTransportClosed
+	}
+}
+
+func (transport *httpTransport) Close() error {
+	transport.closeOnce.Do(func() {
+		close(transport.closed)
+
+		transport.mu.Lock()
+		for id, cancel := range transport.pollers {
+			cancel()
+			delete(transport.pollers, id)
+		}
+		transport.mu.Unlock()
+	})
+	return nil
+}
+
+func (transport *httpTransport) WatchSession(id uint64, auth url.Values) {
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+
+	if _, ok := transport.pollers[id]; ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	transport.pollers[id] = cancel
+	go transport.poll(ctx, id, auth)
+}
+
+func (transport *httpTransport) UnwatchSession(id uint64) {
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+
+	if cancel, ok := transport.pollers[id]; ok {
+		cancel()
+		delete(transport.pollers, id)
+	}
+}
+
+// poll long-polls the events of a single session until it is unwatched, the
+// transport is closed or Janus reports the session as gone or the poll as
+// unauthorized. The apisecret and token go in the query, a GET has no body
+// to carry them. Any other error backs off like a failed request.
+func (transport *httpTransport) poll(ctx context.Context, id uint64, auth url.Values) {
+	query := url.Values{"maxev": {strconv.Itoa(httpMaxEvents)}}
+	for key, values := range auth {
+		query[key] = values
+	}
+	pollURL := fmt.Sprintf("%s/%d?%s", transport.baseURL, id, query.Encode())
+	for {
+		body, err := transport.get(ctx, pollURL)
+		if err == nil {
+			switch gjson.GetBytes(body, "error.code").Int() {
+			case 0:
+				transport.deliver(body)
+				continue
+			case errorSessionNotFound, errorUnauthorized:
+				// asking again does not change the answer
+				transport.UnwatchSession(id)
+				return
+			}
+		}
+
+		select {
+		case <-time.After(httpPollRetry):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (transport *httpTransport) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	transport.setHeader(req)
+
+	resp, err := transport.pollClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("janus http: %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (transport *httpTransport) setHeader(req *http.Request) {
+	for key, values := range transport.header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+}
+
+// deliver queues every message in body for Read. A long poll answers with an
+// array of events, or with a keepalive when nothing happened in the meantime.
+func (transport *httpTransport) deliver(body []byte) {
+	messages := []gjson.Result{gjson.ParseBytes(body)}
+	if messages[0].IsArray() {
+		messages = messages[0].Array()
+	}
+
+	for _, msg := range messages {
+		if msg.Get("janus").String() == "keepalive" {
+			continue
+		}
+
+		select {
+		case transport.incoming <- []byte(msg.Raw):
+		case <-transport.closed:
+			return
+		}
+	}
+}
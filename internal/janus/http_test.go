@@ -0,0 +1,250 @@
+package janus
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Hwanse/janus-tester/internal/fakejanus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HttpTransport(t *testing.T) {
+	server := newRestServer()
+	defer server.Close()
+
+	client, err := HttpConnect(server.URL + "/janus")
+	assert.NoError(t, err)
+	defer client.Close()
+
+	session, err := client.Create()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), session.ID)
+
+	handle, err := session.Attach(VideoRoomPluginName)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), handle.ID)
+
+	// the plugin result only arrives through the long poll
+	event, err := handle.Message(map[string]interface{}{"request": "configure"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", event.Plugindata.Data["configured"])
+
+	select {
+	case msg := <-handle.Events:
+		assert.IsType(t, &WebRTCUpMsg{}, msg)
+	case <-time.After(time.Second):
+		t.Fatal("event was not delivered to the handle")
+	}
+
+	_, err = session.Destroy()
+	assert.NoError(t, err)
+
+	// the event is queued before the ack of the message is sent
+	assert.Zero(t, client.TransactionStats().Orphans)
+}
+
+func Test_HttpTransport_Auth(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+		token   string
+	}{
+		{name: "apisecret", options: []Option{WithAPISecret("secret")}},
+		{name: "gateway token", options: []Option{WithToken("gateway")}},
+		{name: "session token", token: "participant"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFakeJanus(t)
+			server.APISecret = "secret"
+			server.TokenAuth = true
+			server.AddToken("gateway")
+			server.AddToken("participant")
+
+			client, err := Connect(append([]Option{WithURL(server.HttpURL())}, test.options...)...)
+			assert.NoError(t, err)
+			defer client.Close()
+
+			session, err := client.CreateWithToken(test.token)
+			assert.NoError(t, err)
+			handle, err := session.Attach(VideoRoomPluginName)
+			assert.NoError(t, err)
+
+			// the join result only arrives through the long poll, which
+			// Janus authorizes like any request
+			joined, err := handle.JoinPublisher(&JoinPublisherRequest{
+				Request:  TypeJoin,
+				RoomID:   fakejanus.DefaultRoom,
+				PeerType: TypePublisher,
+			})
+			assert.NoError(t, err)
+			assert.NotZero(t, joined.FeedID)
+		})
+	}
+}
+
+func Test_HttpTransport_PollError(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    int
+		watched bool
+	}{
+		{name: "session gone", code: errorSessionNotFound},
+		{name: "unauthorized", code: errorUnauthorized},
+		{name: "other error", code: 490, watched: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mu := sync.Mutex{}
+			polls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				polls++
+				mu.Unlock()
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"janus": "error",
+					"error": map[string]interface{}{"code": test.code, "reason": "refused"},
+				})
+			}))
+			defer server.Close()
+
+			transport := newHttpTransport(server.URL + "/janus")
+			defer transport.Close()
+			transport.WatchSession(1, nil)
+
+			// an error the poll cannot get past stops it, any other is
+			// retried after httpPollRetry instead of right away
+			time.Sleep(httpPollRetry / 2)
+			mu.Lock()
+			assert.Equal(t, 1, polls)
+			mu.Unlock()
+
+			transport.mu.Lock()
+			_, watched := transport.pollers[1]
+			transport.mu.Unlock()
+			assert.Equal(t, test.watched, watched)
+		})
+	}
+}
+
+// restServer is a minimal stand-in for the Janus HTTP transport. It answers
+// create/attach/destroy directly and queues the result of a message, plus an
+// unsolicited webrtcup, for the session's long poll.
+type restServer struct {
+	*httptest.Server
+
+	// session and handle are the ids handed out by create and attach.
+	session uint64
+	handle  uint64
+
+	mu       sync.Mutex
+	events   []map[string]interface{}
+	received []map[string]interface{}
+	queued   chan struct{}
+}
+
+func newRestServer() *restServer {
+	return newRestServerWithIDs(1, 2)
+}
+
+func newRestServerWithIDs(session, handle uint64) *restServer {
+	server := &restServer{session: session, handle: handle, queued: make(chan struct{}, 1)}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+	return server
+}
+
+func (server *restServer) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		server.poll(w)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	req := map[string]interface{}{}
+	json.Unmarshal(body, &req)
+
+	server.mu.Lock()
+	server.received = append(server.received, req)
+	server.mu.Unlock()
+
+	reply := map[string]interface{}{"transaction": req["transaction"]}
+	switch req["janus"] {
+	case "create":
+		reply["janus"] = "success"
+		reply["data"] = map[string]interface{}{"id": server.session}
+	case "attach":
+		reply["janus"] = "success"
+		reply["data"] = map[string]interface{}{"id": server.handle}
+	case "message":
+		reply["janus"] = "ack"
+		server.queue(map[string]interface{}{
+			"janus":       "event",
+			"session_id":  server.session,
+			"sender":      server.handle,
+			"transaction": req["transaction"],
+			"plugindata": map[string]interface{}{
+				"plugin": VideoRoomPluginName,
+				"data":   map[string]interface{}{"videoroom": "event", "configured": "ok"},
+			},
+		}, map[string]interface{}{"janus": "webrtcup", "session_id": server.session, "sender": server.handle})
+	default:
+		reply["janus"] = "ack"
+	}
+
+	json.NewEncoder(w).Encode(reply)
+}
+
+func (server *restServer) queue(events ...map[string]interface{}) {
+	server.mu.Lock()
+	server.events = append(server.events, events...)
+	server.mu.Unlock()
+
+	select {
+	case server.queued <- struct{}{}:
+	default:
+	}
+}
+
+func (server *restServer) poll(w http.ResponseWriter) {
+	select {
+	case <-server.queued:
+	case <-time.After(200 * time.Millisecond):
+		json.NewEncoder(w).Encode(map[string]interface{}{"janus": "keepalive"})
+		return
+	}
+
+	server.mu.Lock()
+	events := server.events
+	server.events = nil
+	server.mu.Unlock()
+
+	json.NewEncoder(w).Encode(events)
+}
+
+func Test_HttpTransport_HandshakeTiming(t *testing.T) {
+	server := &restServer{session: 1, handle: 2, queued: make(chan struct{}, 1)}
+	server.Server = httptest.NewTLSServer(http.HandlerFunc(server.serve))
+	defer server.Close()
+
+	config := server.Client().Transport.(*http.Transport).TLSClientConfig
+	client, err := Connect(WithURL(server.URL+"/janus"), WithTLSConfig(config))
+	assert.NoError(t, err)
+	defer client.Close()
+
+	// nothing is dialed before the first request
+	assert.Zero(t, client.HandshakeTiming())
+
+	_, err = client.Create()
+	assert.NoError(t, err)
+	timing := client.HandshakeTiming()
+	assert.Greater(t, int64(timing.TLS), int64(0))
+	assert.Greater(t, int64(timing.Upgrade), int64(0))
+	assert.GreaterOrEqual(t, int64(timing.Total), int64(timing.Connect+timing.TLS+timing.Upgrade))
+}
@@ -3,16 +3,14 @@
 package janus
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
-	"os"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/rs/xid"
 )
 
@@ -20,17 +18,21 @@ func unexpected(request string) error {
 	return fmt.Errorf("unexpected response received to '%s' request", request)
 }
 
+// transactionBuffer is sized so that an ack followed by an event can always be
+// handed over, even if the requester already gave up waiting.
+const transactionBuffer = 2
+
 func newRequest(method string) (map[string]interface{}, chan interface{}) {
 	req := make(map[string]interface{}, 8)
 	req["janus"] = method
-	return req, make(chan interface{})
+	return req, make(chan interface{}, transactionBuffer)
 }
 
-func newAdminRequest(method string) (map[string]interface{}, chan interface{}) {
+func (gateway *Gateway) newAdminRequest(method string) (map[string]interface{}, chan interface{}) {
 	req := make(map[string]interface{}, 8)
 	req["janus"] = method
-	req["admin_secret"] = AdminSecret
-	return req, make(chan interface{})
+	req["admin_secret"] = gateway.adminSecret
+	return req, make(chan interface{}, transactionBuffer)
 }
 
 // Gateway represents a connection to an instance of the Janus Gateway.
@@ -42,15 +44,27 @@ type Gateway struct {
 	// and Gateway.Unlock() methods provided by the embeded sync.Mutex.
 	sync.Mutex
 
-	conn             *websocket.Conn
-	transactions     map[xid.ID]chan interface{}
-	transactionsUsed map[xid.ID]bool
-	errors           chan error
-	sendChan         chan []byte
-	writeMu          sync.Mutex
-	debug            bool
+	transport      Transport
+	transactions   *transactionTable
+	errors         chan error
+	sendChan       chan []byte
+	requestTimeout time.Duration
+	logger         Logger
+	trace          TraceSink
+	adminSecret    string
+	apiSecret      string
+	token          string
+
+	dial            func() (Transport, error)
+	reconnectPolicy *ReconnectPolicy
+	reconnecting    bool
+	reconnectEvents chan ReconnectEvent
+	closing         bool
+	done            chan struct{}
 }
 
+// The defaults of GatewayOptions, for a Janus running on this machine with
+// its sample configuration.
 const (
 	WebsocketSubProtocol      = "janus-protocol"
 	WebsocketAdminSubProtocol = "janus-admin-protocol"
@@ -67,30 +81,134 @@ func generateTransactionId() xid.ID {
 
 // WsConnect initiates a websocket connection with the Janus Gateway
 func WsConnect(wsURL string) (*Gateway, error) {
-	websocket.DefaultDialer.Subprotocols = []string{WebsocketSubProtocol}
+	return Connect(WithURL(wsURL), WithSubprotocol(WebsocketSubProtocol))
+}
 
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+// DialGateway connects with dial and starts a Gateway on the result. Unlike
+// NewGateway, the Gateway keeps dial so it can reconnect, see EnableReconnect.
+func DialGateway(dial func() (Transport, error)) (*Gateway, error) {
+	transport, err := dial()
 	if err != nil {
 		return nil, err
 	}
 
+	gateway := NewGateway(transport)
+	gateway.dial = dial
+	return gateway, nil
+}
+
+// NewGateway starts a Gateway on top of an already connected transport.
+// Session, Handle and the plugin helpers behave the same whatever carries
+// the messages.
+func NewGateway(transport Transport) *Gateway {
 	gateway := new(Gateway)
-	gateway.conn = conn
-	gateway.transactions = make(map[xid.ID]chan interface{})
-	gateway.transactionsUsed = make(map[xid.ID]bool)
+	gateway.transport = transport
+	gateway.transactions = newTransactionTable(DefaultTransactionTTL)
 	gateway.Sessions = make(map[uint64]*Session)
 	gateway.sendChan = make(chan []byte, 100)
 	gateway.errors = make(chan error)
-	gateway.debug = true
+	gateway.reconnectEvents = make(chan ReconnectEvent, reconnectEventBuffer)
+	gateway.done = make(chan struct{})
+	gateway.logger = DefaultLogger
+	gateway.adminSecret = AdminSecret
 
-	go gateway.ping()
+	if _, ok := transport.(pinger); ok {
+		go gateway.ping()
+	}
 	go gateway.recv()
-	return gateway, nil
+	go gateway.expireTransactions()
+	return gateway
 }
 
-// Close closes the underlying connection to the Gateway.
+// Close closes the underlying connection to the Gateway and stops its
+// goroutines, leaving the sessions and handles on the server until Janus
+// times them out. See Shutdown to remove them first. A closed Gateway never
+// reconnects.
 func (gateway *Gateway) Close() error {
-	return gateway.conn.Close()
+	gateway.Lock()
+	if !gateway.closing {
+		close(gateway.done)
+	}
+	gateway.closing = true
+	transport := gateway.transport
+	sessions := make([]*Session, 0, len(gateway.Sessions))
+	for _, session := range gateway.Sessions {
+		sessions = append(sessions, session)
+	}
+	gateway.Unlock()
+
+	for _, session := range sessions {
+		session.closeHandles()
+	}
+
+	return transport.Close()
+}
+
+// HandshakeTiming returns how long opening the current connection took. Over
+// HTTP it is the timing of the first request, zero until that is answered,
+// and it is always zero over a Unix socket.
+func (gateway *Gateway) HandshakeTiming() HandshakeTiming {
+	if timer, ok := gateway.currentTransport().(handshakeTimer); ok {
+		return timer.HandshakeTiming()
+	}
+	return HandshakeTiming{}
+}
+
+func (gateway *Gateway) isClosing() bool {
+	gateway.Lock()
+	defer gateway.Unlock()
+	return gateway.closing
+}
+
+func (gateway *Gateway) currentTransport() Transport {
+	gateway.Lock()
+	defer gateway.Unlock()
+	return gateway.transport
+}
+
+// SetLogger replaces the logger of the Gateway and of its sessions and
+// handles.
+func (gateway *Gateway) SetLogger(logger Logger) {
+	gateway.Lock()
+	gateway.logger = logger
+	gateway.Unlock()
+}
+
+// Logger returns the logger of the Gateway.
+func (gateway *Gateway) Logger() Logger {
+	gateway.Lock()
+	defer gateway.Unlock()
+	return gateway.logger
+}
+
+// SetTraceSink makes the Gateway hand every frame it sends and receives to
+// sink. A nil sink turns tracing off.
+func (gateway *Gateway) SetTraceSink(sink TraceSink) {
+	gateway.Lock()
+	gateway.trace = sink
+	gateway.Unlock()
+}
+
+// traceFrame hands a frame to the trace sink and the debug log, with its
+// credentials redacted.
+func (gateway *Gateway) traceFrame(direction string, data []byte) {
+	gateway.Lock()
+	logger, sink := gateway.logger, gateway.trace
+	gateway.Unlock()
+
+	data = redact(data)
+	if sink != nil {
+		sink.Trace(newFrame(direction, data))
+	}
+	logger.Debug("frame", F("dir", direction), F("data", frameData(data)))
+}
+
+// frameData logs a frame as text, only converting it when the line is
+// written, so frames are not copied while debug logging is off.
+type frameData []byte
+
+func (data frameData) String() string {
+	return string(data)
 }
 
 // GetErrChan returns a channels through which the caller can check and react to connectivity errors
@@ -98,58 +216,192 @@ func (gateway *Gateway) GetErrChan() chan error {
 	return gateway.errors
 }
 
-func (gateway *Gateway) send(msg map[string]interface{}, transaction chan interface{}) {
-	guid := generateTransactionId()
+// SetRequestTimeout bounds every request made through the methods without a
+// context argument. Zero, the default, waits for the gateway forever.
+func (gateway *Gateway) SetRequestTimeout(timeout time.Duration) {
+	gateway.Lock()
+	gateway.requestTimeout = timeout
+	gateway.Unlock()
+}
 
-	msg["transaction"] = guid.String()
+// requestContext returns the context used by the methods without a context
+// argument, bounded by the timeout set with SetRequestTimeout.
+func (gateway *Gateway) requestContext() (context.Context, context.CancelFunc) {
 	gateway.Lock()
-	gateway.transactions[guid] = transaction
-	gateway.transactionsUsed[guid] = false
+	timeout := gateway.requestTimeout
 	gateway.Unlock()
 
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+func (gateway *Gateway) send(msg map[string]interface{}, ch chan interface{}) (xid.ID, error) {
+	return gateway.write(msg, ch, false)
+}
+
+// write registers the transaction and sends msg. While the connection is
+// being recovered, messages are held back and go out once every session has
+// been claimed again; urgent skips that, for the claims themselves.
+func (gateway *Gateway) write(msg map[string]interface{}, ch chan interface{}, urgent bool) (xid.ID, error) {
+	guid := generateTransactionId()
+
+	gateway.authorize(msg)
+	msg["transaction"] = guid.String()
 	data, err := json.Marshal(msg)
 	if err != nil {
-		fmt.Printf("json.Marshal: %s\n", err)
-		return
+		return guid, err
 	}
 
-	if gateway.debug {
-		// log message being sent
-		var log bytes.Buffer
-		json.Indent(&log, data, ">", "   ")
-		log.Write([]byte("\n"))
-		log.WriteTo(os.Stdout)
+	entry := &transaction{ch: ch, data: data}
+	entry.request, _ = msg["janus"].(string)
+	entry.session, _ = msg["session_id"].(uint64)
+	entry.handle, _ = msg["handle_id"].(uint64)
+	gateway.transactions.add(guid, entry)
+
+	gateway.Lock()
+	held := gateway.reconnecting && !urgent
+	transport := gateway.transport
+	gateway.Unlock()
+
+	gateway.traceFrame(FrameOut, data)
+
+	// A held back request is left for the resend once the sessions are
+	// claimed, as is one that resend took already.
+	if held || !gateway.transactions.take(guid, transport) {
+		return guid, nil
 	}
 
-	gateway.writeMu.Lock()
-	err = gateway.conn.WriteMessage(websocket.TextMessage, data)
-	gateway.writeMu.Unlock()
+	err = transport.Write(data)
+	if err != nil && gateway.canReconnect() {
+		if current := gateway.currentTransport(); current != transport {
+			transport = current
+			if !gateway.transactions.take(guid, transport) {
+				return guid, nil
+			}
+			err = transport.Write(data)
+		}
+		if err != nil {
+			// Make the receive loop notice the broken connection, the
+			// message is resent once it has been recovered.
+			transport.Close()
+		}
+		return guid, nil
+	}
 
 	if err != nil {
+		gateway.transactions.remove(guid)
 		select {
 		case gateway.errors <- err:
 		default:
-			fmt.Printf("conn.Write: %s\n", err)
+			gateway.Logger().Error("conn.Write failed", F("error", err))
 		}
 
+		return guid, err
+	}
+
+	return guid, nil
+}
+
+// authorize adds the apisecret and token of the Gateway to a Janus API
+// request. A token set by the session is kept, and Admin API requests carry
+// their admin_secret instead.
+func (gateway *Gateway) authorize(msg map[string]interface{}) {
+	if _, ok := msg["admin_secret"]; ok {
+		return
+	}
+
+	gateway.Lock()
+	apiSecret, token := gateway.apiSecret, gateway.token
+	gateway.Unlock()
+
+	if apiSecret != "" {
+		msg["apisecret"] = apiSecret
+	}
+	if _, ok := msg["token"]; !ok && token != "" {
+		msg["token"] = token
+	}
+}
+
+// watchSession has transports that fetch the events of each session start
+// fetching them for the session id. The fetches carry the apisecret and
+// token the session's requests do, token being the session's own if it has
+// one.
+func (gateway *Gateway) watchSession(id uint64, token string) {
+	watcher, ok := gateway.currentTransport().(sessionWatcher)
+	if !ok {
 		return
 	}
+
+	msg := map[string]interface{}{}
+	if token != "" {
+		msg["token"] = token
+	}
+	gateway.authorize(msg)
+
+	auth := url.Values{}
+	for _, key := range []string{"apisecret", "token"} {
+		if value, ok := msg[key].(string); ok {
+			auth.Set(key, value)
+		}
+	}
+	watcher.WatchSession(id, auth)
 }
 
-func passMsg(ch chan interface{}, msg interface{}) {
-	ch <- msg
+// SetToken sets the token sent with every request of the Gateway, for a
+// Janus with token_auth enabled. Sessions created with CreateWithToken use
+// their own token instead.
+func (gateway *Gateway) SetToken(token string) {
+	gateway.Lock()
+	gateway.token = token
+	gateway.Unlock()
+}
+
+// wait blocks until the next message for the transaction arrives or ctx is
+// done. A transaction given up on is abandoned, so a late reply is dropped.
+func (gateway *Gateway) wait(ctx context.Context, request string, id xid.ID, ch chan interface{}) (interface{}, error) {
+	select {
+	case msg := <-ch:
+		switch err := msg.(type) {
+		case *TimeoutError:
+			return nil, err
+		case *SessionError:
+			return nil, err
+		case *ErrorMsg:
+			if err.Err.Code == errorUnauthorized || err.Err.Code == errorUnauthorizedPlugin {
+				return nil, &UnauthorizedError{Request: request, Code: err.Err.Code, Reason: err.Err.Reason}
+			}
+		}
+		return msg, nil
+	case <-ctx.Done():
+		gateway.transactions.abandon(id)
+		return nil, &TimeoutError{Request: request, Transaction: id.String(), Err: ctx.Err()}
+	}
 }
 
 func (gateway *Gateway) ping() {
 	ticker := time.NewTicker(time.Second * 30)
 	defer ticker.Stop()
-	for range ticker.C {
-		err := gateway.conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(20*time.Second))
+	for {
+		select {
+		case <-ticker.C:
+		case <-gateway.done:
+			return
+		}
+
+		transport := gateway.currentTransport()
+		err := transport.(pinger).Ping(time.Now().Add(20 * time.Second))
+		if err != nil && gateway.canReconnect() {
+			// the receive loop notices the closed connection and recovers it
+			transport.Close()
+			continue
+		}
 		if err != nil {
 			select {
 			case gateway.errors <- err:
 			default:
-				log.Println("ping:", err)
+				gateway.Logger().Error("ping failed", F("error", err))
 			}
 
 			return
@@ -169,33 +421,34 @@ func (gateway *Gateway) recv() {
 		// Decode to Msg struct
 		var base BaseMsg
 
-		_, data, err := gateway.conn.ReadMessage()
+		data, err := gateway.currentTransport().Read()
 		if err != nil {
+			if gateway.reconnect(err) {
+				continue
+			}
+			if gateway.isClosing() {
+				return
+			}
+
 			select {
 			case gateway.errors <- err:
 			default:
-				fmt.Printf("conn.Read: %s\n", err)
+				gateway.Logger().Error("conn.Read failed", F("error", err))
 			}
 
 			return
 		}
 
+		gateway.traceFrame(FrameIn, data)
+
 		if err := json.Unmarshal(data, &base); err != nil {
-			fmt.Printf("json.Unmarshal: %s\n", err)
+			gateway.Logger().Warn("json.Unmarshal failed", F("error", err))
 			continue
 		}
 
-		if gateway.debug {
-			// log message being sent
-			var log bytes.Buffer
-			json.Indent(&log, data, "<", "   ")
-			log.Write([]byte("\n"))
-			log.WriteTo(os.Stdout)
-		}
-
 		typeFunc, ok := msgtypes[base.Type]
 		if !ok {
-			fmt.Printf("Unknown message type received!\n")
+			gateway.Logger().Warn("unknown message type received", F("janus", base.Type))
 			continue
 		}
 
@@ -203,74 +456,74 @@ func (gateway *Gateway) recv() {
 		decoder.UseNumber()
 		msg := typeFunc()
 		if err := decoder.Decode(&msg); err != nil {
-			fmt.Printf("json.Unmarshal: %s\n", err)
+			gateway.Logger().Warn("json.Unmarshal failed", F("janus", base.Type), F("error", err))
 			continue // Decode error
 		}
 		ifSuccessMsgAppendJsonData(msg, data)
 
-		var transactionUsed bool
+		// Pass message on from here. Responses go to the request waiting on
+		// the transaction; an event carrying the transaction of a request
+		// that is already answered is delivered like any other event.
 		if base.ID != "" {
-			id, _ := xid.FromString(base.ID)
-			gateway.Lock()
-			transactionUsed = gateway.transactionsUsed[id]
-			gateway.Unlock()
+			id, err := xid.FromString(base.ID)
+			if err == nil && gateway.transactions.deliver(id, msg) {
+				continue
+			}
+			if isResponse(msg) {
+				gateway.Logger().Debug("unable to deliver message, transaction gone?", F("janus", base.Type), F("transaction", base.ID))
+				continue
+			}
+		}
 
+		// Is this a Session event?
+		if base.Handle == 0 {
+			gateway.sessionEvent(base.Session, msg)
+			continue
 		}
 
-		// Pass message on from here
-		if base.ID == "" || transactionUsed {
-			// Is this a Handle event?
-			if base.Handle == 0 {
-				// Error()
-			} else {
-				// Lookup Session
-				gateway.Lock()
-				session := gateway.Sessions[base.Session]
-				gateway.Unlock()
-				if session == nil {
-					fmt.Printf("Unable to deliver message. Session gone?\n")
-					continue
-				}
-
-				// Lookup Handle
-				session.Lock()
-				handle := session.Handles[base.Handle]
-				session.Unlock()
-				if handle == nil {
-					fmt.Printf("Unable to deliver message. Handle gone?\n")
-					continue
-				}
-
-				// Pass msg
-				go passMsg(handle.Events, msg)
-			}
-		} else {
-			id, _ := xid.FromString(base.ID)
-			// Lookup Transaction
-			gateway.Lock()
-			transaction := gateway.transactions[id]
-			switch msg.(type) {
-			case *EventMsg:
-				gateway.transactionsUsed[id] = true
-			}
-			gateway.Unlock()
-			if transaction == nil {
-				// TODO Error Handling
-			}
+		// Lookup Session
+		gateway.Lock()
+		session := gateway.Sessions[base.Session]
+		gateway.Unlock()
+		if session == nil {
+			gateway.Logger().Debug("unable to deliver message, session gone?", F("janus", base.Type), F("session", base.Session))
+			continue
+		}
 
-			// Pass msg
-			go passMsg(transaction, msg)
+		// Lookup Handle
+		session.Lock()
+		handle := session.Handles[base.Handle]
+		session.Unlock()
+		if handle == nil {
+			session.Logger().Debug("unable to deliver message, handle gone?", F("janus", base.Type), F("handle", base.Handle))
+			continue
 		}
+
+		// Pass msg, in order
+		handle.deliver(msg)
 	}
 }
 
 // Info sends an info request to the Gateway.
 // On success, an InfoMsg will be returned and error will be nil.
 func (gateway *Gateway) Info() (*InfoMsg, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.InfoCtx(ctx)
+}
+
+// InfoCtx is like Info but gives up with a *TimeoutError once ctx is done.
+func (gateway *Gateway) InfoCtx(ctx context.Context) (*InfoMsg, error) {
 	req, ch := newRequest("info")
-	gateway.send(req, ch)
+	id, err := gateway.send(req, ch)
+	if err != nil {
+		return nil, err
+	}
 
-	msg := <-ch
+	msg, err := gateway.wait(ctx, "info", id, ch)
+	if err != nil {
+		return nil, err
+	}
 	switch msg := msg.(type) {
 	case *InfoMsg:
 		return msg, nil
@@ -284,30 +537,61 @@ func (gateway *Gateway) Info() (*InfoMsg, error) {
 // Create sends a create request to the Gateway.
 // On success, a new Session will be returned and error will be nil.
 func (gateway *Gateway) Create() (*Session, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.CreateCtx(ctx)
+}
+
+// CreateCtx is like Create but gives up with a *TimeoutError once ctx is done.
+func (gateway *Gateway) CreateCtx(ctx context.Context) (*Session, error) {
+	return gateway.CreateWithTokenCtx(ctx, "")
+}
+
+// CreateWithToken is like Create, but the session sends token with each of
+// its requests instead of the token of the Gateway.
+func (gateway *Gateway) CreateWithToken(token string) (*Session, error) {
+	ctx, cancel := gateway.requestContext()
+	defer cancel()
+	return gateway.CreateWithTokenCtx(ctx, token)
+}
+
+// CreateWithTokenCtx is like CreateWithToken but gives up with a
+// *TimeoutError once ctx is done.
+func (gateway *Gateway) CreateWithTokenCtx(ctx context.Context, token string) (*Session, error) {
 	req, ch := newRequest("create")
-	gateway.send(req, ch)
+	if token != "" {
+		req["token"] = token
+	}
+	id, err := gateway.send(req, ch)
+	if err != nil {
+		return nil, err
+	}
 
-	msg := <-ch
+	msg, err := gateway.wait(ctx, "create", id, ch)
+	if err != nil {
+		return nil, err
+	}
 	var success *SuccessMsg
 	switch msg := msg.(type) {
 	case *SuccessMsg:
 		success = msg
 	case *ErrorMsg:
 		return nil, msg
+	default:
+		return nil, unexpected("create")
 	}
 
 	// Create new session
-	session := new(Session)
-	session.gateway = gateway
-	session.ID = success.Data.ID
-	session.Handles = make(map[uint64]*Handle)
-	session.Events = make(chan interface{}, 2)
+	session := newSession(gateway, success.Data.ID)
+	session.token = token
 
 	// Store this session
 	gateway.Lock()
 	gateway.Sessions[session.ID] = session
 	gateway.Unlock()
 
+	gateway.watchSession(session.ID, token)
+
 	return session, nil
 }
 
@@ -1,17 +1,27 @@
 package janus
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/Hwanse/janus-tester/internal/fakejanus"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_Connect(t *testing.T) {
-	url := fmt.Sprintf("ws://%s:%s/", JanusLocalHost, JanusWebsocketPort)
-	client, err := WsConnect(url)
+	server := newFakeJanus(t)
+	client, err := WsConnect(server.WebsocketURL())
 	if err != nil {
 		t.Fail()
 		return
 	}
+	defer client.Close()
 	mess, err := client.Info()
 	if err != nil {
 		t.Fail()
@@ -29,12 +39,13 @@ func Test_Connect(t *testing.T) {
 }
 
 func Test_AdminConnect(t *testing.T) {
-	adminUrl := fmt.Sprintf("ws://%s:%s/", JanusLocalHost, JanusAdminWebsocketPort)
-	adminClient, err := WsAdminConnect(adminUrl)
+	server := newFakeJanus(t)
+	adminClient, err := WsAdminConnect(server.WebsocketURL())
 	if err != nil {
 		t.Fail()
 		return
 	}
+	defer adminClient.Close()
 	msg, err := adminClient.GetStatus()
 	if err != nil {
 		t.Fail()
@@ -44,3 +55,70 @@ func Test_AdminConnect(t *testing.T) {
 
 	t.Log(msg)
 }
+
+func Test_CreateCtx_Timeout(t *testing.T) {
+	server := newSilentServer(t)
+	defer server.Close()
+
+	client, err := WsConnect("ws" + strings.TrimPrefix(server.URL, "http"))
+	assert.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	session, err := client.CreateCtx(ctx)
+	assert.Nil(t, session)
+	assert.True(t, IsTimeout(err))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	stats := client.TransactionStats()
+	assert.Zero(t, stats.Pending)
+	assert.Equal(t, uint64(1), stats.Abandoned)
+}
+
+func Test_RequestTimeout(t *testing.T) {
+	server := newSilentServer(t)
+	defer server.Close()
+
+	client, err := WsConnect("ws" + strings.TrimPrefix(server.URL, "http"))
+	assert.NoError(t, err)
+	defer client.Close()
+
+	client.SetRequestTimeout(100 * time.Millisecond)
+	_, err = client.Info()
+	assert.True(t, IsTimeout(err))
+}
+
+// newFakeJanus starts an in-process Janus that is closed with the test.
+func newFakeJanus(t *testing.T) *fakejanus.Server {
+	server := fakejanus.NewServer()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newSilentServer accepts websocket connections and never answers, standing
+// in for a gateway that dropped our requests.
+func newSilentServer(t *testing.T) *httptest.Server {
+	upgrader := websocket.Upgrader{Subprotocols: []string{WebsocketSubProtocol}}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Log(err)
+			return
+		}
+		defer conn.Close()
+
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func Test_MessageType(t *testing.T) {
+	for name, typeFunc := range msgtypes {
+		assert.Equal(t, name, messageType(typeFunc()))
+	}
+}
@@ -0,0 +1,118 @@
+package janus
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// Level is the severity of a log line.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+func (level Level) String() string {
+	if level < LevelDebug || level > LevelError {
+		return fmt.Sprintf("LEVEL(%d)", int(level))
+	}
+	return levelNames[level]
+}
+
+// ParseLevel parses a level name such as "debug" or "WARN".
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(level), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level '%s'", name)
+}
+
+// Field is a key/value pair attached to a log line.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F builds a Field.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger receives the log lines of a Gateway and of the sessions and handles
+// on it. With returns a Logger that adds fields to every line, which is how
+// session and handle ids get attached.
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+	With(fields ...Field) Logger
+}
+
+// stdLogger writes "LEVEL msg key=value ..." lines through the log package.
+type stdLogger struct {
+	out    *log.Logger
+	min    Level
+	fields []Field
+}
+
+// NewStdLogger returns a Logger writing lines at or above min to out.
+func NewStdLogger(out io.Writer, min Level) Logger {
+	return &stdLogger{out: log.New(out, "", log.LstdFlags|log.Lmicroseconds), min: min}
+}
+
+// DefaultLogger is what a Gateway logs to until SetLogger is called: info
+// and above on stderr.
+var DefaultLogger = NewStdLogger(os.Stderr, LevelInfo)
+
+func (logger *stdLogger) Debug(msg string, fields ...Field) { logger.log(LevelDebug, msg, fields) }
+func (logger *stdLogger) Info(msg string, fields ...Field)  { logger.log(LevelInfo, msg, fields) }
+func (logger *stdLogger) Warn(msg string, fields ...Field)  { logger.log(LevelWarn, msg, fields) }
+func (logger *stdLogger) Error(msg string, fields ...Field) { logger.log(LevelError, msg, fields) }
+
+func (logger *stdLogger) With(fields ...Field) Logger {
+	merged := make([]Field, 0, len(logger.fields)+len(fields))
+	merged = append(merged, logger.fields...)
+	merged = append(merged, fields...)
+	return &stdLogger{out: logger.out, min: logger.min, fields: merged}
+}
+
+func (logger *stdLogger) log(level Level, msg string, fields []Field) {
+	if level < logger.min {
+		return
+	}
+
+	var line strings.Builder
+	line.WriteString(level.String())
+	line.WriteString(" ")
+	line.WriteString(msg)
+	for _, field := range logger.fields {
+		fmt.Fprintf(&line, " %s=%v", field.Key, field.Value)
+	}
+	for _, field := range fields {
+		fmt.Fprintf(&line, " %s=%v", field.Key, field.Value)
+	}
+	logger.out.Println(line.String())
+}
+
+// nopLogger drops everything.
+type nopLogger struct{}
+
+// NopLogger is a Logger that discards every line.
+var NopLogger Logger = nopLogger{}
+
+func (nopLogger) Debug(string, ...Field) {}
+func (nopLogger) Info(string, ...Field)  {}
+func (nopLogger) Warn(string, ...Field)  {}
+func (nopLogger) Error(string, ...Field) {}
+func (nopLogger) With(...Field) Logger   { return NopLogger }
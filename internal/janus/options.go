@@ -0,0 +1,193 @@
+package janus
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultURL is the websocket API of a Janus running on this machine.
+	DefaultURL = "ws://" + JanusLocalHost + ":" + JanusWebsocketPort + "/"
+
+	// DefaultAdminURL is the websocket Admin API of a Janus running on this
+	// machine.
+	DefaultAdminURL = "ws://" + JanusLocalHost + ":" + JanusAdminWebsocketPort + "/"
+
+	// DefaultDialTimeout bounds the websocket handshake.
+	DefaultDialTimeout = 10 * time.Second
+)
+
+// GatewayOptions describe how Connect reaches a Janus instance.
+type GatewayOptions struct {
+	// URL is the API root. ws:// and wss:// URLs use the websocket transport,
+	// http:// and https:// ones the REST interface, and unix:// ones the
+	// pfunix Unix socket, see unixSocket.
+	URL string
+
+	// Subprotocol is offered in the websocket handshake, janus-protocol for
+	// the Janus API and janus-admin-protocol for the Admin API.
+	Subprotocol string
+
+	// Header is added to the websocket handshake, or to every HTTP request.
+	Header http.Header
+
+	// DialTimeout bounds establishing the connection.
+	DialTimeout time.Duration
+
+	// TLSConfig is used for wss:// and https:// URLs, see TLSOptions. The
+	// system defaults apply when it is nil.
+	TLSConfig *tls.Config
+
+	// AdminSecret is the admin_secret sent with every Admin API request.
+	AdminSecret string
+
+	// APISecret is the apisecret sent with every Janus API request, for a
+	// Janus configured with api_secret.
+	APISecret string
+
+	// Token is sent with every Janus API request, for a Janus with
+	// token_auth enabled. See also Gateway.CreateWithToken.
+	Token string
+
+	// Debug logs every frame the Gateway sends and receives.
+	Debug bool
+}
+
+// Option changes one of the GatewayOptions.
+type Option func(options *GatewayOptions)
+
+// DefaultGatewayOptions connect to the websocket API of a local Janus with
+// the stock admin secret.
+func DefaultGatewayOptions() GatewayOptions {
+	return GatewayOptions{
+		URL:         DefaultURL,
+		Subprotocol: WebsocketSubProtocol,
+		DialTimeout: DefaultDialTimeout,
+		AdminSecret: AdminSecret,
+	}
+}
+
+// WithURL sets the API root to connect to.
+func WithURL(url string) Option {
+	return func(options *GatewayOptions) { options.URL = url }
+}
+
+// WithSubprotocol sets the websocket subprotocol.
+func WithSubprotocol(subprotocol string) Option {
+	return func(options *GatewayOptions) { options.Subprotocol = subprotocol }
+}
+
+// WithHeader adds a header to the handshake, it can be given more than once.
+func WithHeader(key string, value string) Option {
+	return func(options *GatewayOptions) {
+		if options.Header == nil {
+			options.Header = make(http.Header)
+		}
+		options.Header.Add(key, value)
+	}
+}
+
+// WithDialTimeout bounds establishing the connection.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(options *GatewayOptions) { options.DialTimeout = timeout }
+}
+
+// WithTLSConfig sets the TLS configuration of wss:// and https:// URLs.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(options *GatewayOptions) { options.TLSConfig = config }
+}
+
+// WithAdminSecret sets the admin_secret of Admin API requests.
+func WithAdminSecret(secret string) Option {
+	return func(options *GatewayOptions) { options.AdminSecret = secret }
+}
+
+// WithAPISecret sets the apisecret of Janus API requests.
+func WithAPISecret(secret string) Option {
+	return func(options *GatewayOptions) { options.APISecret = secret }
+}
+
+// WithToken sets the token of Janus API requests.
+func WithToken(token string) Option {
+	return func(options *GatewayOptions) { options.Token = token }
+}
+
+// WithDebug turns logging of every frame on or off.
+func WithDebug(debug bool) Option {
+	return func(options *GatewayOptions) { options.Debug = debug }
+}
+
+// Connect connects to Janus as described by DefaultGatewayOptions changed by
+// opts. The transport follows the scheme of the URL.
+func Connect(opts ...Option) (*Gateway, error) {
+	options := DefaultGatewayOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return ConnectWithOptions(options)
+}
+
+// ConnectWithOptions is Connect for options built by the caller.
+func ConnectWithOptions(options GatewayOptions) (*Gateway, error) {
+	dial, err := options.dialer()
+	if err != nil {
+		return nil, err
+	}
+
+	gateway, err := DialGateway(dial)
+	if err != nil {
+		return nil, err
+	}
+
+	gateway.adminSecret = options.AdminSecret
+	gateway.apiSecret = options.APISecret
+	gateway.token = options.Token
+	if options.Debug {
+		gateway.SetLogger(NewStdLogger(os.Stderr, LevelDebug))
+	}
+	return gateway, nil
+}
+
+func (options GatewayOptions) dialer() (func() (Transport, error), error) {
+	parsed, err := url.Parse(options.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch parsed.Scheme {
+	case "ws", "wss":
+		return func() (Transport, error) {
+			return dialWebsocket(options)
+		}, nil
+	case "unix":
+		if _, _, err := unixSocket(parsed); err != nil {
+			return nil, err
+		}
+		return func() (Transport, error) {
+			return dialUnix(options)
+		}, nil
+	case "http", "https":
+		return func() (Transport, error) {
+			transport := newHttpTransport(options.URL)
+			transport.header = options.Header
+			if options.DialTimeout > 0 || options.TLSConfig != nil {
+				roundTripper := http.DefaultTransport.(*http.Transport).Clone()
+				if options.DialTimeout > 0 {
+					dialer := &net.Dialer{Timeout: options.DialTimeout}
+					roundTripper.DialContext = dialer.DialContext
+				}
+				roundTripper.TLSClientConfig = options.TLSConfig
+				transport.client.Transport = roundTripper
+				transport.pollClient.Transport = roundTripper
+			}
+			return transport, nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported janus url scheme '%s'", parsed.Scheme)
+}
@@ -0,0 +1,110 @@
+package janus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Connect_ConcurrentSubprotocols(t *testing.T) {
+	server := newFakeJanus(t)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			admin, err := Connect(WithURL(server.WebsocketURL()), WithSubprotocol(WebsocketAdminSubProtocol))
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer admin.Close()
+			_, err = admin.GetStatus()
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			client, err := Connect(WithURL(server.WebsocketURL()))
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer client.Close()
+			_, err = client.Info()
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+}
+
+func Test_Connect_AdminSecret(t *testing.T) {
+	server := newFakeJanus(t)
+	server.AdminSecret = "staging"
+
+	admin, err := Connect(WithURL(server.WebsocketURL()), WithSubprotocol(WebsocketAdminSubProtocol))
+	assert.NoError(t, err)
+	defer admin.Close()
+	_, err = admin.GetStatus()
+	assert.True(t, IsUnauthorized(err))
+
+	admin, err = Connect(WithURL(server.WebsocketURL()), WithSubprotocol(WebsocketAdminSubProtocol), WithAdminSecret("staging"))
+	assert.NoError(t, err)
+	defer admin.Close()
+	_, err = admin.GetStatus()
+	assert.NoError(t, err)
+}
+
+func Test_Connect_Header(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	upgrader := websocket.Upgrader{Subprotocols: []string{WebsocketSubProtocol}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.Close()
+	}))
+	defer server.Close()
+
+	client, err := Connect(
+		WithURL("ws"+strings.TrimPrefix(server.URL, "http")),
+		WithHeader("Authorization", "Bearer token"),
+		WithDialTimeout(time.Second),
+	)
+	assert.NoError(t, err)
+	defer client.Close()
+
+	header := <-headers
+	assert.Equal(t, "Bearer token", header.Get("Authorization"))
+	assert.Equal(t, WebsocketSubProtocol, header.Get("Sec-Websocket-Protocol"))
+}
+
+func Test_Connect_UnsupportedScheme(t *testing.T) {
+	_, err := Connect(WithURL("ftp://127.0.0.1/"))
+	assert.Error(t, err)
+}
+
+func Test_Connect_APISecret(t *testing.T) {
+	server := newFakeJanus(t)
+	server.APISecret = "secret"
+
+	client, err := Connect(WithURL(server.WebsocketURL()))
+	assert.NoError(t, err)
+	defer client.Close()
+	_, err = client.Info()
+	assert.NoError(t, err)
+	_, err = client.Create()
+	assert.True(t, IsUnauthorized(err))
+
+	client, err = Connect(WithURL(server.WebsocketURL()), WithAPISecret("secret"))
+	assert.NoError(t, err)
+	defer client.Close()
+	_, err = client.Create()
+	assert.NoError(t, err)
+}
@@ -1,13 +1,22 @@
 package janus
 
 import (
+	"context"
+
 	"github.com/mitchellh/mapstructure"
 )
 
 func (handle *Handle) JoinPublisher(req *JoinPublisherRequest) (*JoinPublisherResponse, error) {
-	msg, err := handle.Message(req, nil)
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.JoinPublisherCtx(ctx, req)
+}
+
+// JoinPublisherCtx is like JoinPublisher but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) JoinPublisherCtx(ctx context.Context, req *JoinPublisherRequest) (*JoinPublisherResponse, error) {
+	msg, err := handle.MessageCtx(ctx, req, nil)
 	if err != nil {
-		return nil, WrapError("failed to join the publisher", err.Error())
+		return nil, wrapRequestError("failed to join the publisher", err)
 	}
 
 	response := JoinPublisherResponse{}
@@ -17,16 +26,24 @@ func (handle *Handle) JoinPublisher(req *JoinPublisherRequest) (*JoinPublisherRe
 	}
 
 	if isUnexpectedResponse(response.VideoRoomResponseType.Type, SuccessJoin) {
-		return nil, WrapError("failed to join the publisher", response.Error())
+		return nil, wrapResponseError("failed to join the publisher", &response.ErrorResponse)
 	}
+	handle.setJoined(TypePublisher)
 
 	return &response, nil
 }
 
 func (handle *Handle) JoinSubscriber(req *JoinSubscriberRequest) (*JoinSubscriberResponse, error) {
-	msg, err := handle.Message(req, nil)
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.JoinSubscriberCtx(ctx, req)
+}
+
+// JoinSubscriberCtx is like JoinSubscriber but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) JoinSubscriberCtx(ctx context.Context, req *JoinSubscriberRequest) (*JoinSubscriberResponse, error) {
+	msg, err := handle.MessageCtx(ctx, req, nil)
 	if err != nil {
-		return nil, WrapError("failed to join the subscriber", err.Error())
+		return nil, wrapRequestError("failed to join the subscriber", err)
 	}
 
 	response := JoinSubscriberResponse{}
@@ -36,17 +53,25 @@ func (handle *Handle) JoinSubscriber(req *JoinSubscriberRequest) (*JoinSubscribe
 	}
 
 	if isUnexpectedResponse(response.VideoRoomResponseType.Type, SuccessAttached) {
-		return nil, WrapError("failed to join the subscriber", response.Error())
+		return nil, wrapResponseError("failed to join the subscriber", &response.ErrorResponse)
 	}
+	handle.setJoined(TypeSubscriber)
 	response.Jsep = msg.Jsep
 
 	return &response, nil
 }
 
 func (handle *Handle) Publish(req *PublishRequest, jsep interface{}) (map[string]interface{}, error) {
-	msg, err := handle.Message(req, jsep)
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.PublishCtx(ctx, req, jsep)
+}
+
+// PublishCtx is like Publish but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) PublishCtx(ctx context.Context, req *PublishRequest, jsep interface{}) (map[string]interface{}, error) {
+	msg, err := handle.MessageCtx(ctx, req, jsep)
 	if err != nil {
-		return nil, WrapError("failed to publish", err.Error())
+		return nil, wrapRequestError("failed to publish", err)
 	}
 
 	response := PublishResponse{}
@@ -57,16 +82,53 @@ func (handle *Handle) Publish(req *PublishRequest, jsep interface{}) (map[string
 
 	if isUnexpectedResponse(response.VideoRoomResponseType.Type, TypeEvent) ||
 		isUnexpectedResponse(response.Configured, OK) {
-		return nil, WrapError("failed to publish", response.Error())
+		return nil, wrapResponseError("failed to publish", &response.ErrorResponse)
 	}
 
 	return msg.Jsep, nil
 }
 
+// Configure changes the settings of the publisher, and renegotiates its
+// PeerConnection when jsep is an offer. The answer is in the response Jsep.
+func (handle *Handle) Configure(req *ConfigureRequest, jsep interface{}) (*ConfigureResponse, error) {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.ConfigureCtx(ctx, req, jsep)
+}
+
+// ConfigureCtx is like Configure but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) ConfigureCtx(ctx context.Context, req *ConfigureRequest, jsep interface{}) (*ConfigureResponse, error) {
+	msg, err := handle.MessageCtx(ctx, req, jsep)
+	if err != nil {
+		return nil, wrapRequestError("failed to configure", err)
+	}
+
+	response := ConfigureResponse{}
+	err = mapstructure.Decode(msg.Plugindata.Data, &response)
+	if err != nil {
+		return nil, WrapError("failed to configure", err.Error())
+	}
+
+	if isUnexpectedResponse(response.VideoRoomResponseType.Type, TypeEvent) ||
+		isUnexpectedResponse(response.Configured, OK) {
+		return nil, wrapResponseError("failed to configure", &response.ErrorResponse)
+	}
+	response.Jsep = msg.Jsep
+
+	return &response, nil
+}
+
 func (handle *Handle) UnPublish(req *UnPublishRequest) error {
-	msg, err := handle.Message(req, nil)
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.UnPublishCtx(ctx, req)
+}
+
+// UnPublishCtx is like UnPublish but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) UnPublishCtx(ctx context.Context, req *UnPublishRequest) error {
+	msg, err := handle.MessageCtx(ctx, req, nil)
 	if err != nil {
-		return WrapError("failed to unpublish", err.Error())
+		return wrapRequestError("failed to unpublish", err)
 	}
 
 	response := UnPublishResponse{}
@@ -77,16 +139,23 @@ func (handle *Handle) UnPublish(req *UnPublishRequest) error {
 
 	if isUnexpectedResponse(response.VideoRoomResponseType.Type, TypeEvent) ||
 		isUnexpectedResponse(response.UnPublished, OK) {
-		return WrapError("failed to unpublish", response.Error())
+		return wrapResponseError("failed to unpublish", &response.ErrorResponse)
 	}
 
 	return nil
 }
 
 func (handle *Handle) SubscribeStart(req *SubscribeStartRequest, jsep interface{}) error {
-	msg, err := handle.Message(req, jsep)
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.SubscribeStartCtx(ctx, req, jsep)
+}
+
+// SubscribeStartCtx is like SubscribeStart but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) SubscribeStartCtx(ctx context.Context, req *SubscribeStartRequest, jsep interface{}) error {
+	msg, err := handle.MessageCtx(ctx, req, jsep)
 	if err != nil {
-		return WrapError("failed to start subscribe", err.Error())
+		return wrapRequestError("failed to start subscribe", err)
 	}
 
 	response := SubscribeStartResponse{}
@@ -97,16 +166,23 @@ func (handle *Handle) SubscribeStart(req *SubscribeStartRequest, jsep interface{
 
 	if isUnexpectedResponse(response.VideoRoomResponseType.Type, TypeEvent) ||
 		isUnexpectedResponse(response.Started, OK) {
-		return WrapError("failed to start subscribe", response.Error())
+		return wrapResponseError("failed to start subscribe", &response.ErrorResponse)
 	}
 
 	return nil
 }
 
 func (handle *Handle) LeavePublisher(req *LeaveRequest) error {
-	msg, err := handle.Message(req, nil)
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.LeavePublisherCtx(ctx, req)
+}
+
+// LeavePublisherCtx is like LeavePublisher but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) LeavePublisherCtx(ctx context.Context, req *LeaveRequest) error {
+	msg, err := handle.MessageCtx(ctx, req, nil)
 	if err != nil {
-		return WrapError("failed to leave the room", err.Error())
+		return wrapRequestError("failed to leave the room", err)
 	}
 
 	response := LeavePublisherResponse{}
@@ -116,16 +192,24 @@ func (handle *Handle) LeavePublisher(req *LeaveRequest) error {
 	}
 	if isUnexpectedResponse(response.VideoRoomResponseType.Type, TypeEvent) ||
 		isUnexpectedResponse(response.Leaving, OK) {
-		return WrapError("failed to leave the room", response.Error())
+		return wrapResponseError("failed to leave the room", &response.ErrorResponse)
 	}
+	handle.setJoined("")
 
 	return nil
 }
 
 func (handle *Handle) LeaveSubscriber(req *LeaveRequest) error {
-	msg, err := handle.Message(req, nil)
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.LeaveSubscriberCtx(ctx, req)
+}
+
+// LeaveSubscriberCtx is like LeaveSubscriber but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) LeaveSubscriberCtx(ctx context.Context, req *LeaveRequest) error {
+	msg, err := handle.MessageCtx(ctx, req, nil)
 	if err != nil {
-		return WrapError("failed to leave the room", err.Error())
+		return wrapRequestError("failed to leave the room", err)
 	}
 
 	response := LeaveSubscriberResponse{}
@@ -135,10 +219,90 @@ func (handle *Handle) LeaveSubscriber(req *LeaveRequest) error {
 	}
 	if isUnexpectedResponse(response.VideoRoomResponseType.Type, TypeEvent) ||
 		isUnexpectedResponse(response.Left, OK) {
-		return WrapError("failed to leave the room", response.Error())
+		return wrapResponseError("failed to leave the room", &response.ErrorResponse)
 	}
+	handle.setJoined("")
 
 	return nil
 }
 
-// TODO: participant advanced api
+// Moderate mutes or unmutes the stream of a participant of the room. The
+// participants are told with a VideoRoomEvent with Moderation set.
+func (handle *Handle) Moderate(req *ModerateRequest) (*ModerateResponse, error) {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.ModerateCtx(ctx, req)
+}
+
+// ModerateCtx is like Moderate but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) ModerateCtx(ctx context.Context, req *ModerateRequest) (*ModerateResponse, error) {
+	data, err := handle.pluginRequest(ctx, req)
+	if err != nil {
+		return nil, wrapRequestError("failed to moderate", err)
+	}
+
+	response := ModerateResponse{}
+	err = mapstructure.Decode(data, &response)
+	if err != nil {
+		return nil, WrapError("failed to moderate", err.Error())
+	}
+	if isUnexpectedResponse(response.VideoRoomResponseType.Type, Success) {
+		return nil, wrapResponseError("failed to moderate", &response.ErrorResponse)
+	}
+
+	return &response, nil
+}
+
+// Kick kicks a participant out of the room. The participant is told with a
+// VideoRoomEvent for which IsKicked is true, the others with Kicked set.
+func (handle *Handle) Kick(req *KickRequest) (*KickResponse, error) {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.KickCtx(ctx, req)
+}
+
+// KickCtx is like Kick but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) KickCtx(ctx context.Context, req *KickRequest) (*KickResponse, error) {
+	data, err := handle.pluginRequest(ctx, req)
+	if err != nil {
+		return nil, wrapRequestError("failed to kick", err)
+	}
+
+	response := KickResponse{}
+	err = mapstructure.Decode(data, &response)
+	if err != nil {
+		return nil, WrapError("failed to kick", err.Error())
+	}
+	if isUnexpectedResponse(response.VideoRoomResponseType.Type, Success) {
+		return nil, wrapResponseError("failed to kick", &response.ErrorResponse)
+	}
+
+	return &response, nil
+}
+
+// EnableRecording starts or stops recording every publisher of the room, and
+// the ones joining later, as Record says.
+func (handle *Handle) EnableRecording(req *EnableRecordingRequest) (*EnableRecordingResponse, error) {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.EnableRecordingCtx(ctx, req)
+}
+
+// EnableRecordingCtx is like EnableRecording but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) EnableRecordingCtx(ctx context.Context, req *EnableRecordingRequest) (*EnableRecordingResponse, error) {
+	data, err := handle.pluginRequest(ctx, req)
+	if err != nil {
+		return nil, wrapRequestError("failed to enable recording", err)
+	}
+
+	response := EnableRecordingResponse{}
+	err = mapstructure.Decode(data, &response)
+	if err != nil {
+		return nil, WrapError("failed to enable recording", err.Error())
+	}
+	if isUnexpectedResponse(response.VideoRoomResponseType.Type, Success) {
+		return nil, wrapResponseError("failed to enable recording", &response.ErrorResponse)
+	}
+
+	return &response, nil
+}
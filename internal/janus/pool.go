@@ -0,0 +1,151 @@
+package janus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+const (
+	// PoolRoundRobin hands out the pool's connections in turn.
+	PoolRoundRobin = "round-robin"
+
+	// PoolHash always hands out the same connection for the same key.
+	PoolHash = "hash"
+
+	// PoolPerSession opens a new connection for every session, the way each
+	// browser tab holds its own websocket.
+	PoolPerSession = "per-session"
+)
+
+// GatewayPool spreads sessions over several connections to the same Janus
+// instance. The sessions it creates are ordinary sessions of one of its
+// gateways, so Session, Handle and the plugin helpers work as usual.
+type GatewayPool struct {
+	strategy string
+	dial     func() (*Gateway, error)
+
+	mu       sync.Mutex
+	gateways []*Gateway
+	next     int
+}
+
+// NewGatewayPool opens size connections with dial up front and assigns
+// sessions to them by strategy. With PoolPerSession size is ignored and a
+// connection is dialed for each session instead.
+func NewGatewayPool(size int, strategy string, dial func() (*Gateway, error)) (*GatewayPool, error) {
+	pool := &GatewayPool{strategy: strategy, dial: dial}
+
+	switch strategy {
+	case PoolRoundRobin, PoolHash:
+		if size < 1 {
+			return nil, errors.New("gateway pool needs at least one connection")
+		}
+	case PoolPerSession:
+		size = 0
+	default:
+		return nil, fmt.Errorf("unknown gateway pool strategy '%s'", strategy)
+	}
+
+	for i := 0; i < size; i++ {
+		gateway, err := dial()
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+		pool.gateways = append(pool.gateways, gateway)
+	}
+
+	return pool, nil
+}
+
+// Gateway returns the connection a session for key should be created on.
+// key only matters to PoolHash, an empty key falls back to round-robin.
+func (pool *GatewayPool) Gateway(key string) (*Gateway, error) {
+	if pool.strategy == PoolPerSession {
+		gateway, err := pool.dial()
+		if err != nil {
+			return nil, err
+		}
+
+		pool.mu.Lock()
+		pool.gateways = append(pool.gateways, gateway)
+		pool.mu.Unlock()
+		return gateway, nil
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if pool.strategy == PoolHash && key != "" {
+		hash := fnv.New32a()
+		hash.Write([]byte(key))
+		return pool.gateways[hash.Sum32()%uint32(len(pool.gateways))], nil
+	}
+
+	gateway := pool.gateways[pool.next%len(pool.gateways)]
+	pool.next++
+	return gateway, nil
+}
+
+// Create creates a session on the next connection of the pool.
+func (pool *GatewayPool) Create() (*Session, error) {
+	return pool.CreateFor("")
+}
+
+// CreateFor creates a session on the connection picked for key.
+func (pool *GatewayPool) CreateFor(key string) (*Session, error) {
+	gateway, err := pool.Gateway(key)
+	if err != nil {
+		return nil, err
+	}
+	return gateway.Create()
+}
+
+// CreateForCtx is like CreateFor but gives up with a *TimeoutError once ctx
+// is done.
+func (pool *GatewayPool) CreateForCtx(ctx context.Context, key string) (*Session, error) {
+	gateway, err := pool.Gateway(key)
+	if err != nil {
+		return nil, err
+	}
+	return gateway.CreateCtx(ctx)
+}
+
+// Gateways returns the connections opened so far.
+func (pool *GatewayPool) Gateways() []*Gateway {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	gateways := make([]*Gateway, len(pool.gateways))
+	copy(gateways, pool.gateways)
+	return gateways
+}
+
+// TransactionStats adds up the transaction counters of every connection.
+func (pool *GatewayPool) TransactionStats() TransactionStats {
+	total := TransactionStats{}
+	for _, gateway := range pool.Gateways() {
+		stats := gateway.TransactionStats()
+		total.Pending += stats.Pending
+		total.Completed += stats.Completed
+		total.Abandoned += stats.Abandoned
+		total.Expired += stats.Expired
+		total.Orphans += stats.Orphans
+		total.Failed += stats.Failed
+	}
+	return total
+}
+
+// Close closes every connection of the pool and returns the first error.
+func (pool *GatewayPool) Close() error {
+	var first error
+	for _, gateway := range pool.Gateways() {
+		if err := gateway.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
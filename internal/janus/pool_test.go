@@ -0,0 +1,72 @@
+package janus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GatewayPool_Strategies(t *testing.T) {
+	dial := func() (*Gateway, error) {
+		return NewGateway(newIdleTransport()), nil
+	}
+
+	roundRobin, err := NewGatewayPool(3, PoolRoundRobin, dial)
+	assert.NoError(t, err)
+	defer roundRobin.Close()
+
+	seen := map[*Gateway]bool{}
+	for i := 0; i < 3; i++ {
+		gateway, err := roundRobin.Gateway("")
+		assert.NoError(t, err)
+		seen[gateway] = true
+	}
+	assert.Len(t, seen, 3)
+
+	hash, err := NewGatewayPool(3, PoolHash, dial)
+	assert.NoError(t, err)
+	defer hash.Close()
+
+	first, _ := hash.Gateway("room/publisher/1")
+	again, _ := hash.Gateway("room/publisher/1")
+	assert.Same(t, first, again)
+
+	perSession, err := NewGatewayPool(0, PoolPerSession, dial)
+	assert.NoError(t, err)
+	defer perSession.Close()
+
+	first, _ = perSession.Gateway("")
+	second, _ := perSession.Gateway("")
+	assert.NotSame(t, first, second)
+	assert.Len(t, perSession.Gateways(), 2)
+
+	_, err = NewGatewayPool(0, PoolRoundRobin, dial)
+	assert.Error(t, err)
+}
+
+// idleTransport is connected but never receives anything.
+type idleTransport struct {
+	closed chan struct{}
+}
+
+func newIdleTransport() *idleTransport {
+	return &idleTransport{closed: make(chan struct{})}
+}
+
+func (transport *idleTransport) Write(data []byte) error {
+	return nil
+}
+
+func (transport *idleTransport) Read() ([]byte, error) {
+	<-transport.closed
+	return nil, errTransportClosed
+}
+
+func (transport *idleTransport) Close() error {
+	select {
+	case <-transport.closed:
+	default:
+		close(transport.closed)
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package janus
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	ReconnectDisconnected = "disconnected"
+	ReconnectSucceeded    = "reconnected"
+	ReconnectFailed       = "failed"
+
+	reconnectEventBuffer = 16
+)
+
+// ReconnectPolicy controls how a Gateway recovers a dropped connection. Zero
+// fields fall back to the values of DefaultReconnectPolicy.
+type ReconnectPolicy struct {
+	// MaxAttempts is how many times to redial before giving up, zero means
+	// use the default. Negative retries forever.
+	MaxAttempts int
+
+	// InitialBackoff is the wait before the first redial. It grows by
+	// Multiplier after every failed attempt, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	// ClaimTimeout bounds the claim request sent for each session.
+	ClaimTimeout time.Duration
+}
+
+var DefaultReconnectPolicy = ReconnectPolicy{
+	MaxAttempts:    10,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	Multiplier:     2,
+	ClaimTimeout:   10 * time.Second,
+}
+
+func (policy ReconnectPolicy) withDefaults() ReconnectPolicy {
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = DefaultReconnectPolicy.MaxAttempts
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = DefaultReconnectPolicy.InitialBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = DefaultReconnectPolicy.MaxBackoff
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = DefaultReconnectPolicy.Multiplier
+	}
+	if policy.ClaimTimeout <= 0 {
+		policy.ClaimTimeout = DefaultReconnectPolicy.ClaimTimeout
+	}
+	return policy
+}
+
+func (policy ReconnectPolicy) next(backoff time.Duration) time.Duration {
+	backoff = time.Duration(float64(backoff) * policy.Multiplier)
+	if backoff > policy.MaxBackoff {
+		return policy.MaxBackoff
+	}
+	return backoff
+}
+
+// ReconnectEvent reports the progress of a connection recovery. A recovery
+// raises ReconnectDisconnected when the connection drops, then either
+// ReconnectSucceeded or ReconnectFailed.
+type ReconnectEvent struct {
+	State string
+
+	// Attempt is the number of redials made so far.
+	Attempt int
+
+	// Err is the error that dropped the connection, or on ReconnectFailed
+	// the error of the last redial.
+	Err error
+
+	// Downtime is the time from the connection dropping until every session
+	// was claimed and the held back requests were resent.
+	Downtime time.Duration
+
+	// Claimed and Lost list the sessions Janus did and did not give back.
+	Claimed []uint64
+	Lost    []uint64
+
+	// Resent is the number of requests still waiting for an answer that
+	// were sent again on the new connection.
+	Resent int
+}
+
+var errNoDialer = errors.New("gateway was not dialed, it cannot reconnect")
+
+// EnableReconnect makes the Gateway redial with backoff whenever the
+// connection drops, claim every session in Sessions so their handles survive
+// and resend the requests that were left unanswered. Only a Gateway created
+// with DialGateway, or one of the ...Connect functions, can reconnect.
+func (gateway *Gateway) EnableReconnect(policy ReconnectPolicy) error {
+	if gateway.dial == nil {
+		return errNoDialer
+	}
+
+	policy = policy.withDefaults()
+	gateway.Lock()
+	gateway.reconnectPolicy = &policy
+	gateway.Unlock()
+	return nil
+}
+
+// ReconnectEvents returns the channel reconnect progress is reported on.
+// Events are dropped when nobody keeps up with reading them.
+func (gateway *Gateway) ReconnectEvents() <-chan ReconnectEvent {
+	return gateway.reconnectEvents
+}
+
+func (gateway *Gateway) canReconnect() bool {
+	gateway.Lock()
+	defer gateway.Unlock()
+	return gateway.reconnectPolicy != nil && !gateway.closing
+}
+
+// reconnect is called by the receive loop when reading fails. It redials
+// and, once connected, hands the new transport to the receive loop while the
+// sessions are claimed in the background. It reports false when the
+// connection should be given up.
+func (gateway *Gateway) reconnect(cause error) bool {
+	gateway.Lock()
+	if gateway.reconnectPolicy == nil || gateway.closing {
+		gateway.Unlock()
+		return false
+	}
+	policy := *gateway.reconnectPolicy
+	gateway.reconnecting = true
+	gateway.Unlock()
+
+	dropped := time.Now()
+	gateway.emit(ReconnectEvent{State: ReconnectDisconnected, Err: cause})
+
+	backoff := policy.InitialBackoff
+	err := cause
+	attempt := 0
+	for policy.MaxAttempts < 0 || attempt < policy.MaxAttempts {
+		attempt++
+		time.Sleep(backoff)
+		backoff = policy.next(backoff)
+
+		if !gateway.canReconnect() {
+			break
+		}
+
+		var transport Transport
+		transport, err = gateway.dial()
+		if err != nil {
+			continue
+		}
+
+		gateway.Lock()
+		old := gateway.transport
+		gateway.transport = transport
+		gateway.Unlock()
+		old.Close()
+
+		go gateway.reclaim(policy, dropped, attempt, cause)
+		return true
+	}
+
+	gateway.Lock()
+	gateway.reconnecting = false
+	gateway.Unlock()
+
+	gateway.emit(ReconnectEvent{State: ReconnectFailed, Attempt: attempt, Err: err, Downtime: time.Since(dropped)})
+	return false
+}
+
+// reclaim claims the sessions on the new connection, then resends whatever
+// was still waiting for an answer, including requests held back meanwhile.
+func (gateway *Gateway) reclaim(policy ReconnectPolicy, dropped time.Time, attempt int, cause error) {
+	gateway.Lock()
+	sessions := make([]*Session, 0, len(gateway.Sessions))
+	for _, session := range gateway.Sessions {
+		sessions = append(sessions, session)
+	}
+	gateway.Unlock()
+
+	event := ReconnectEvent{State: ReconnectSucceeded, Attempt: attempt, Err: cause}
+	for _, session := range sessions {
+		ctx, cancel := context.WithTimeout(context.Background(), policy.ClaimTimeout)
+		err := session.claim(ctx)
+		cancel()
+
+		if err != nil {
+			if errMsg, ok := err.(*ErrorMsg); ok && errMsg.Err.Code == errorSessionNotFound {
+				gateway.expireSession(session)
+			}
+			event.Lost = append(event.Lost, session.ID)
+			continue
+		}
+		event.Claimed = append(event.Claimed, session.ID)
+	}
+
+	gateway.Lock()
+	gateway.reconnecting = false
+	transport := gateway.transport
+	gateway.Unlock()
+
+	// a request written meanwhile is only resent if its write did not hand
+	// it to the new connection first
+	pending := gateway.transactions.resend(transport)
+
+	for _, data := range pending {
+		if err := transport.Write(data); err == nil {
+			event.Resent++
+		}
+	}
+
+	event.Downtime = time.Since(dropped)
+	gateway.emit(event)
+}
+
+func (gateway *Gateway) emit(event ReconnectEvent) {
+	select {
+	case gateway.reconnectEvents <- event:
+	default:
+	}
+}
+
+// claim moves the session over to the current connection, so Janus delivers
+// its events there again.
+func (session *Session) claim(ctx context.Context) error {
+	req, ch := newRequest("claim")
+	req["session_id"] = session.ID
+	if session.token != "" {
+		req["token"] = session.token
+	}
+	id, err := session.gateway.write(req, ch, true)
+	if err != nil {
+		return err
+	}
+
+	msg, err := session.gateway.wait(ctx, "claim", id, ch)
+	if err != nil {
+		return err
+	}
+	switch msg := msg.(type) {
+	case *SuccessMsg:
+		session.gateway.watchSession(session.ID, session.token)
+		return nil
+	case *ErrorMsg:
+		return msg
+	}
+
+	return unexpected("claim")
+}
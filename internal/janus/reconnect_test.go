@@ -0,0 +1,188 @@
+package janus
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ReconnectClaimsSessions(t *testing.T) {
+	var connections int32
+	upgrader := websocket.Upgrader{Subprotocols: []string{WebsocketSubProtocol}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		first := atomic.AddInt32(&connections, 1) == 1
+
+		for {
+			req := map[string]interface{}{}
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+
+			reply := map[string]interface{}{"transaction": req["transaction"], "janus": "ack"}
+			switch req["janus"] {
+			case "create":
+				reply["janus"] = "success"
+				reply["data"] = map[string]interface{}{"id": 1}
+			case "claim":
+				reply["janus"] = "success"
+				reply["session_id"] = req["session_id"]
+			}
+			conn.WriteJSON(reply)
+
+			// drop the first connection right after the session was created
+			if first && req["janus"] == "create" {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	client, err := WsConnect("ws" + strings.TrimPrefix(server.URL, "http"))
+	assert.NoError(t, err)
+	defer client.Close()
+	client.SetRequestTimeout(2 * time.Second)
+
+	err = client.EnableReconnect(ReconnectPolicy{InitialBackoff: 10 * time.Millisecond})
+	assert.NoError(t, err)
+
+	session, err := client.Create()
+	assert.NoError(t, err)
+
+	events := client.ReconnectEvents()
+	assert.Equal(t, ReconnectDisconnected, (<-events).State)
+
+	recovered := <-events
+	assert.Equal(t, ReconnectSucceeded, recovered.State)
+	assert.Equal(t, []uint64{session.ID}, recovered.Claimed)
+	assert.Empty(t, recovered.Lost)
+
+	_, err = session.KeepAlive()
+	assert.NoError(t, err)
+}
+
+func Test_ReconnectWritesOnce(t *testing.T) {
+	old := newPipeTransport()
+	old.gate = make(chan struct{})
+	recovered := newPipeTransport()
+	dialed := make(chan struct{})
+	transports := []*pipeTransport{old, recovered}
+	gateway, err := DialGateway(func() (Transport, error) {
+		transport := transports[0]
+		if transport == recovered {
+			<-dialed
+		}
+		transports = transports[1:]
+		return transport, nil
+	})
+	assert.NoError(t, err)
+	defer gateway.Close()
+	gateway.SetRequestTimeout(2 * time.Second)
+	assert.NoError(t, gateway.EnableReconnect(ReconnectPolicy{InitialBackoff: time.Millisecond}))
+
+	info := func(wg *sync.WaitGroup) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := gateway.Info()
+			assert.NoError(t, err)
+		}()
+	}
+	pending := func(count int) {
+		assert.Eventually(t, func() bool { return gateway.TransactionStats().Pending == count }, time.Second, time.Millisecond)
+	}
+
+	// one request is stuck writing to the connection as it drops, another
+	// is written while it is being recovered
+	wg := &sync.WaitGroup{}
+	info(wg)
+	pending(1)
+	old.Close()
+	assert.Equal(t, ReconnectDisconnected, (<-gateway.ReconnectEvents()).State)
+	info(wg)
+	pending(2)
+
+	close(dialed)
+	event := <-gateway.ReconnectEvents()
+	assert.Equal(t, ReconnectSucceeded, event.State)
+	assert.Equal(t, 2, event.Resent)
+
+	// the stuck write fails now, the resend took care of its request already
+	close(old.gate)
+	wg.Wait()
+	assert.Len(t, recovered.written(), 2)
+	assert.Zero(t, gateway.TransactionStats().Orphans)
+}
+
+// pipeTransport answers every info request written to it. With a gate, a
+// write blocks until the gate is closed and then fails, like one stuck on a
+// dropped connection.
+type pipeTransport struct {
+	incoming  chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+	gate      chan struct{}
+
+	mu   sync.Mutex
+	sent [][]byte
+}
+
+func newPipeTransport() *pipeTransport {
+	return &pipeTransport{incoming: make(chan []byte, 16), closed: make(chan struct{})}
+}
+
+func (transport *pipeTransport) Write(data []byte) error {
+	if transport.gate != nil {
+		<-transport.gate
+		return errTransportClosed
+	}
+
+	transport.mu.Lock()
+	transport.sent = append(transport.sent, data)
+	transport.mu.Unlock()
+
+	req := map[string]interface{}{}
+	json.Unmarshal(data, &req)
+	reply, _ := json.Marshal(map[string]interface{}{"janus": "server_info", "transaction": req["transaction"]})
+	transport.incoming <- reply
+	return nil
+}
+
+func (transport *pipeTransport) Read() ([]byte, error) {
+	select {
+	case data := <-transport.incoming:
+		return data, nil
+	case <-transport.closed:
+		return nil, errTransportClosed
+	}
+}
+
+func (transport *pipeTransport) Close() error {
+	transport.closeOnce.Do(func() { close(transport.closed) })
+	return nil
+}
+
+func (transport *pipeTransport) written() [][]byte {
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	return transport.sent
+}
+
+func Test_EnableReconnect_NotDialed(t *testing.T) {
+	gateway := NewGateway(newHttpTransport("http://127.0.0.1:1/janus"))
+	defer gateway.Close()
+
+	assert.Error(t, gateway.EnableReconnect(DefaultReconnectPolicy))
+}
@@ -0,0 +1,413 @@
+package janus
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// ReadRecording loads the frames of a recording, which is the JSONL file a
+// JSONLTrace writes, sorted by time.
+func ReadRecording(path string) ([]Frame, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	frames := make([]Frame, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		frame := Frame{}
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			return nil, fmt.Errorf("%s:%d : %w", path, line, err)
+		}
+		frames = append(frames, frame)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(frames, func(i, j int) bool {
+		return frames[i].Time.Before(frames[j].Time)
+	})
+	return frames, nil
+}
+
+// ReplayOptions tunes Replay.
+type ReplayOptions struct {
+	// Speed scales the recorded pace, 2 replays twice as fast. Zero means 1.
+	Speed float64
+
+	// ReplyTimeout bounds the wait for each replayed request's answer, and
+	// for the answer that provides an id a later request refers to.
+	ReplyTimeout time.Duration
+}
+
+// ReplayMismatch is a request that Janus answered differently than in the
+// recording, e.g. with an error where the recording has a success.
+type ReplayMismatch struct {
+	Index    int    `json:"index"`
+	Request  string `json:"request"`
+	Recorded string `json:"recorded"`
+	Replayed string `json:"replayed"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// ReplayResult summarises a replay. Failed counts the requests that could not
+// be sent or that are missing some of their recorded answers.
+type ReplayResult struct {
+	Sent       int              `json:"sent"`
+	Answered   int              `json:"answered"`
+	Failed     int              `json:"failed"`
+	Mismatches []ReplayMismatch `json:"mismatches,omitempty"`
+}
+
+// replayer maps the ids of the recording onto the ids Janus hands out while
+// replaying. Sessions, handles and videoroom feeds share one id space, Janus
+// draws all of them at random.
+type replayer struct {
+	gateway *Gateway
+	options ReplayOptions
+
+	// replies holds the recorded inbound frames by transaction.
+	replies map[string][]Frame
+
+	mu     sync.Mutex
+	ids    map[uint64]uint64
+	ready  map[uint64]chan struct{}
+	result ReplayResult
+
+	// lost holds the recorded ids that will never be learned, because the
+	// request that created them failed, by the name of that request.
+	lost map[uint64]string
+}
+
+// Replay sends the outbound frames of a recording through gateway with their
+// original relative timing. Transactions are new, and session, handle and
+// feed ids are rewritten to the ones Janus returns on replay. Credentials are
+// redacted in recordings, so requests carry those of gateway instead. Only
+// signaling is replayed: recorded SDP is sent as is and no media flows.
+//
+// gateway should be dedicated to the replay, as the replayed sessions are
+// not registered on it.
+func Replay(ctx context.Context, gateway *Gateway, frames []Frame, options ReplayOptions) (*ReplayResult, error) {
+	if options.Speed <= 0 {
+		options.Speed = 1
+	}
+	if options.ReplyTimeout <= 0 {
+		options.ReplyTimeout = 10 * time.Second
+	}
+
+	replay := &replayer{
+		gateway: gateway,
+		options: options,
+		replies: make(map[string][]Frame),
+		ids:     make(map[uint64]uint64),
+		ready:   make(map[uint64]chan struct{}),
+		lost:    make(map[uint64]string),
+	}
+
+	outbound := make([]Frame, 0, len(frames))
+	for _, frame := range frames {
+		if frame.Direction == FrameOut {
+			outbound = append(outbound, frame)
+		} else if frame.Transaction != "" {
+			replay.replies[frame.Transaction] = append(replay.replies[frame.Transaction], frame)
+		}
+	}
+	if len(outbound) == 0 {
+		return &replay.result, nil
+	}
+
+	wg := &sync.WaitGroup{}
+	start := time.Now()
+	first := outbound[0].Time
+	for i, frame := range outbound {
+		offset := time.Duration(float64(frame.Time.Sub(first)) / options.Speed)
+		select {
+		case <-time.After(time.Until(start.Add(offset))):
+		case <-ctx.Done():
+			wg.Wait()
+			return &replay.result, ctx.Err()
+		}
+
+		msg, err := replay.rewrite(ctx, frame)
+		if err != nil {
+			replay.fail(i, frame, err)
+			replay.forget(frame)
+			continue
+		}
+
+		ch := make(chan interface{}, transactionBuffer)
+		id, err := gateway.send(msg, ch)
+		if err != nil {
+			replay.fail(i, frame, err)
+			replay.forget(frame)
+			continue
+		}
+
+		replay.mu.Lock()
+		replay.result.Sent++
+		replay.mu.Unlock()
+
+		wg.Add(1)
+		go func(i int, frame Frame) {
+			defer wg.Done()
+			defer replay.forget(frame)
+			replay.await(ctx, i, frame, func(ctx context.Context) (interface{}, error) {
+				return gateway.wait(ctx, frame.Janus, id, ch)
+			})
+		}(i, frame)
+	}
+
+	wg.Wait()
+	return &replay.result, nil
+}
+
+// rewrite decodes a recorded request and swaps its ids for the replayed ones.
+// Redacted credentials are dropped, the Gateway adds its own.
+func (replay *replayer) rewrite(ctx context.Context, frame Frame) (map[string]interface{}, error) {
+	msg := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(frame.Data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&msg); err != nil {
+		return nil, err
+	}
+	for _, field := range credentialFields {
+		if msg[field] == Redacted {
+			delete(msg, field)
+		}
+	}
+
+	for _, key := range []string{"session_id", "handle_id"} {
+		if err := replay.rewriteID(ctx, msg, key); err != nil {
+			return nil, err
+		}
+	}
+
+	if body, ok := msg["body"].(map[string]interface{}); ok {
+		for _, key := range []string{"feed", "publisher_id"} {
+			if err := replay.rewriteID(ctx, body, key); err != nil {
+				return nil, err
+			}
+		}
+
+		streams, _ := body["streams"].([]interface{})
+		for _, stream := range streams {
+			if stream, ok := stream.(map[string]interface{}); ok {
+				if err := replay.rewriteID(ctx, stream, "feed"); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return msg, nil
+}
+
+func (replay *replayer) rewriteID(ctx context.Context, object map[string]interface{}, key string) error {
+	number, ok := object[key].(json.Number)
+	if !ok {
+		return nil
+	}
+	recorded, err := strconv.ParseUint(number.String(), 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	replayed, err := replay.lookup(ctx, recorded)
+	if err != nil {
+		return fmt.Errorf("%s %d : %w", key, recorded, err)
+	}
+	object[key] = replayed
+	return nil
+}
+
+// lookup waits for the replayed id of a recorded one, which is known once
+// the answer to the create, attach or join that produced it has arrived. It
+// fails right away once that request has failed.
+func (replay *replayer) lookup(ctx context.Context, recorded uint64) (uint64, error) {
+	replay.mu.Lock()
+	replayed, err := replay.known(recorded)
+	if replayed != 0 || err != nil {
+		replay.mu.Unlock()
+		return replayed, err
+	}
+	ready := replay.readyChan(recorded)
+	replay.mu.Unlock()
+
+	timer := time.NewTimer(replay.options.ReplyTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-ready:
+		replay.mu.Lock()
+		defer replay.mu.Unlock()
+		return replay.known(recorded)
+	case <-timer.C:
+		return 0, fmt.Errorf("no replayed id after %s", replay.options.ReplyTimeout)
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// known returns the replayed id of recorded, or an error when it is lost,
+// replay.mu must be held.
+func (replay *replayer) known(recorded uint64) (uint64, error) {
+	if replayed, ok := replay.ids[recorded]; ok {
+		return replayed, nil
+	}
+	if request, ok := replay.lost[recorded]; ok {
+		return 0, fmt.Errorf("its %s failed", request)
+	}
+	return 0, nil
+}
+
+func (replay *replayer) readyChan(recorded uint64) chan struct{} {
+	ready, ok := replay.ready[recorded]
+	if !ok {
+		ready = make(chan struct{})
+		replay.ready[recorded] = ready
+	}
+	return ready
+}
+
+func (replay *replayer) learn(recorded, replayed uint64) {
+	if recorded == 0 || replayed == 0 {
+		return
+	}
+
+	replay.mu.Lock()
+	defer replay.mu.Unlock()
+
+	if _, ok := replay.ids[recorded]; ok {
+		return
+	}
+	replay.ids[recorded] = replayed
+	if _, ok := replay.lost[recorded]; ok {
+		// another answer handed it out after all, ready is closed already
+		delete(replay.lost, recorded)
+		return
+	}
+	close(replay.readyChan(recorded))
+}
+
+// forget gives up on the ids the recorded answers of frame hand out and
+// that were not learned from the replayed ones, waking up their lookups.
+func (replay *replayer) forget(frame Frame) {
+	replay.mu.Lock()
+	defer replay.mu.Unlock()
+
+	for _, reply := range replay.replies[frame.Transaction] {
+		for _, path := range []string{"data.id", "plugindata.data.id"} {
+			recorded := gjson.GetBytes(reply.Data, path).Uint()
+			if recorded == 0 {
+				continue
+			}
+			if _, ok := replay.ids[recorded]; ok {
+				continue
+			}
+			if _, ok := replay.lost[recorded]; ok {
+				continue
+			}
+			replay.lost[recorded] = frame.Janus
+			close(replay.readyChan(recorded))
+		}
+	}
+}
+
+// await collects the answers to one replayed request, compares them with the
+// recorded ones and learns the ids they hand out. Answers are matched by type
+// rather than position, an event can overtake its ack on the HTTP transport.
+func (replay *replayer) await(ctx context.Context, index int, frame Frame, wait func(context.Context) (interface{}, error)) {
+	recorded := append([]Frame(nil), replay.replies[frame.Transaction]...)
+	answered := false
+
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, replay.options.ReplyTimeout)
+		msg, err := wait(waitCtx)
+		cancel()
+		if err != nil {
+			if !answered || len(recorded) > 0 {
+				replay.fail(index, frame, err)
+			}
+			return
+		}
+
+		if !answered {
+			answered = true
+			replay.mu.Lock()
+			replay.result.Answered++
+			replay.mu.Unlock()
+		}
+
+		recorded = replay.compare(index, frame, recorded, msg)
+		if isFinal(frame.Janus, msg) {
+			return
+		}
+	}
+}
+
+// compare looks for a recorded answer of the same type as msg, learns the ids
+// the pair hands out and returns the recorded answers still unmatched.
+func (replay *replayer) compare(index int, frame Frame, recorded []Frame, msg interface{}) []Frame {
+	replayed := messageType(msg)
+	for i, expected := range recorded {
+		if expected.Janus != replayed {
+			continue
+		}
+
+		switch msg := msg.(type) {
+		case *SuccessMsg:
+			replay.learn(gjson.GetBytes(expected.Data, "data.id").Uint(), msg.Data.ID)
+			if token := gjson.GetBytes(frame.Data, "token").String(); frame.Janus == "create" {
+				if token == Redacted {
+					token = ""
+				}
+				replay.gateway.watchSession(msg.Data.ID, token)
+			}
+		case *EventMsg:
+			if feed, ok := msg.Plugindata.Data["id"].(json.Number); ok {
+				id, _ := strconv.ParseUint(feed.String(), 10, 64)
+				replay.learn(gjson.GetBytes(expected.Data, "plugindata.data.id").Uint(), id)
+			}
+		}
+		return append(recorded[:i], recorded[i+1:]...)
+	}
+
+	mismatch := ReplayMismatch{Index: index, Request: frame.Janus, Replayed: replayed}
+	if len(recorded) > 0 {
+		mismatch.Recorded = recorded[0].Janus
+	}
+	if errMsg, ok := msg.(*ErrorMsg); ok {
+		mismatch.Reason = errMsg.Error()
+	}
+
+	replay.mu.Lock()
+	replay.result.Mismatches = append(replay.result.Mismatches, mismatch)
+	replay.mu.Unlock()
+	return recorded
+}
+
+func (replay *replayer) fail(index int, frame Frame, err error) {
+	replay.mu.Lock()
+	defer replay.mu.Unlock()
+
+	replay.result.Failed++
+	replay.result.Mismatches = append(replay.result.Mismatches, ReplayMismatch{
+		Index:   index,
+		Request: frame.Janus,
+		Reason:  err.Error(),
+	})
+}
@@ -0,0 +1,94 @@
+package janus
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Replay(t *testing.T) {
+	recorded := newRestServer()
+	defer recorded.Close()
+
+	path := filepath.Join(t.TempDir(), "recording.jsonl")
+	trace, err := NewJSONLTrace(path)
+	assert.NoError(t, err)
+
+	client, err := HttpConnect(recorded.URL + "/janus")
+	assert.NoError(t, err)
+	client.SetLogger(NopLogger)
+	client.SetTraceSink(trace)
+
+	session, err := client.Create()
+	assert.NoError(t, err)
+	handle, err := session.Attach(VideoRoomPluginName)
+	assert.NoError(t, err)
+	_, err = handle.Message(map[string]interface{}{"request": "configure"}, nil)
+	assert.NoError(t, err)
+	_, err = session.Destroy()
+	assert.NoError(t, err)
+	client.Close()
+	assert.NoError(t, trace.Close())
+
+	frames, err := ReadRecording(path)
+	assert.NoError(t, err)
+
+	// the replay target hands out other ids than the recorded run got
+	target := newRestServerWithIDs(10, 20)
+	defer target.Close()
+
+	replayClient, err := HttpConnect(target.URL + "/janus")
+	assert.NoError(t, err)
+	defer replayClient.Close()
+	replayClient.SetLogger(NopLogger)
+
+	result, err := Replay(context.Background(), replayClient, frames, ReplayOptions{Speed: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, result.Sent)
+	assert.Equal(t, 4, result.Answered)
+	assert.Equal(t, 0, result.Failed)
+	assert.Empty(t, result.Mismatches)
+
+	target.mu.Lock()
+	defer target.mu.Unlock()
+	assert.Len(t, target.received, 4)
+	assert.Equal(t, "attach", target.received[1]["janus"])
+	assert.Equal(t, float64(10), target.received[1]["session_id"])
+	assert.Equal(t, "message", target.received[2]["janus"])
+	assert.Equal(t, float64(20), target.received[2]["handle_id"])
+}
+
+func Test_ReplayLostID(t *testing.T) {
+	replay := &replayer{
+		options: ReplayOptions{ReplyTimeout: time.Minute},
+		replies: map[string][]Frame{
+			"create": {{Direction: FrameIn, Janus: "success", Data: []byte(`{"janus":"success","data":{"id":1}}`)}},
+		},
+		ids:   make(map[uint64]uint64),
+		ready: make(map[uint64]chan struct{}),
+		lost:  make(map[uint64]string),
+	}
+
+	// a lookup waiting for the session is woken up when its create fails
+	done := make(chan error, 1)
+	go func() {
+		_, err := replay.lookup(context.Background(), 1)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	replay.forget(Frame{Janus: "create", Transaction: "create"})
+
+	select {
+	case err := <-done:
+		assert.EqualError(t, err, "its create failed")
+	case <-time.After(time.Second):
+		t.Fatal("lookup still waits for a lost id")
+	}
+
+	// and later lookups fail right away
+	_, err := replay.lookup(context.Background(), 1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,144 @@
+package janus
+
+import (
+	"context"
+)
+
+// RoomManager manages videoroom rooms through the Admin API message_plugin
+// request, so unlike the room requests of Handle it needs no session nor
+// handle kept alive. The requests and their errors are those of Handle.
+type RoomManager struct {
+	admin *Gateway
+}
+
+// NewRoomManager returns a RoomManager sending its requests over admin, a
+// gateway connected to the Admin API.
+func NewRoomManager(admin *Gateway) *RoomManager {
+	return &RoomManager{admin: admin}
+}
+
+func (manager *RoomManager) pluginRequest(ctx context.Context, body interface{}) (map[string]interface{}, error) {
+	response, err := manager.admin.MessagePluginCtx(ctx, VideoRoomPluginName, body)
+	if err != nil {
+		return nil, err
+	}
+	return response.Response, nil
+}
+
+func (manager *RoomManager) CreateRoom(req *CreateRoomRequest) error {
+	ctx, cancel := manager.admin.requestContext()
+	defer cancel()
+	return manager.CreateRoomCtx(ctx, req)
+}
+
+// CreateRoomCtx is like CreateRoom but gives up with a *TimeoutError once ctx is done.
+func (manager *RoomManager) CreateRoomCtx(ctx context.Context, req *CreateRoomRequest) error {
+	return createRoom(ctx, manager.pluginRequest, req)
+}
+
+func (manager *RoomManager) ExistsRoom(req *ExistsRoomRequest) (bool, error) {
+	ctx, cancel := manager.admin.requestContext()
+	defer cancel()
+	return manager.ExistsRoomCtx(ctx, req)
+}
+
+// ExistsRoomCtx is like ExistsRoom but gives up with a *TimeoutError once ctx is done.
+func (manager *RoomManager) ExistsRoomCtx(ctx context.Context, req *ExistsRoomRequest) (bool, error) {
+	return existsRoom(ctx, manager.pluginRequest, req)
+}
+
+func (manager *RoomManager) EditRoom(req *EditRoomRequest) error {
+	ctx, cancel := manager.admin.requestContext()
+	defer cancel()
+	return manager.EditRoomCtx(ctx, req)
+}
+
+// EditRoomCtx is like EditRoom but gives up with a *TimeoutError once ctx is done.
+func (manager *RoomManager) EditRoomCtx(ctx context.Context, req *EditRoomRequest) error {
+	return editRoom(ctx, manager.pluginRequest, req)
+}
+
+// Allowed runs the action of req on the tokens allowed to join a room, and
+// returns the tokens allowed after it, none once disabled.
+func (manager *RoomManager) Allowed(req *AllowedRequest) ([]string, error) {
+	ctx, cancel := manager.admin.requestContext()
+	defer cancel()
+	return manager.AllowedCtx(ctx, req)
+}
+
+// AllowedCtx is like Allowed but gives up with a *TimeoutError once ctx is done.
+func (manager *RoomManager) AllowedCtx(ctx context.Context, req *AllowedRequest) ([]string, error) {
+	return allowed(ctx, manager.pluginRequest, req)
+}
+
+func (manager *RoomManager) DestroyRoom(req *DestroyRoomRequest) error {
+	ctx, cancel := manager.admin.requestContext()
+	defer cancel()
+	return manager.DestroyRoomCtx(ctx, req)
+}
+
+// DestroyRoomCtx is like DestroyRoom but gives up with a *TimeoutError once ctx is done.
+func (manager *RoomManager) DestroyRoomCtx(ctx context.Context, req *DestroyRoomRequest) error {
+	return destroyRoom(ctx, manager.pluginRequest, req)
+}
+
+func (manager *RoomManager) RoomList() ([]Room, error) {
+	ctx, cancel := manager.admin.requestContext()
+	defer cancel()
+	return manager.RoomListCtx(ctx)
+}
+
+// RoomListCtx is like RoomList but gives up with a *TimeoutError once ctx is done.
+func (manager *RoomManager) RoomListCtx(ctx context.Context) ([]Room, error) {
+	return roomList(ctx, manager.pluginRequest)
+}
+
+// ListParticipants returns the publishers of a room, whether they are
+// sending media or not.
+func (manager *RoomManager) ListParticipants(roomID uint64) (Participants, error) {
+	ctx, cancel := manager.admin.requestContext()
+	defer cancel()
+	return manager.ListParticipantsCtx(ctx, roomID)
+}
+
+// ListParticipantsCtx is like ListParticipants but gives up with a *TimeoutError once ctx is done.
+func (manager *RoomManager) ListParticipantsCtx(ctx context.Context, roomID uint64) (Participants, error) {
+	return listParticipants(ctx, manager.pluginRequest, roomID)
+}
+
+// ListForwarders returns the publishers of a room that have RTP forwarders,
+// secret being the one of the room if it has one.
+func (manager *RoomManager) ListForwarders(roomID uint64, secret string) ([]PublisherForwarders, error) {
+	ctx, cancel := manager.admin.requestContext()
+	defer cancel()
+	return manager.ListForwardersCtx(ctx, roomID, secret)
+}
+
+// ListForwardersCtx is like ListForwarders but gives up with a *TimeoutError once ctx is done.
+func (manager *RoomManager) ListForwardersCtx(ctx context.Context, roomID uint64, secret string) ([]PublisherForwarders, error) {
+	return listForwarders(ctx, manager.pluginRequest, roomID, secret)
+}
+
+// RTPForward starts forwarding streams of a publisher, and returns the
+// forwarders Janus created, one per stream.
+func (manager *RoomManager) RTPForward(req *RTPForwardRequest) ([]RTPForwarder, error) {
+	ctx, cancel := manager.admin.requestContext()
+	defer cancel()
+	return manager.RTPForwardCtx(ctx, req)
+}
+
+// RTPForwardCtx is like RTPForward but gives up with a *TimeoutError once ctx is done.
+func (manager *RoomManager) RTPForwardCtx(ctx context.Context, req *RTPForwardRequest) ([]RTPForwarder, error) {
+	return rtpForward(ctx, manager.pluginRequest, req)
+}
+
+func (manager *RoomManager) StopRTPForward(req *StopRTPForwardRequest) error {
+	ctx, cancel := manager.admin.requestContext()
+	defer cancel()
+	return manager.StopRTPForwardCtx(ctx, req)
+}
+
+// StopRTPForwardCtx is like StopRTPForward but gives up with a *TimeoutError once ctx is done.
+func (manager *RoomManager) StopRTPForwardCtx(ctx context.Context, req *StopRTPForwardRequest) error {
+	return stopRTPForward(ctx, manager.pluginRequest, req)
+}
@@ -0,0 +1,51 @@
+package janus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RoomManager(t *testing.T) {
+	server := newFakeJanus(t)
+	admin, err := WsAdminConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer admin.Close()
+	manager := NewRoomManager(admin)
+
+	roomID := uint64(4321)
+	err = manager.CreateRoom(&CreateRoomRequest{Request: TypeCreate, Room: Room{RoomID: roomID, PublisherLimitCount: 3}})
+	assert.NoError(t, err)
+	err = manager.CreateRoom(&CreateRoomRequest{Request: TypeCreate, Room: Room{RoomID: roomID}})
+	assert.Error(t, err, "the room already exists")
+
+	exists, err := manager.ExistsRoom(&ExistsRoomRequest{Request: TypeExists, RoomID: roomID})
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	rooms, err := manager.RoomList()
+	assert.NoError(t, err)
+	ids := make([]uint64, 0, len(rooms))
+	for _, room := range rooms {
+		ids = append(ids, room.RoomID)
+	}
+	assert.Contains(t, ids, roomID)
+
+	handle, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+	joined, err := handle.JoinPublisher(&JoinPublisherRequest{Request: TypeJoin, RoomID: roomID, PeerType: TypePublisher, DisplayName: "alice"})
+	assert.NoError(t, err)
+
+	participants, err := manager.ListParticipants(roomID)
+	assert.NoError(t, err)
+	assert.Equal(t, Participants{{FeedID: joined.FeedID, DisplayName: "alice"}}, participants)
+
+	err = manager.DestroyRoom(&DestroyRoomRequest{Request: TypeDestroy, RoomID: roomID})
+	assert.NoError(t, err)
+	exists, err = manager.ExistsRoom(&ExistsRoomRequest{Request: TypeExists, RoomID: roomID})
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = manager.ListParticipants(roomID)
+	assert.Error(t, err, "no such room")
+}
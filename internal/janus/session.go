@@ -1,7 +1,10 @@
 package janus
 
 import (
+	"context"
 	"sync"
+
+	"github.com/rs/xid"
 )
 
 // Session represents a session instance on the Janus Gateway.
@@ -12,6 +15,8 @@ type Session struct {
 	// Handles is a map of plugin handles within this session
 	Handles map[uint64]*Handle
 
+	// Events receives the events about the session itself, such as the
+	// TimeoutMsg Janus sends when it expires the session.
 	Events chan interface{}
 
 	// Access to the Handles map should be synchronized with the Session.Lock()
@@ -19,34 +24,103 @@ type Session struct {
 	sync.Mutex
 
 	gateway *Gateway
+	token   string
+
+	done chan struct{}
+	err  error
+}
+
+// sessionEventsBuffer is the capacity of Session.Events.
+const sessionEventsBuffer = 8
+
+func newSession(gateway *Gateway, id uint64) *Session {
+	return &Session{
+		ID:      id,
+		Handles: make(map[uint64]*Handle),
+		Events:  make(chan interface{}, sessionEventsBuffer),
+		gateway: gateway,
+		done:    make(chan struct{}),
+	}
+}
+
+// Done returns a channel that is closed once the session is gone, destroyed
+// or expired by Janus. Err tells which.
+func (session *Session) Done() <-chan struct{} {
+	return session.done
+}
+
+// Err returns nil while the session is alive, then ErrSessionDestroyed or
+// ErrSessionExpired.
+func (session *Session) Err() error {
+	session.Lock()
+	defer session.Unlock()
+	return session.err
+}
+
+// end marks the session gone and reports whether it was still alive.
+func (session *Session) end(err error) bool {
+	session.Lock()
+	defer session.Unlock()
+
+	if session.err != nil {
+		return false
+	}
+	session.err = err
+	close(session.done)
+	return true
+}
+
+// Logger returns the logger of the Gateway with the session id attached.
+func (session *Session) Logger() Logger {
+	return session.gateway.Logger().With(F("session", session.ID))
 }
 
-func (session *Session) send(msg map[string]interface{}, transaction chan interface{}) {
+func (session *Session) send(msg map[string]interface{}, transaction chan interface{}) (xid.ID, error) {
+	if err := session.Err(); err != nil {
+		request, _ := msg["janus"].(string)
+		return xid.ID{}, &SessionError{Session: session.ID, Request: request, Err: err}
+	}
+
 	msg["session_id"] = session.ID
-	session.gateway.send(msg, transaction)
+	if session.token != "" {
+		msg["token"] = session.token
+	}
+	return session.gateway.send(msg, transaction)
 }
 
 // Attach sends an attach request to the Gateway within this session.
 // plugin should be the unique string of the plugin to attach to.
 // On success, a new Handle will be returned and error will be nil.
 func (session *Session) Attach(plugin string) (*Handle, error) {
+	ctx, cancel := session.gateway.requestContext()
+	defer cancel()
+	return session.AttachCtx(ctx, plugin)
+}
+
+// AttachCtx is like Attach but gives up with a *TimeoutError once ctx is done.
+func (session *Session) AttachCtx(ctx context.Context, plugin string) (*Handle, error) {
 	req, ch := newRequest("attach")
 	req["plugin"] = plugin
-	session.send(req, ch)
+	id, err := session.send(req, ch)
+	if err != nil {
+		return nil, err
+	}
 
 	var success *SuccessMsg
-	msg := <-ch
+	msg, err := session.gateway.wait(ctx, "attach", id, ch)
+	if err != nil {
+		return nil, err
+	}
 	switch msg := msg.(type) {
 	case *SuccessMsg:
 		success = msg
 	case *ErrorMsg:
 		return nil, msg
+	default:
+		return nil, unexpected("attach")
 	}
 
-	handle := new(Handle)
-	handle.session = session
-	handle.ID = success.Data.ID
-	handle.Events = make(chan interface{}, 8)
+	handle := newHandle(session, success.Data.ID)
 
 	session.Lock()
 	session.Handles[handle.ID] = handle
@@ -58,10 +132,24 @@ func (session *Session) Attach(plugin string) (*Handle, error) {
 // KeepAlive sends a keep-alive request to the Gateway.
 // On success, an AckMsg will be returned and error will be nil.
 func (session *Session) KeepAlive() (*AckMsg, error) {
+	ctx, cancel := session.gateway.requestContext()
+	defer cancel()
+	return session.KeepAliveCtx(ctx)
+}
+
+// KeepAliveCtx is like KeepAlive but gives up with a *TimeoutError once ctx
+// is done.
+func (session *Session) KeepAliveCtx(ctx context.Context) (*AckMsg, error) {
 	req, ch := newRequest("keepalive")
-	session.send(req, ch)
+	id, err := session.send(req, ch)
+	if err != nil {
+		return nil, err
+	}
 
-	msg := <-ch
+	msg, err := session.gateway.wait(ctx, "keepalive", id, ch)
+	if err != nil {
+		return nil, err
+	}
 	switch msg := msg.(type) {
 	case *AckMsg:
 		return msg, nil
@@ -76,22 +164,99 @@ func (session *Session) KeepAlive() (*AckMsg, error) {
 // On success, the Session will be removed from the Gateway.Sessions map, an
 // AckMsg will be returned and error will be nil.
 func (session *Session) Destroy() (*AckMsg, error) {
+	ctx, cancel := session.gateway.requestContext()
+	defer cancel()
+	return session.DestroyCtx(ctx)
+}
+
+// DestroyCtx is like Destroy but gives up with a *TimeoutError once ctx is
+// done. The session stays in Gateway.Sessions when the request times out.
+func (session *Session) DestroyCtx(ctx context.Context) (*AckMsg, error) {
 	req, ch := newRequest("destroy")
-	session.send(req, ch)
+	id, err := session.send(req, ch)
+	if err != nil {
+		return nil, err
+	}
 
 	var ack *AckMsg
-	msg := <-ch
+	msg, err := session.gateway.wait(ctx, "destroy", id, ch)
+	if err != nil {
+		return nil, err
+	}
 	switch msg := msg.(type) {
 	case *AckMsg:
 		ack = msg
+	case *SuccessMsg:
+		// Janus answers destroy with success, only some older gateways ack it
+		ack = &AckMsg{}
 	case *ErrorMsg:
 		return nil, msg
+	default:
+		return nil, unexpected("destroy")
 	}
 
 	// Remove this session from the gateway
+	session.end(ErrSessionDestroyed)
 	session.gateway.Lock()
 	delete(session.gateway.Sessions, session.ID)
 	session.gateway.Unlock()
+	session.closeHandles()
+
+	if watcher, ok := session.gateway.currentTransport().(sessionWatcher); ok {
+		watcher.UnwatchSession(session.ID)
+	}
 
 	return ack, nil
 }
+
+// closeHandles stops the event delivery of every handle of the session.
+func (session *Session) closeHandles() {
+	session.Lock()
+	defer session.Unlock()
+
+	for _, handle := range session.Handles {
+		handle.close()
+	}
+}
+
+// sessionEvent passes an event without a handle on to its session. A timeout
+// first expires the session.
+func (gateway *Gateway) sessionEvent(id uint64, msg interface{}) {
+	gateway.Lock()
+	session := gateway.Sessions[id]
+	gateway.Unlock()
+	if session == nil {
+		gateway.Logger().Debug("unable to deliver message, session gone?", F("janus", messageType(msg)), F("session", id))
+		return
+	}
+
+	if _, ok := msg.(*TimeoutMsg); ok {
+		gateway.expireSession(session)
+	}
+
+	select {
+	case session.Events <- msg:
+	default:
+		session.Logger().Debug("session events not read, event dropped", F("janus", messageType(msg)))
+	}
+}
+
+// expireSession drops a session Janus no longer knows: its pending requests
+// fail with ErrSessionExpired, and so do the ones sent on it later.
+func (gateway *Gateway) expireSession(session *Session) {
+	if !session.end(ErrSessionExpired) {
+		return
+	}
+
+	gateway.Lock()
+	delete(gateway.Sessions, session.ID)
+	gateway.Unlock()
+
+	if watcher, ok := gateway.currentTransport().(sessionWatcher); ok {
+		watcher.UnwatchSession(session.ID)
+	}
+
+	failed := gateway.transactions.failSession(session.ID, ErrSessionExpired)
+	session.closeHandles()
+	session.Logger().Warn("session expired by janus", F("failed_requests", failed))
+}
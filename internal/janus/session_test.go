@@ -0,0 +1,92 @@
+package janus
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SessionExpired(t *testing.T) {
+	server := newFakeJanus(t)
+	client, err := WsConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer client.Close()
+	client.SetLogger(NopLogger)
+
+	session, err := client.Create()
+	assert.NoError(t, err)
+	_, err = session.Attach(VideoRoomPluginName)
+	assert.NoError(t, err)
+
+	server.ExpireSession(session.ID)
+
+	select {
+	case msg := <-session.Events:
+		assert.IsType(t, &TimeoutMsg{}, msg)
+	case <-time.After(time.Second):
+		t.Fatal("timeout was not delivered to the session")
+	}
+	select {
+	case <-session.Done():
+	case <-time.After(time.Second):
+		t.Fatal("session was not ended")
+	}
+	assert.ErrorIs(t, session.Err(), ErrSessionExpired)
+
+	client.Lock()
+	assert.NotContains(t, client.Sessions, session.ID)
+	client.Unlock()
+
+	_, err = session.KeepAlive()
+	var sessionErr *SessionError
+	assert.True(t, errors.As(err, &sessionErr))
+	assert.Equal(t, "keepalive", sessionErr.Request)
+	assert.ErrorIs(t, err, ErrSessionExpired)
+}
+
+func Test_SessionDestroyed(t *testing.T) {
+	server := newFakeJanus(t)
+	client, err := WsConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	session, err := client.Create()
+	assert.NoError(t, err)
+	_, err = session.Destroy()
+	assert.NoError(t, err)
+
+	<-session.Done()
+	assert.ErrorIs(t, session.Err(), ErrSessionDestroyed)
+	assert.Empty(t, server.Sessions())
+}
+
+func Test_CreateWithToken(t *testing.T) {
+	server := newFakeJanus(t)
+	server.TokenAuth = true
+	server.AddToken("gateway")
+	server.AddToken("participant")
+
+	client, err := Connect(WithURL(server.WebsocketURL()), WithToken("gateway"))
+	assert.NoError(t, err)
+	defer client.Close()
+
+	session, err := client.CreateWithToken("participant")
+	assert.NoError(t, err)
+
+	// the session keeps using its own token
+	server.RemoveToken("gateway")
+	_, err = session.Attach(VideoRoomPluginName)
+	assert.NoError(t, err)
+
+	server.RemoveToken("participant")
+	_, err = session.KeepAlive()
+	assert.True(t, IsUnauthorized(err))
+
+	_, err = client.Create()
+	var unauthorized *UnauthorizedError
+	assert.True(t, errors.As(err, &unauthorized))
+	assert.Equal(t, "create", unauthorized.Request)
+	assert.Equal(t, 403, unauthorized.Code)
+}
@@ -0,0 +1,163 @@
+package janus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ShutdownSummary tells what Shutdown cleaned up on the server and what it
+// could not.
+type ShutdownSummary struct {
+	Left      int `json:"left"`
+	Detached  int `json:"detached"`
+	Destroyed int `json:"destroyed"`
+
+	Failures []ShutdownFailure `json:"failures,omitempty"`
+
+	mu sync.Mutex
+}
+
+// ShutdownFailure is a leave, detach or destroy request that failed, leaving
+// the participant, handle or session behind on the server until Janus times
+// the session out.
+type ShutdownFailure struct {
+	Session uint64 `json:"session_id"`
+	Handle  uint64 `json:"handle_id,omitempty"`
+	Request string `json:"request"`
+	Err     error  `json:"-"`
+	Error   string `json:"error"`
+}
+
+// Clean reports whether everything was cleaned up.
+func (summary *ShutdownSummary) Clean() bool {
+	return len(summary.Failures) == 0
+}
+
+// String is a one line account of the shutdown.
+func (summary *ShutdownSummary) String() string {
+	return fmt.Sprintf("%d left, %d detached, %d destroyed, %d failed",
+		summary.Left, summary.Detached, summary.Destroyed, len(summary.Failures))
+}
+
+// Add merges other into the summary, for the connections of a pool.
+func (summary *ShutdownSummary) Add(other *ShutdownSummary) {
+	summary.mu.Lock()
+	defer summary.mu.Unlock()
+
+	summary.Left += other.Left
+	summary.Detached += other.Detached
+	summary.Destroyed += other.Destroyed
+	summary.Failures = append(summary.Failures, other.Failures...)
+}
+
+func (summary *ShutdownSummary) count(field *int) {
+	summary.mu.Lock()
+	*field++
+	summary.mu.Unlock()
+}
+
+func (summary *ShutdownSummary) fail(session, handle uint64, request string, err error) {
+	summary.mu.Lock()
+	summary.Failures = append(summary.Failures, ShutdownFailure{
+		Session: session,
+		Handle:  handle,
+		Request: request,
+		Err:     err,
+		Error:   err.Error(),
+	})
+	summary.mu.Unlock()
+}
+
+// Shutdown tears down everything the Gateway created on the server, then
+// closes it. Each session has its handles leave the room they joined and
+// detached before it is destroyed, the sessions in parallel. Requests still
+// unanswered when ctx is done are reported as failures, and the Gateway is
+// closed anyway.
+func (gateway *Gateway) Shutdown(ctx context.Context) *ShutdownSummary {
+	gateway.Lock()
+	sessions := make([]*Session, 0, len(gateway.Sessions))
+	for _, session := range gateway.Sessions {
+		sessions = append(sessions, session)
+	}
+	gateway.Unlock()
+
+	summary := &ShutdownSummary{}
+	wg := sync.WaitGroup{}
+	for _, session := range sessions {
+		wg.Add(1)
+		go func(session *Session) {
+			defer wg.Done()
+			session.shutdown(ctx, summary)
+		}(session)
+	}
+	wg.Wait()
+
+	if err := gateway.Close(); err != nil {
+		gateway.Logger().Debug("close after shutdown failed", F("error", err))
+	}
+	return summary
+}
+
+func (session *Session) shutdown(ctx context.Context, summary *ShutdownSummary) {
+	if session.Err() != nil {
+		// expired by Janus, nothing is left of it
+		return
+	}
+
+	session.Lock()
+	handles := make([]*Handle, 0, len(session.Handles))
+	for _, handle := range session.Handles {
+		handles = append(handles, handle)
+	}
+	session.Unlock()
+
+	for _, handle := range handles {
+		handle.shutdown(ctx, summary)
+	}
+
+	if _, err := session.DestroyCtx(ctx); err != nil {
+		summary.fail(session.ID, 0, "destroy", err)
+		return
+	}
+	summary.count(&summary.Destroyed)
+}
+
+func (handle *Handle) shutdown(ctx context.Context, summary *ShutdownSummary) {
+	if joined := handle.joined(); joined != "" {
+		var err error
+		if joined == TypePublisher {
+			err = handle.LeavePublisherCtx(ctx, &LeaveRequest{Request: TypeLeave})
+		} else {
+			err = handle.LeaveSubscriberCtx(ctx, &LeaveRequest{Request: TypeLeave})
+		}
+
+		if err != nil {
+			summary.fail(handle.session.ID, handle.ID, "leave", err)
+		} else {
+			summary.count(&summary.Left)
+		}
+	}
+
+	if _, err := handle.DetachCtx(ctx); err != nil {
+		summary.fail(handle.session.ID, handle.ID, "detach", err)
+		return
+	}
+	summary.count(&summary.Detached)
+}
+
+// Shutdown shuts every connection of the pool down at the same time, see
+// Gateway.Shutdown.
+func (pool *GatewayPool) Shutdown(ctx context.Context) *ShutdownSummary {
+	summary := &ShutdownSummary{}
+	wg := sync.WaitGroup{}
+	for _, gateway := range pool.Gateways() {
+		wg.Add(1)
+		go func(gateway *Gateway) {
+			defer wg.Done()
+			summary.Add(gateway.Shutdown(ctx))
+		}(gateway)
+	}
+	wg.Wait()
+	return summary
+}
@@ -0,0 +1,79 @@
+package janus
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hwanse/janus-tester/internal/fakejanus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Shutdown(t *testing.T) {
+	server := newFakeJanus(t)
+	client, err := WsConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+
+	publisherSession, err := client.Create()
+	assert.NoError(t, err)
+	publisher, err := publisherSession.Attach(VideoRoomPluginName)
+	assert.NoError(t, err)
+	joined, err := publisher.JoinPublisher(&JoinPublisherRequest{Request: TypeJoin, RoomID: fakejanus.DefaultRoom, PeerType: TypePublisher})
+	assert.NoError(t, err)
+	assert.Equal(t, TypePublisher, publisher.Joined())
+	pc, offer := newTestPeer(t, true)
+	defer pc.Close()
+	_, err = publisher.Publish(&PublishRequest{Request: TypePublish}, offer)
+	assert.NoError(t, err)
+
+	subscriberSession, err := client.Create()
+	assert.NoError(t, err)
+	subscriber, err := subscriberSession.Attach(VideoRoomPluginName)
+	assert.NoError(t, err)
+	_, err = subscriber.JoinSubscriber(&JoinSubscriberRequest{
+		Request:  TypeJoin,
+		RoomID:   fakejanus.DefaultRoom,
+		PeerType: TypeSubscriber,
+		Streams:  []Stream{{FeedID: joined.FeedID}},
+	})
+	assert.NoError(t, err)
+	_, err = subscriberSession.Attach(VideoRoomPluginName)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	summary := client.Shutdown(ctx)
+
+	assert.True(t, summary.Clean(), summary.Failures)
+	assert.Equal(t, 2, summary.Left)
+	assert.Equal(t, 3, summary.Detached)
+	assert.Equal(t, 2, summary.Destroyed)
+	assert.Empty(t, server.Sessions())
+
+	_, err = client.Create()
+	assert.Error(t, err, "the gateway is closed")
+}
+
+func Test_Shutdown_Deadline(t *testing.T) {
+	server := newSilentServer(t)
+	defer server.Close()
+
+	client, err := WsConnect("ws" + strings.TrimPrefix(server.URL, "http"))
+	assert.NoError(t, err)
+
+	// a session the silent server never answers anything for
+	session := newSession(client, 1)
+	client.Lock()
+	client.Sessions[session.ID] = session
+	client.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	summary := client.Shutdown(ctx)
+
+	assert.False(t, summary.Clean())
+	assert.Len(t, summary.Failures, 1)
+	assert.Equal(t, "destroy", summary.Failures[0].Request)
+	assert.True(t, IsTimeout(summary.Failures[0].Err))
+}
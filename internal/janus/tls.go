@@ -0,0 +1,147 @@
+package janus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http/httptrace"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSOptions describe the TLS side of a wss:// or https:// connection, for a
+// Janus behind an ingress with a private CA or a self-signed certificate.
+type TLSOptions struct {
+	// CAFile is a PEM bundle of the CAs trusted besides the system ones.
+	CAFile string
+
+	// CertFile and KeyFile are the PEM client certificate and key presented
+	// for mutual TLS. Both or neither must be set.
+	CertFile string
+	KeyFile  string
+
+	// ServerName overrides the name sent with SNI and checked against the
+	// certificate of the server, by default the host of the URL.
+	ServerName string
+
+	// Insecure accepts any certificate the server presents.
+	Insecure bool
+}
+
+// Config builds the tls.Config described by the options.
+func (options TLSOptions) Config() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         options.ServerName,
+		InsecureSkipVerify: options.Insecure,
+	}
+
+	if options.CAFile != "" {
+		pem, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in '%s'", options.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if (options.CertFile == "") != (options.KeyFile == "") {
+		return nil, errors.New("client certificate and key must be given together")
+	}
+	if options.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// HandshakeTiming is how long the steps of opening a websocket connection, or
+// the first request over HTTP, took. TLS is zero for a ws:// or http:// URL.
+type HandshakeTiming struct {
+	// Connect is the TCP connection, through the proxy if there is one.
+	Connect time.Duration
+
+	// TLS is the TLS handshake.
+	TLS time.Duration
+
+	// Upgrade is from sending the upgrade request, or the first HTTP
+	// request, to the first byte of the answer.
+	Upgrade time.Duration
+
+	// Total is the whole dial.
+	Total time.Duration
+}
+
+// handshakeTimer is implemented by transports that time the opening of their
+// connection.
+type handshakeTimer interface {
+	HandshakeTiming() HandshakeTiming
+}
+
+// handshakeTrace records a HandshakeTiming through the client trace hooks of
+// the websocket dialer or of the first HTTP request.
+type handshakeTrace struct {
+	mu                sync.Mutex
+	start, conn       time.Time
+	dialed            time.Time
+	tlsStart, tlsDone time.Time
+	firstResponseByte time.Time
+}
+
+func newHandshakeTrace() *handshakeTrace {
+	return &handshakeTrace{start: time.Now()}
+}
+
+func (trace *handshakeTrace) clientTrace() *httptrace.ClientTrace {
+	mark := func(at *time.Time) {
+		trace.mu.Lock()
+		*at = time.Now()
+		trace.mu.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		GotConn:              func(httptrace.GotConnInfo) { mark(&trace.conn) },
+		ConnectDone:          func(string, string, error) { mark(&trace.dialed) },
+		TLSHandshakeStart:    func() { mark(&trace.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { mark(&trace.tlsDone) },
+		GotFirstResponseByte: func() { mark(&trace.firstResponseByte) },
+	}
+}
+
+// timing is called once the dial, or the request, returned.
+func (trace *handshakeTrace) timing() HandshakeTiming {
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+
+	timing := HandshakeTiming{Total: time.Since(trace.start)}
+	if trace.conn.IsZero() {
+		return timing
+	}
+	// net/http only hands out the connection after the TLS handshake, the
+	// websocket dialer does not report the dial itself
+	connected := trace.conn
+	if !trace.dialed.IsZero() {
+		connected = trace.dialed
+	}
+	timing.Connect = connected.Sub(trace.start)
+
+	sent := connected
+	if !trace.tlsDone.IsZero() {
+		timing.TLS = trace.tlsDone.Sub(trace.tlsStart)
+		sent = trace.tlsDone
+	}
+	if !trace.firstResponseByte.IsZero() {
+		timing.Upgrade = trace.firstResponseByte.Sub(sent)
+	}
+	return timing
+}
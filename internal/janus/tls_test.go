@@ -0,0 +1,85 @@
+package janus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Hwanse/janus-tester/internal/fakejanus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Connect_TLS(t *testing.T) {
+	server := fakejanus.NewTLSServer(nil)
+	defer server.Close()
+	caFile, _, _ := writeTestCertificate(t, server)
+
+	_, err := Connect(WithURL(server.WebsocketURL()))
+	assert.Error(t, err, "the self-signed certificate is not trusted")
+
+	config, err := TLSOptions{CAFile: caFile}.Config()
+	assert.NoError(t, err)
+	client, err := Connect(WithURL(server.WebsocketURL()), WithTLSConfig(config))
+	assert.NoError(t, err)
+	defer client.Close()
+	_, err = client.Info()
+	assert.NoError(t, err)
+
+	timing := client.HandshakeTiming()
+	assert.Greater(t, int64(timing.TLS), int64(0))
+	assert.GreaterOrEqual(t, int64(timing.Total), int64(timing.Connect+timing.TLS+timing.Upgrade))
+
+	config, err = TLSOptions{Insecure: true}.Config()
+	assert.NoError(t, err)
+	insecure, err := Connect(WithURL(server.WebsocketURL()), WithTLSConfig(config))
+	assert.NoError(t, err)
+	defer insecure.Close()
+
+	config, err = TLSOptions{CAFile: caFile, ServerName: "janus.invalid"}.Config()
+	assert.NoError(t, err)
+	_, err = Connect(WithURL(server.WebsocketURL()), WithTLSConfig(config))
+	assert.Error(t, err, "the certificate is not valid for the overridden name")
+}
+
+func Test_Connect_MutualTLS(t *testing.T) {
+	server := fakejanus.NewTLSServer(&tls.Config{ClientAuth: tls.RequireAnyClientCert})
+	defer server.Close()
+	caFile, certFile, keyFile := writeTestCertificate(t, server)
+
+	config, err := TLSOptions{CAFile: caFile}.Config()
+	assert.NoError(t, err)
+	_, err = Connect(WithURL(server.WebsocketURL()), WithTLSConfig(config))
+	assert.Error(t, err, "no client certificate presented")
+
+	config, err = TLSOptions{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}.Config()
+	assert.NoError(t, err)
+	client, err := Connect(WithURL(server.WebsocketURL()), WithTLSConfig(config))
+	assert.NoError(t, err)
+	defer client.Close()
+	_, err = client.Create()
+	assert.NoError(t, err)
+
+	_, err = TLSOptions{CertFile: certFile}.Config()
+	assert.Error(t, err)
+}
+
+// writeTestCertificate writes the certificate of server, which doubles as the
+// client certificate, and its key as PEM files.
+func writeTestCertificate(t *testing.T, server *fakejanus.Server) (caFile, certFile, keyFile string) {
+	dir := t.TempDir()
+	certificate := server.TLS.Certificates[0]
+
+	caFile = filepath.Join(dir, "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(caFile, certPEM, 0600))
+	certFile = caFile
+
+	key, err := x509.MarshalPKCS8PrivateKey(certificate.PrivateKey)
+	assert.NoError(t, err)
+	keyFile = filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0600))
+	return caFile, certFile, keyFile
+}
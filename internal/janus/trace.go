@@ -0,0 +1,124 @@
+package janus
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	FrameOut = "out"
+	FrameIn  = "in"
+
+	// Redacted replaces the credentials of a frame before it is traced or
+	// logged.
+	Redacted = "redacted"
+)
+
+// credentialFields are the request fields that are never written to a trace
+// or a log.
+var credentialFields = []string{"apisecret", "token", "admin_secret"}
+
+// Frame is a single Janus API message as it crossed the wire.
+type Frame struct {
+	Direction   string          `json:"dir"`
+	Time        time.Time       `json:"time"`
+	Session     uint64          `json:"session_id,omitempty"`
+	Handle      uint64          `json:"handle_id,omitempty"`
+	Transaction string          `json:"transaction,omitempty"`
+	Janus       string          `json:"janus"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// newFrame fills in the routing fields of a frame from the message itself.
+// Janus names the handle "handle_id" in requests and "sender" in replies.
+// data should be redacted already.
+func newFrame(direction string, data []byte) Frame {
+	fields := gjson.GetManyBytes(data, "session_id", "handle_id", "sender", "transaction", "janus")
+
+	frame := Frame{
+		Direction:   direction,
+		Time:        time.Now(),
+		Session:     fields[0].Uint(),
+		Handle:      fields[1].Uint(),
+		Transaction: fields[3].String(),
+		Janus:       fields[4].String(),
+		Data:        json.RawMessage(data),
+	}
+	if frame.Handle == 0 {
+		frame.Handle = fields[2].Uint()
+	}
+	return frame
+}
+
+// redact returns data with the value of every credential field replaced by
+// Redacted, or data itself when it carries none.
+func redact(data []byte) []byte {
+	for _, field := range credentialFields {
+		value := gjson.GetBytes(data, field)
+		if !value.Exists() {
+			continue
+		}
+
+		redacted := make([]byte, 0, len(data))
+		redacted = append(redacted, data[:value.Index]...)
+		redacted = append(redacted, `"`+Redacted+`"`...)
+		data = append(redacted, data[value.Index+len(value.Raw):]...)
+	}
+	return data
+}
+
+// TraceSink receives every frame a Gateway sends and receives. Trace is
+// called from several goroutines at once.
+type TraceSink interface {
+	Trace(frame Frame)
+}
+
+// JSONLTrace writes frames to a file, one JSON object per line.
+type JSONLTrace struct {
+	mu   sync.Mutex
+	file *os.File
+	out  *bufio.Writer
+	enc  *json.Encoder
+}
+
+// NewJSONLTrace creates, or truncates, the trace file at path.
+func NewJSONLTrace(path string) (*JSONLTrace, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	out := bufio.NewWriter(file)
+	return &JSONLTrace{file: file, out: out, enc: json.NewEncoder(out)}, nil
+}
+
+func (trace *JSONLTrace) Trace(frame Frame) {
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+
+	if trace.file == nil {
+		return
+	}
+	trace.enc.Encode(frame)
+}
+
+// Close flushes the buffered frames and closes the file.
+func (trace *JSONLTrace) Close() error {
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+
+	if trace.file == nil {
+		return nil
+	}
+	err := trace.out.Flush()
+	if closeErr := trace.file.Close(); err == nil {
+		err = closeErr
+	}
+	trace.file = nil
+	return err
+}
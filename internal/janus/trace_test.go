@@ -0,0 +1,117 @@
+package janus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_JSONLTrace(t *testing.T) {
+	server := newRestServer()
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	trace, err := NewJSONLTrace(path)
+	assert.NoError(t, err)
+
+	client, err := HttpConnect(server.URL + "/janus")
+	assert.NoError(t, err)
+	defer client.Close()
+	client.SetLogger(NopLogger)
+	client.SetTraceSink(trace)
+
+	session, err := client.Create()
+	assert.NoError(t, err)
+	_, err = session.Attach(VideoRoomPluginName)
+	assert.NoError(t, err)
+	assert.NoError(t, trace.Close())
+
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	frames := make([]Frame, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		frame := Frame{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &frame))
+		frames = append(frames, frame)
+	}
+
+	assert.Len(t, frames, 4)
+	assert.Equal(t, FrameOut, frames[0].Direction)
+	assert.Equal(t, "create", frames[0].Janus)
+	assert.Equal(t, FrameIn, frames[1].Direction)
+	assert.Equal(t, frames[0].Transaction, frames[1].Transaction)
+	assert.Equal(t, "attach", frames[2].Janus)
+	assert.Equal(t, session.ID, frames[2].Session)
+}
+
+func Test_JSONLTrace_Redacted(t *testing.T) {
+	server := newFakeJanus(t)
+	server.APISecret = "api-secret"
+
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	trace, err := NewJSONLTrace(path)
+	assert.NoError(t, err)
+
+	client, err := Connect(WithURL(server.WebsocketURL()), WithAPISecret("api-secret"), WithToken("gateway-token"))
+	assert.NoError(t, err)
+	defer client.Close()
+	log := &bytes.Buffer{}
+	client.SetLogger(NewStdLogger(log, LevelDebug))
+	client.SetTraceSink(trace)
+
+	_, err = client.Create()
+	assert.NoError(t, err)
+	assert.NoError(t, trace.Close())
+
+	traced, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	for _, written := range []string{string(traced), log.String()} {
+		assert.Contains(t, written, "create")
+		assert.Contains(t, written, Redacted)
+		assert.NotContains(t, written, "api-secret")
+		assert.NotContains(t, written, "gateway-token")
+	}
+}
+
+func Test_Redact(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "none",
+			data: `{"janus":"create","transaction":"abc"}`,
+			want: `{"janus":"create","transaction":"abc"}`,
+		},
+		{
+			name: "apisecret and token",
+			data: `{"janus":"create","apisecret":"secret","token":"token","transaction":"abc"}`,
+			want: `{"janus":"create","apisecret":"redacted","token":"redacted","transaction":"abc"}`,
+		},
+		{
+			name: "admin_secret",
+			data: `{"janus":"list_sessions","admin_secret":"janusoverlord"}`,
+			want: `{"janus":"list_sessions","admin_secret":"redacted"}`,
+		},
+		{
+			name: "room secret left alone",
+			data: `{"janus":"message","body":{"request":"destroy","secret":"room"}}`,
+			want: `{"janus":"message","body":{"request":"destroy","secret":"room"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, string(redact([]byte(test.data))))
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package janus
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+// DefaultTransactionTTL is how long a request may go unanswered before its
+// transaction is expired, unless changed with Gateway.SetTransactionTTL.
+const DefaultTransactionTTL = 2 * time.Minute
+
+// ErrTransactionExpired is wrapped by the *TimeoutError returned to a request
+// whose transaction outlived the Gateway's transaction TTL.
+var ErrTransactionExpired = errors.New("transaction expired")
+
+// lateAckTTL is how long the table waits for the ack of a plugin message that
+// was already answered by its event. Over HTTP the event comes through the
+// long poll and may overtake the ack of the POST.
+const lateAckTTL = time.Minute
+
+// TransactionStats counts what became of the requests sent on a Gateway.
+type TransactionStats struct {
+	// Pending is the number of requests still waiting for a final response.
+	Pending int `json:"pending"`
+
+	// Completed is the number of requests that got a final response.
+	Completed uint64 `json:"completed"`
+
+	// Abandoned is the number of requests whose caller stopped waiting,
+	// because its context was done.
+	Abandoned uint64 `json:"abandoned"`
+
+	// Expired is the number of requests dropped after the transaction TTL.
+	Expired uint64 `json:"expired"`
+
+	// Orphans is the number of responses that arrived for a transaction
+	// nobody was waiting for anymore.
+	Orphans uint64 `json:"orphans"`
+
+	// Failed is the number of requests failed because Janus expired their
+	// session while they were pending.
+	Failed uint64 `json:"failed"`
+}
+
+type transaction struct {
+	ch      chan interface{}
+	request string
+	session uint64
+	handle  uint64
+	created time.Time
+	acked   bool
+
+	// data is the encoded request, kept until the first reply arrives so it
+	// can be resent after a reconnect.
+	data []byte
+
+	// sentOn is the connection the request was last handed to, nil while it
+	// is held back during a reconnect. Whoever hands it to a connection first,
+	// the write itself or the resend after a reconnect, is the one sending it.
+	sentOn Transport
+}
+
+// transactionTable tracks the requests waiting for an answer from the
+// gateway. An entry lives until its final response is delivered, its caller
+// gives up, or it expires.
+type transactionTable struct {
+	mu      sync.Mutex
+	entries map[xid.ID]*transaction
+	ttl     time.Duration
+	stats   TransactionStats
+
+	// unacked holds the plugin messages answered before they were acked,
+	// so their late ack is dropped instead of counted as an orphan.
+	unacked map[xid.ID]time.Time
+}
+
+func newTransactionTable(ttl time.Duration) *transactionTable {
+	return &transactionTable{
+		entries: make(map[xid.ID]*transaction),
+		ttl:     ttl,
+		unacked: make(map[xid.ID]time.Time),
+	}
+}
+
+func (table *transactionTable) add(id xid.ID, entry *transaction) {
+	entry.created = time.Now()
+
+	table.mu.Lock()
+	table.entries[id] = entry
+	table.mu.Unlock()
+}
+
+// deliver hands msg to the request waiting on transaction id and reports
+// whether there was one, or msg is the late ack of an answered plugin
+// message. The entry is removed once msg is final.
+func (table *transactionTable) deliver(id xid.ID, msg interface{}) bool {
+	_, ack := msg.(*AckMsg)
+
+	table.mu.Lock()
+	entry, ok := table.entries[id]
+	if !ok {
+		if _, late := table.unacked[id]; late && ack {
+			delete(table.unacked, id)
+			table.mu.Unlock()
+			return true
+		}
+		if isResponse(msg) {
+			table.stats.Orphans++
+		}
+		table.mu.Unlock()
+		return false
+	}
+
+	entry.data = nil
+	if ack {
+		entry.acked = true
+	}
+	if isFinal(entry.request, msg) {
+		delete(table.entries, id)
+		table.stats.Completed++
+		if entry.request == "message" && !entry.acked && !isResponse(msg) {
+			table.unacked[id] = time.Now()
+		}
+	}
+	table.mu.Unlock()
+
+	// The channel has room for an ack and a final response, so this only
+	// drops messages Janus should never have sent.
+	select {
+	case entry.ch <- msg:
+	default:
+	}
+	return true
+}
+
+// abandon removes a transaction whose caller stopped waiting for it.
+func (table *transactionTable) abandon(id xid.ID) {
+	table.mu.Lock()
+	if _, ok := table.entries[id]; ok {
+		delete(table.entries, id)
+		table.stats.Abandoned++
+	}
+	table.mu.Unlock()
+}
+
+// remove drops a transaction that never made it onto the wire.
+func (table *transactionTable) remove(id xid.ID) {
+	table.mu.Lock()
+	delete(table.entries, id)
+	table.mu.Unlock()
+}
+
+// expire fails every transaction older than the TTL with a *TimeoutError.
+func (table *transactionTable) expire(now time.Time) {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	for id, answered := range table.unacked {
+		if now.Sub(answered) >= lateAckTTL {
+			delete(table.unacked, id)
+		}
+	}
+
+	if table.ttl <= 0 {
+		return
+	}
+	for id, entry := range table.entries {
+		if now.Sub(entry.created) < table.ttl {
+			continue
+		}
+
+		delete(table.entries, id)
+		table.stats.Expired++
+		select {
+		case entry.ch <- &TimeoutError{Request: entry.request, Transaction: id.String(), Err: ErrTransactionExpired}:
+		default:
+		}
+	}
+}
+
+// failSession fails every transaction of a session with a *SessionError and
+// returns how many there were.
+func (table *transactionTable) failSession(session uint64, cause error) int {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	failed := 0
+	for id, entry := range table.entries {
+		if entry.session != session {
+			continue
+		}
+
+		delete(table.entries, id)
+		table.stats.Failed++
+		failed++
+		select {
+		case entry.ch <- &SessionError{Session: session, Request: entry.request, Err: cause}:
+		default:
+		}
+	}
+	return failed
+}
+
+func (table *transactionTable) setTTL(ttl time.Duration) {
+	table.mu.Lock()
+	table.ttl = ttl
+	table.mu.Unlock()
+}
+
+// take hands the request of transaction id over to transport and reports
+// whether the caller should write it there. It should not when the request
+// got a reply already or was handed to transport before.
+func (table *transactionTable) take(id xid.ID, transport Transport) bool {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	entry, ok := table.entries[id]
+	if !ok || entry.data == nil || entry.sentOn == transport {
+		return false
+	}
+	entry.sentOn = transport
+	return true
+}
+
+// resend hands every request that got no reply at all yet over to
+// transport, held back ones included, and returns those to write there.
+func (table *transactionTable) resend(transport Transport) [][]byte {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	pending := make([][]byte, 0, len(table.entries))
+	for _, entry := range table.entries {
+		if entry.data != nil && entry.sentOn != transport {
+			entry.sentOn = transport
+			pending = append(pending, entry.data)
+		}
+	}
+	return pending
+}
+
+func (table *transactionTable) snapshot() TransactionStats {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	stats := table.stats
+	stats.Pending = len(table.entries)
+	return stats
+}
+
+// isResponse reports whether msg answers a request, as opposed to being an
+// event that merely carries the transaction of the request behind it.
+func isResponse(msg interface{}) bool {
+	switch msg.(type) {
+	case *AckMsg, *SuccessMsg, *ErrorMsg, *InfoMsg, *PongMsg:
+		return true
+	}
+	return false
+}
+
+// isFinal reports whether msg ends the transaction of a request. A plugin
+// message is acked first and answered by a later event.
+func isFinal(request string, msg interface{}) bool {
+	if _, ok := msg.(*AckMsg); ok {
+		return request != "message"
+	}
+	return true
+}
+
+// SetTransactionTTL changes how long a request may go unanswered before its
+// transaction is expired and the caller gets a *TimeoutError. Zero disables
+// expiry.
+func (gateway *Gateway) SetTransactionTTL(ttl time.Duration) {
+	gateway.transactions.setTTL(ttl)
+}
+
+// TransactionStats returns the current transaction counters.
+func (gateway *Gateway) TransactionStats() TransactionStats {
+	return gateway.transactions.snapshot()
+}
+
+// expireTransactions sweeps the transaction table until the Gateway is closed.
+func (gateway *Gateway) expireTransactions() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			gateway.transactions.expire(now)
+		case <-gateway.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package janus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TransactionTable_MessageEndsOnEvent(t *testing.T) {
+	table := newTransactionTable(time.Minute)
+	id := xid.New()
+	ch := make(chan interface{}, transactionBuffer)
+	table.add(id, &transaction{ch: ch, request: "message"})
+
+	assert.True(t, table.deliver(id, &AckMsg{}))
+	assert.Equal(t, 1, table.snapshot().Pending)
+
+	assert.True(t, table.deliver(id, &EventMsg{}))
+	stats := table.snapshot()
+	assert.Zero(t, stats.Pending)
+	assert.Equal(t, uint64(1), stats.Completed)
+
+	// a late duplicate answer is an orphan, a later event is not
+	assert.False(t, table.deliver(id, &AckMsg{}))
+	assert.False(t, table.deliver(id, &EventMsg{}))
+	assert.Equal(t, uint64(1), table.snapshot().Orphans)
+}
+
+func Test_TransactionTable_EventBeforeAck(t *testing.T) {
+	table := newTransactionTable(time.Minute)
+	id := xid.New()
+	ch := make(chan interface{}, transactionBuffer)
+	table.add(id, &transaction{ch: ch, request: "message"})
+
+	// the long poll overtook the ack of the POST
+	assert.True(t, table.deliver(id, &EventMsg{}))
+	assert.True(t, table.deliver(id, &AckMsg{}))
+	stats := table.snapshot()
+	assert.Zero(t, stats.Pending)
+	assert.Zero(t, stats.Orphans)
+	assert.Len(t, ch, 1)
+
+	// only the one ack is expected
+	assert.False(t, table.deliver(id, &AckMsg{}))
+	assert.Equal(t, uint64(1), table.snapshot().Orphans)
+}
+
+func Test_TransactionTable_Expire(t *testing.T) {
+	table := newTransactionTable(time.Minute)
+	id := xid.New()
+	ch := make(chan interface{}, transactionBuffer)
+	table.add(id, &transaction{ch: ch, request: "keepalive", data: []byte("{}")})
+	assert.Len(t, table.resend(&wsTransport{}), 1)
+
+	table.expire(time.Now())
+	assert.Equal(t, 1, table.snapshot().Pending)
+
+	table.expire(time.Now().Add(2 * time.Minute))
+	stats := table.snapshot()
+	assert.Zero(t, stats.Pending)
+	assert.Equal(t, uint64(1), stats.Expired)
+
+	msg := <-ch
+	assert.True(t, IsTimeout(msg.(error)))
+}
+
+func Test_TransactionTable_FailSession(t *testing.T) {
+	table := newTransactionTable(time.Minute)
+	ch := make(chan interface{}, transactionBuffer)
+	other := make(chan interface{}, transactionBuffer)
+	table.add(xid.New(), &transaction{ch: ch, request: "message", session: 1, handle: 2})
+	table.add(xid.New(), &transaction{ch: other, request: "keepalive", session: 3})
+
+	assert.Equal(t, 1, table.failSession(1, ErrSessionExpired))
+	stats := table.snapshot()
+	assert.Equal(t, 1, stats.Pending)
+	assert.Equal(t, uint64(1), stats.Failed)
+
+	err, ok := (<-ch).(*SessionError)
+	assert.True(t, ok)
+	assert.Equal(t, "message", err.Request)
+	assert.ErrorIs(t, err, ErrSessionExpired)
+	assert.Empty(t, other)
+}
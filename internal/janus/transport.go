@@ -0,0 +1,85 @@
+package janus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport carries encoded Janus API messages between a Gateway and the
+// server. Write sends one request; Read blocks until the next reply or event
+// arrives and is only ever called from the Gateway's receive loop.
+type Transport interface {
+	Write(data []byte) error
+	Read() ([]byte, error)
+	Close() error
+}
+
+// pinger is implemented by transports that can check the connection is still
+// alive between requests.
+type pinger interface {
+	Ping(deadline time.Time) error
+}
+
+// sessionWatcher is implemented by transports that have to fetch events for
+// each session themselves instead of having them pushed by the server. auth
+// is the apisecret and token Janus checks on each fetch.
+type sessionWatcher interface {
+	WatchSession(id uint64, auth url.Values)
+	UnwatchSession(id uint64)
+}
+
+// wsTransport speaks the Janus API over a websocket connection.
+type wsTransport struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	timing  HandshakeTiming
+}
+
+// dialWebsocket uses a dialer of its own, so connections with different
+// subprotocols can be opened at the same time.
+func dialWebsocket(options GatewayOptions) (*wsTransport, error) {
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: options.DialTimeout,
+		Subprotocols:     []string{options.Subprotocol},
+		TLSClientConfig:  options.TLSConfig,
+	}
+
+	trace := newHandshakeTrace()
+	ctx := httptrace.WithClientTrace(context.Background(), trace.clientTrace())
+	conn, _, err := dialer.DialContext(ctx, options.URL, options.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wsTransport{conn: conn, timing: trace.timing()}, nil
+}
+
+func (transport *wsTransport) HandshakeTiming() HandshakeTiming {
+	return transport.timing
+}
+
+func (transport *wsTransport) Write(data []byte) error {
+	transport.writeMu.Lock()
+	defer transport.writeMu.Unlock()
+	return transport.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (transport *wsTransport) Read() ([]byte, error) {
+	_, data, err := transport.conn.ReadMessage()
+	return data, err
+}
+
+func (transport *wsTransport) Ping(deadline time.Time) error {
+	return transport.conn.WriteControl(websocket.PingMessage, []byte{}, deadline)
+}
+
+func (transport *wsTransport) Close() error {
+	return transport.conn.Close()
+}
@@ -19,12 +19,15 @@
 
 package janus
 
+import "fmt"
+
 var msgtypes = map[string]func() interface{}{
 	"error":       func() interface{} { return &ErrorMsg{} },
 	"success":     func() interface{} { return &SuccessMsg{} },
 	"detached":    func() interface{} { return &DetachedMsg{} },
 	"server_info": func() interface{} { return &InfoMsg{} },
 	"ack":         func() interface{} { return &AckMsg{} },
+	"pong":        func() interface{} { return &PongMsg{} },
 	"event":       func() interface{} { return &EventMsg{} },
 	"webrtcup":    func() interface{} { return &WebRTCUpMsg{} },
 	"media":       func() interface{} { return &MediaMsg{} },
@@ -33,6 +36,38 @@ var msgtypes = map[string]func() interface{}{
 	"timeout":     func() interface{} { return &TimeoutMsg{} },
 }
 
+// messageType names a decoded message the way Janus does in its "janus"
+// field.
+func messageType(msg interface{}) string {
+	switch msg.(type) {
+	case *ErrorMsg:
+		return "error"
+	case *SuccessMsg:
+		return "success"
+	case *DetachedMsg:
+		return "detached"
+	case *InfoMsg:
+		return "server_info"
+	case *AckMsg:
+		return "ack"
+	case *PongMsg:
+		return "pong"
+	case *EventMsg:
+		return "event"
+	case *WebRTCUpMsg:
+		return "webrtcup"
+	case *MediaMsg:
+		return "media"
+	case *HangupMsg:
+		return "hangup"
+	case *SlowLinkMsg:
+		return "slowlink"
+	case *TimeoutMsg:
+		return "timeout"
+	}
+	return fmt.Sprintf("%T", msg)
+}
+
 type BaseMsg struct {
 	Type    string `json:"janus"`
 	ID      string `json:"transaction"`
@@ -90,6 +125,9 @@ type PluginInfo struct {
 
 type AckMsg struct{}
 
+// PongMsg answers an Admin API ping.
+type PongMsg struct{}
+
 type EventMsg struct {
 	Plugindata PluginData
 	Jsep       map[string]interface{}
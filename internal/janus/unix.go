@@ -0,0 +1,102 @@
+package janus
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// unixPacketSize is the largest message read from a Unix socket, far more
+// than any Janus message with an SDP needs.
+const unixPacketSize = 1 << 20
+
+// unixTransport speaks the Janus API over the Unix socket of the pfunix
+// transport, one message per packet. With SOCK_DGRAM Janus answers to the
+// address of the client, so the transport binds a socket file of its own
+// and removes it again on Close.
+type unixTransport struct {
+	conn  *net.UnixConn
+	local string
+	buf   []byte
+}
+
+// unixSocket returns the network and path of a unix:// URL, such as
+// unix:///var/run/janus.sock for SOCK_SEQPACKET, the pfunix default, or
+// unix:///var/run/janus.sock?type=dgram for SOCK_DGRAM.
+func unixSocket(parsed *url.URL) (string, string, error) {
+	path := parsed.Path
+	if path == "" {
+		path = parsed.Opaque
+	}
+	if path == "" {
+		return "", "", fmt.Errorf("no socket path in '%s'", parsed.String())
+	}
+
+	switch socketType := parsed.Query().Get("type"); socketType {
+	case "", "seqpacket":
+		return "unixpacket", path, nil
+	case "dgram":
+		return "unixgram", path, nil
+	default:
+		return "", "", fmt.Errorf("unknown unix socket type '%s'", socketType)
+	}
+}
+
+func dialUnix(options GatewayOptions) (*unixTransport, error) {
+	parsed, err := url.Parse(options.URL)
+	if err != nil {
+		return nil, err
+	}
+	network, path, err := unixSocket(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: options.DialTimeout}
+	transport := &unixTransport{buf: make([]byte, unixPacketSize)}
+	if network == "unixgram" {
+		transport.local = filepath.Join(os.TempDir(), fmt.Sprintf("janus-tester-%d-%s.sock", os.Getpid(), generateTransactionId()))
+		dialer.LocalAddr = &net.UnixAddr{Name: transport.local, Net: network}
+	}
+
+	conn, err := dialer.DialContext(context.Background(), network, path)
+	if err != nil {
+		if transport.local != "" {
+			os.Remove(transport.local)
+		}
+		return nil, err
+	}
+	transport.conn = conn.(*net.UnixConn)
+	return transport, nil
+}
+
+func (transport *unixTransport) Write(data []byte) error {
+	_, err := transport.conn.Write(data)
+	return err
+}
+
+// Read is only called from the receive loop, so the buffer is reused.
+func (transport *unixTransport) Read() ([]byte, error) {
+	n, err := transport.conn.Read(transport.buf)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), transport.buf[:n]...), nil
+}
+
+func (transport *unixTransport) Close() error {
+	err := transport.conn.Close()
+	if transport.local != "" {
+		os.Remove(transport.local)
+	}
+	return err
+}
+
+// UnixConnect initiates a connection with the pfunix transport of a Janus
+// listening on the SOCK_SEQPACKET socket at path.
+func UnixConnect(path string) (*Gateway, error) {
+	return Connect(WithURL((&url.URL{Scheme: "unix", Path: path}).String()))
+}
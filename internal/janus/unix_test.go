@@ -0,0 +1,77 @@
+package janus
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Hwanse/janus-tester/internal/fakejanus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_UnixConnect(t *testing.T) {
+	for _, socket := range []struct{ network, query string }{
+		{"unixpacket", ""},
+		{"unixgram", "?type=dgram"},
+	} {
+		t.Run(socket.network, func(t *testing.T) {
+			server := newFakeJanus(t)
+			path := unixSocketPath(t)
+			assert.NoError(t, server.ListenUnix(socket.network, path))
+
+			client, err := Connect(WithURL("unix://" + path + socket.query))
+			assert.NoError(t, err)
+			defer client.Close()
+
+			_, err = client.Info()
+			assert.NoError(t, err)
+			session, err := client.Create()
+			assert.NoError(t, err)
+			handle, err := session.Attach(VideoRoomPluginName)
+			assert.NoError(t, err)
+
+			joined, err := handle.JoinPublisher(&JoinPublisherRequest{
+				Request:  TypeJoin,
+				RoomID:   fakejanus.DefaultRoom,
+				PeerType: TypePublisher,
+			})
+			assert.NoError(t, err)
+			assert.NotZero(t, joined.FeedID)
+
+			pc, offer := newTestPeer(t, true)
+			defer pc.Close()
+			answer, err := handle.Publish(&PublishRequest{Request: TypePublish}, offer)
+			assert.NoError(t, err)
+			assert.Equal(t, "answer", answer["type"])
+
+			_, err = handle.Detach()
+			assert.NoError(t, err)
+			_, err = session.Destroy()
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_UnixConnect_Path(t *testing.T) {
+	server := newFakeJanus(t)
+	path := unixSocketPath(t)
+	assert.NoError(t, server.ListenUnix("unixpacket", path))
+
+	client, err := UnixConnect(path)
+	assert.NoError(t, err)
+	defer client.Close()
+	_, err = client.Create()
+	assert.NoError(t, err)
+
+	_, err = Connect(WithURL("unix://" + path + "?type=stream"))
+	assert.Error(t, err)
+}
+
+// unixSocketPath returns a socket path short enough for sun_path, which the
+// directory of t.TempDir may not be.
+func unixSocketPath(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "janus")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "janus.sock")
+}
@@ -1,82 +1,331 @@
 package janus
 
 import (
+	"context"
+
 	"github.com/mitchellh/mapstructure"
 )
 
+// roomRequester sends a synchronous videoroom request and returns the data
+// the plugin answered with. Handle and RoomManager each have one, so the room
+// requests are the same whichever way they reach the plugin.
+type roomRequester func(ctx context.Context, body interface{}) (map[string]interface{}, error)
+
+func (handle *Handle) pluginRequest(ctx context.Context, body interface{}) (map[string]interface{}, error) {
+	msg, err := handle.RequestCtx(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	return msg.PluginData.Data, nil
+}
+
 func (handle *Handle) CreateRoom(req *CreateRoomRequest) error {
-	msg, err := handle.Request(req)
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.CreateRoomCtx(ctx, req)
+}
+
+// CreateRoomCtx is like CreateRoom but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) CreateRoomCtx(ctx context.Context, req *CreateRoomRequest) error {
+	return createRoom(ctx, handle.pluginRequest, req)
+}
+
+func (handle *Handle) ExistsRoom(req *ExistsRoomRequest) (bool, error) {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.ExistsRoomCtx(ctx, req)
+}
+
+// ExistsRoomCtx is like ExistsRoom but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) ExistsRoomCtx(ctx context.Context, req *ExistsRoomRequest) (bool, error) {
+	return existsRoom(ctx, handle.pluginRequest, req)
+}
+
+func (handle *Handle) EditRoom(req *EditRoomRequest) error {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.EditRoomCtx(ctx, req)
+}
+
+// EditRoomCtx is like EditRoom but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) EditRoomCtx(ctx context.Context, req *EditRoomRequest) error {
+	return editRoom(ctx, handle.pluginRequest, req)
+}
+
+// Allowed runs the action of req on the tokens allowed to join a room, and
+// returns the tokens allowed after it, none once disabled.
+func (handle *Handle) Allowed(req *AllowedRequest) ([]string, error) {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.AllowedCtx(ctx, req)
+}
+
+// AllowedCtx is like Allowed but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) AllowedCtx(ctx context.Context, req *AllowedRequest) ([]string, error) {
+	return allowed(ctx, handle.pluginRequest, req)
+}
+
+func (handle *Handle) DestroyRoom(req *DestroyRoomRequest) error {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.DestroyRoomCtx(ctx, req)
+}
+
+// DestroyRoomCtx is like DestroyRoom but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) DestroyRoomCtx(ctx context.Context, req *DestroyRoomRequest) error {
+	return destroyRoom(ctx, handle.pluginRequest, req)
+}
+
+func (handle *Handle) RoomList() ([]Room, error) {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.RoomListCtx(ctx)
+}
+
+// RoomListCtx is like RoomList but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) RoomListCtx(ctx context.Context) ([]Room, error) {
+	return roomList(ctx, handle.pluginRequest)
+}
+
+// ListParticipants returns the publishers of a room, whether they are
+// sending media or not.
+func (handle *Handle) ListParticipants(roomID uint64) (Participants, error) {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.ListParticipantsCtx(ctx, roomID)
+}
+
+// ListParticipantsCtx is like ListParticipants but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) ListParticipantsCtx(ctx context.Context, roomID uint64) (Participants, error) {
+	return listParticipants(ctx, handle.pluginRequest, roomID)
+}
+
+// ListForwarders returns the publishers of a room that have RTP forwarders,
+// secret being the one of the room if it has one.
+func (handle *Handle) ListForwarders(roomID uint64, secret string) ([]PublisherForwarders, error) {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.ListForwardersCtx(ctx, roomID, secret)
+}
+
+// ListForwardersCtx is like ListForwarders but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) ListForwardersCtx(ctx context.Context, roomID uint64, secret string) ([]PublisherForwarders, error) {
+	return listForwarders(ctx, handle.pluginRequest, roomID, secret)
+}
+
+// RTPForward starts forwarding streams of a publisher, and returns the
+// forwarders Janus created, one per stream.
+func (handle *Handle) RTPForward(req *RTPForwardRequest) ([]RTPForwarder, error) {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.RTPForwardCtx(ctx, req)
+}
+
+// RTPForwardCtx is like RTPForward but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) RTPForwardCtx(ctx context.Context, req *RTPForwardRequest) ([]RTPForwarder, error) {
+	return rtpForward(ctx, handle.pluginRequest, req)
+}
+
+func (handle *Handle) StopRTPForward(req *StopRTPForwardRequest) error {
+	ctx, cancel := handle.requestContext()
+	defer cancel()
+	return handle.StopRTPForwardCtx(ctx, req)
+}
+
+// StopRTPForwardCtx is like StopRTPForward but gives up with a *TimeoutError once ctx is done.
+func (handle *Handle) StopRTPForwardCtx(ctx context.Context, req *StopRTPForwardRequest) error {
+	return stopRTPForward(ctx, handle.pluginRequest, req)
+}
+
+func createRoom(ctx context.Context, request roomRequester, req *CreateRoomRequest) error {
+	data, err := request(ctx, req)
 	if err != nil {
-		return WrapError("failed to create room", err.Error())
+		return wrapRequestError("failed to create room", err)
 	}
 
 	response := CreateRoomResponse{}
-	err = mapstructure.Decode(msg.PluginData.Data, &response)
+	err = mapstructure.Decode(data, &response)
 	if err != nil {
 		return err
 	}
 
 	if isUnexpectedResponse(response.VideoRoomResponseType.Type, SuccessCreateRoom) {
-		return WrapError("failed to create room", response.Error())
+		return wrapResponseError("failed to create room", &response.ErrorResponse)
 	}
 
 	return nil
 }
 
-func (handle *Handle) ExistsRoom(req *ExistsRoomRequest) (bool, error) {
-	msg, err := handle.Request(req)
+func existsRoom(ctx context.Context, request roomRequester, req *ExistsRoomRequest) (bool, error) {
+	data, err := request(ctx, req)
 	if err != nil {
-		return false, WrapError("failed to exists room", err.Error())
+		return false, wrapRequestError("failed to exists room", err)
 	}
 
 	response := ExistsRoomResponse{}
-	err = mapstructure.Decode(msg.PluginData.Data, &response)
+	err = mapstructure.Decode(data, &response)
 	if err != nil {
 		return false, err
 	}
 
 	if isUnexpectedResponse(response.VideoRoomResponseType.Type, Success) {
-		return false, WrapError("failed to exists room", response.Error())
+		return false, wrapResponseError("failed to exists room", &response.ErrorResponse)
 	}
 
 	return response.IsExists, nil
 }
 
-func (handle *Handle) DestroyRoom(req *DestroyRoomRequest) error {
-	msg, err := handle.Request(req)
+func editRoom(ctx context.Context, request roomRequester, req *EditRoomRequest) error {
+	data, err := request(ctx, req)
+	if err != nil {
+		return wrapRequestError("failed to edit room", err)
+	}
+
+	response := EditRoomResponse{}
+	err = mapstructure.Decode(data, &response)
+	if err != nil {
+		return err
+	}
+
+	if isUnexpectedResponse(response.VideoRoomResponseType.Type, SuccessEditRoom) {
+		return wrapResponseError("failed to edit room", &response.ErrorResponse)
+	}
+
+	return nil
+}
+
+func allowed(ctx context.Context, request roomRequester, req *AllowedRequest) ([]string, error) {
+	data, err := request(ctx, req)
+	if err != nil {
+		return nil, wrapRequestError("failed to change allowed tokens", err)
+	}
+
+	response := AllowedResponse{}
+	err = mapstructure.Decode(data, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if isUnexpectedResponse(response.VideoRoomResponseType.Type, Success) {
+		return nil, wrapResponseError("failed to change allowed tokens", &response.ErrorResponse)
+	}
+
+	return response.Allowed, nil
+}
+
+func destroyRoom(ctx context.Context, request roomRequester, req *DestroyRoomRequest) error {
+	data, err := request(ctx, req)
 	if err != nil {
-		return WrapError("failed to destroy room", err.Error())
+		return wrapRequestError("failed to destroy room", err)
 	}
 
 	response := DestroyRoomResponse{}
-	err = mapstructure.Decode(msg.PluginData.Data, &response)
+	err = mapstructure.Decode(data, &response)
 	if err != nil {
 		return err
 	}
 
 	if isUnexpectedResponse(response.VideoRoomResponseType.Type, SuccessDestroyRoom) {
-		return WrapError("failed to destroy room", response.Error())
+		return wrapResponseError("failed to destroy room", &response.ErrorResponse)
 	}
 
 	return nil
 }
 
-func (handle *Handle) RoomList() ([]Room, error) {
+func roomList(ctx context.Context, request roomRequester) ([]Room, error) {
 	req := &RoomListRequest{Request: TypeList}
-	msg, err := handle.Request(req)
+	data, err := request(ctx, req)
 	if err != nil {
-		return nil, WrapError("failed to get all room list", err.Error())
+		return nil, wrapRequestError("failed to get all room list", err)
 	}
 
 	response := RoomListResponse{}
-	err = mapstructure.Decode(msg.PluginData.Data, &response)
+	err = mapstructure.Decode(data, &response)
 	if err != nil {
 		return nil, err
 	}
 
 	if isUnexpectedResponse(response.VideoRoomResponseType.Type, Success) {
-		return nil, WrapError("failed to get all room list", response.Error())
+		return nil, wrapResponseError("failed to get all room list", &response.ErrorResponse)
 	}
 
 	return response.List, nil
 }
+
+func listParticipants(ctx context.Context, request roomRequester, roomID uint64) (Participants, error) {
+	req := &ListParticipantsRequest{Request: TypeListParticipants, RoomID: roomID}
+	data, err := request(ctx, req)
+	if err != nil {
+		return nil, wrapRequestError("failed to list participants", err)
+	}
+
+	response := ListParticipantsResponse{}
+	err = mapstructure.Decode(data, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if isUnexpectedResponse(response.VideoRoomResponseType.Type, SuccessParticipants) {
+		return nil, wrapResponseError("failed to list participants", &response.ErrorResponse)
+	}
+
+	return response.Participants, nil
+}
+
+func listForwarders(ctx context.Context, request roomRequester, roomID uint64, secret string) ([]PublisherForwarders, error) {
+	req := &ListForwardersRequest{Request: TypeListForwarders, RoomID: roomID, Secret: secret}
+	data, err := request(ctx, req)
+	if err != nil {
+		return nil, wrapRequestError("failed to list forwarders", err)
+	}
+
+	response := ListForwardersResponse{}
+	err = mapstructure.Decode(data, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if isUnexpectedResponse(response.VideoRoomResponseType.Type, SuccessForwarders) {
+		return nil, wrapResponseError("failed to list forwarders", &response.ErrorResponse)
+	}
+
+	return response.Publishers, nil
+}
+
+func rtpForward(ctx context.Context, request roomRequester, req *RTPForwardRequest) ([]RTPForwarder, error) {
+	data, err := request(ctx, req)
+	if err != nil {
+		return nil, wrapRequestError("failed to rtp forward", err)
+	}
+
+	response := RTPForwardResponse{}
+	err = mapstructure.Decode(data, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if isUnexpectedResponse(response.VideoRoomResponseType.Type, TypeRTPForward) {
+		return nil, wrapResponseError("failed to rtp forward", &response.ErrorResponse)
+	}
+
+	return response.Forwarders, nil
+}
+
+func stopRTPForward(ctx context.Context, request roomRequester, req *StopRTPForwardRequest) error {
+	data, err := request(ctx, req)
+	if err != nil {
+		return wrapRequestError("failed to stop rtp forward", err)
+	}
+
+	response := StopRTPForwardResponse{}
+	err = mapstructure.Decode(data, &response)
+	if err != nil {
+		return err
+	}
+
+	if isUnexpectedResponse(response.VideoRoomResponseType.Type, TypeStopRTPForward) {
+		return wrapResponseError("failed to stop rtp forward", &response.ErrorResponse)
+	}
+
+	return nil
+}
@@ -1,9 +1,14 @@
 package janus
 
 import (
-	"fmt"
+	"github.com/Hwanse/janus-tester/internal/fakejanus"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
 	"github.com/stretchr/testify/assert"
+	"net"
 	"testing"
+	"time"
 )
 
 const RoomID = uint64(123456789)
@@ -11,7 +16,7 @@ const RoomID = uint64(123456789)
 // VideoRoom Room API Test
 
 func Test_CreateRoom(t *testing.T) {
-	handle, err := attachVideoRoomHandle()
+	handle, err := attachVideoRoomHandle(newFakeJanus(t))
 	defer handle.Detach()
 	assert.NoError(t, err)
 
@@ -36,7 +41,7 @@ func Test_CreateRoom(t *testing.T) {
 }
 
 func Test_Exists_False(t *testing.T) {
-	handle, err := attachVideoRoomHandle()
+	handle, err := attachVideoRoomHandle(newFakeJanus(t))
 	defer handle.Detach()
 	assert.NoError(t, err)
 
@@ -54,7 +59,7 @@ func Test_Exists_False(t *testing.T) {
 }
 
 func Test_Exists_True(t *testing.T) {
-	handle, err := attachVideoRoomHandle()
+	handle, err := attachVideoRoomHandle(newFakeJanus(t))
 	defer handle.Detach()
 	assert.NoError(t, err)
 
@@ -75,7 +80,7 @@ func Test_Exists_True(t *testing.T) {
 }
 
 func Test_RoomList(t *testing.T) {
-	handle, err := attachVideoRoomHandle()
+	handle, err := attachVideoRoomHandle(newFakeJanus(t))
 	defer handle.Detach()
 	assert.NoError(t, err)
 
@@ -99,7 +104,7 @@ func Test_RoomList(t *testing.T) {
 }
 
 func Test_DestroyRoom(t *testing.T) {
-	handle, err := attachVideoRoomHandle()
+	handle, err := attachVideoRoomHandle(newFakeJanus(t))
 	defer handle.Detach()
 	assert.NoError(t, err)
 
@@ -116,12 +121,83 @@ func Test_DestroyRoom(t *testing.T) {
 
 // VideoRoom Participant API Test
 
+func Test_EditRoom(t *testing.T) {
+	server := newFakeJanus(t)
+	handle, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+
+	err = handle.CreateRoom(&CreateRoomRequest{Request: TypeCreate, Room: Room{RoomID: RoomID, Secret: "adminpwd", Bitrate: 128000}})
+	assert.NoError(t, err)
+
+	err = handle.EditRoom(&EditRoomRequest{Request: TypeEdit, RoomID: RoomID, NewBitrate: 256000})
+	assert.Equal(t, VideoRoomErrorUnauthorized, VideoRoomErrorCode(err))
+
+	err = handle.EditRoom(&EditRoomRequest{
+		Request:        TypeEdit,
+		RoomID:         RoomID,
+		Secret:         "adminpwd",
+		NewDescription: "edited",
+		NewSecret:      "newpwd",
+		NewBitrate:     256000,
+	})
+	assert.NoError(t, err)
+
+	rooms, err := handle.RoomList()
+	assert.NoError(t, err)
+	for _, room := range rooms {
+		if room.RoomID == RoomID {
+			assert.Equal(t, "edited", room.Description)
+			assert.Equal(t, 256000, room.Bitrate)
+		}
+	}
+
+	err = handle.EditRoom(&EditRoomRequest{Request: TypeEdit, RoomID: RoomID, Secret: "adminpwd", NewBitrate: 64000})
+	assert.Equal(t, VideoRoomErrorUnauthorized, VideoRoomErrorCode(err), "the old secret")
+}
+
+func Test_Allowed(t *testing.T) {
+	server := newFakeJanus(t)
+	handle, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+	publisher, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+
+	err = handle.CreateRoom(&CreateRoomRequest{Request: TypeCreate, Room: Room{RoomID: RoomID}})
+	assert.NoError(t, err)
+
+	allowed, err := handle.Allowed(&AllowedRequest{Request: TypeAllowed, RoomID: RoomID, Action: AllowedEnable})
+	assert.NoError(t, err)
+	assert.Empty(t, allowed)
+	allowed, err = handle.Allowed(&AllowedRequest{Request: TypeAllowed, RoomID: RoomID, Action: AllowedAdd, Allowed: []string{"alice", "bob"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, allowed)
+	_, err = handle.Allowed(&AllowedRequest{Request: TypeAllowed, RoomID: RoomID, Action: AllowedAdd})
+	assert.Equal(t, VideoRoomErrorMissingElement, VideoRoomErrorCode(err))
+
+	join := &JoinPublisherRequest{Request: TypeJoin, RoomID: RoomID, PeerType: TypePublisher, Token: "carol"}
+	_, err = publisher.JoinPublisher(join)
+	assert.Error(t, err, "carol is not allowed")
+
+	allowed, err = handle.Allowed(&AllowedRequest{Request: TypeAllowed, RoomID: RoomID, Action: AllowedRemove, Allowed: []string{"alice"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bob"}, allowed)
+
+	join.Token = "bob"
+	_, err = publisher.JoinPublisher(join)
+	assert.NoError(t, err)
+
+	allowed, err = handle.Allowed(&AllowedRequest{Request: TypeAllowed, RoomID: RoomID, Action: AllowedDisable})
+	assert.NoError(t, err)
+	assert.Nil(t, allowed)
+}
+
 func Test_JoinPublisher(t *testing.T) {
-	handle, err := attachVideoRoomHandle()
+	server := newFakeJanus(t)
+	handle, err := attachVideoRoomHandle(server)
 	defer handle.Detach()
 	assert.NoError(t, err)
 
-	handle2, err := attachVideoRoomHandle()
+	handle2, err := attachVideoRoomHandle(server)
 	defer handle2.Detach()
 
 	roomID := uint64(123333333)
@@ -147,7 +223,7 @@ func Test_JoinPublisher(t *testing.T) {
 }
 
 func Test_LeavePublisher(t *testing.T) {
-	handle, err := attachVideoRoomHandle()
+	handle, err := attachVideoRoomHandle(newFakeJanus(t))
 	defer handle.Detach()
 	assert.NoError(t, err)
 
@@ -172,9 +248,310 @@ func Test_LeavePublisher(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-func attachVideoRoomHandle() (*Handle, error) {
-	url := fmt.Sprintf("ws://%s:%s/", JanusLocalHost, JanusWebsocketPort)
-	client, err := WsConnect(url)
+func Test_ListParticipants(t *testing.T) {
+	server := newFakeJanus(t)
+	alice, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+	bob, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+
+	err = alice.CreateRoom(&CreateRoomRequest{Request: TypeCreate, Room: Room{RoomID: RoomID, Secret: "adminpwd"}})
+	assert.NoError(t, err)
+
+	aliceJoined, err := alice.JoinPublisher(&JoinPublisherRequest{Request: TypeJoin, RoomID: RoomID, PeerType: TypePublisher, DisplayName: "alice"})
+	assert.NoError(t, err)
+	pc, offer := newTestPeer(t, true)
+	defer pc.Close()
+	_, err = alice.Publish(&PublishRequest{Request: TypePublish}, offer)
+	assert.NoError(t, err)
+	bobJoined, err := bob.JoinPublisher(&JoinPublisherRequest{Request: TypeJoin, RoomID: RoomID, PeerType: TypePublisher, DisplayName: "bob"})
+	assert.NoError(t, err)
+
+	participants, err := bob.ListParticipants(RoomID)
+	assert.NoError(t, err)
+	assert.Equal(t, []Publisher{{FeedID: aliceJoined.FeedID, DisplayName: "alice"}}, participants.Publishers())
+	assert.Equal(t, []Attendee{{ID: bobJoined.FeedID, DisplayName: "bob"}}, participants.Attendees())
+
+	_, err = bob.ListParticipants(RoomID + 1)
+	assert.Equal(t, VideoRoomErrorNoSuchRoom, VideoRoomErrorCode(err))
+
+	_, err = bob.ListForwarders(RoomID, "")
+	assert.Equal(t, VideoRoomErrorUnauthorized, VideoRoomErrorCode(err))
+	forwarders, err := bob.ListForwarders(RoomID, "adminpwd")
+	assert.NoError(t, err)
+	assert.Empty(t, forwarders)
+}
+
+func Test_PublishSubscribe(t *testing.T) {
+	server := newFakeJanus(t)
+	publisher, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+	subscriber, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+
+	joined, err := publisher.JoinPublisher(&JoinPublisherRequest{
+		Request:  TypeJoin,
+		RoomID:   fakejanus.DefaultRoom,
+		PeerType: TypePublisher,
+	})
+	assert.NoError(t, err)
+
+	publisherPeer, offer := newTestPeer(t, true)
+	defer publisherPeer.Close()
+	answer, err := publisher.Publish(&PublishRequest{Request: TypePublish}, offer)
+	assert.NoError(t, err)
+	assert.Equal(t, "answer", answer["type"])
+
+	response, err := subscriber.JoinSubscriber(&JoinSubscriberRequest{
+		Request:  TypeJoin,
+		RoomID:   fakejanus.DefaultRoom,
+		PeerType: TypeSubscriber,
+		Streams:  []Stream{{FeedID: joined.FeedID}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "offer", response.Jsep["type"])
+
+	subscriberPeer, _ := newTestPeer(t, false)
+	defer subscriberPeer.Close()
+	err = subscriberPeer.SetRemoteDescription(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeOffer,
+		SDP:  response.Jsep["sdp"].(string),
+	})
+	assert.NoError(t, err)
+	subscriberAnswer, err := subscriberPeer.CreateAnswer(nil)
+	assert.NoError(t, err)
+
+	err = subscriber.SubscribeStart(&SubscribeStartRequest{Request: TypeStart},
+		map[string]interface{}{"type": "answer", "sdp": subscriberAnswer.SDP})
+	assert.NoError(t, err)
+
+	err = publisher.UnPublish(&UnPublishRequest{Request: TypeUnpublish})
+	assert.NoError(t, err)
+	err = publisher.UnPublish(&UnPublishRequest{Request: TypeUnpublish})
+	assert.Error(t, err)
+}
+
+func Test_Configure(t *testing.T) {
+	server := newFakeJanus(t)
+	admin, err := WsAdminConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer admin.Close()
+	publisher, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+
+	_, err = publisher.Configure(&ConfigureRequest{Request: TypeConfigure, Bitrate: 128000}, nil)
+	assert.Error(t, err, "not joined yet")
+
+	_, err = publisher.JoinPublisher(&JoinPublisherRequest{
+		Request:  TypeJoin,
+		RoomID:   fakejanus.DefaultRoom,
+		PeerType: TypePublisher,
+	})
+	assert.NoError(t, err)
+	publisherPeer, offer := newTestPeer(t, true)
+	defer publisherPeer.Close()
+	_, err = publisher.Publish(&PublishRequest{Request: TypePublish}, offer)
+	assert.NoError(t, err)
+
+	send, record := false, true
+	response, err := publisher.Configure(&ConfigureRequest{
+		Request:  TypeConfigure,
+		Bitrate:  128000,
+		Record:   &record,
+		FileName: "/tmp/alice",
+		Display:  "alice",
+		Streams:  []ConfigureStream{{MID: "0", Send: &send}},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, OK, response.Configured)
+	assert.Equal(t, fakejanus.DefaultRoom, response.RoomID)
+
+	info, err := admin.HandleInfo(publisher.SessionID(), publisher.ID, true)
+	assert.NoError(t, err)
+	videoroom := VideoRoomHandleInfo{}
+	assert.NoError(t, info.DecodePluginSpecific(&videoroom))
+	assert.Equal(t, "alice", videoroom.Display)
+	assert.Equal(t, uint64(128000), videoroom.Bitrate)
+	assert.False(t, videoroom.AudioActive)
+
+	_, err = publisher.Configure(&ConfigureRequest{Request: TypeConfigure, Streams: []ConfigureStream{{Send: &send}}}, nil)
+	assert.Error(t, err, "a stream without mid")
+}
+
+func Test_Moderation(t *testing.T) {
+	server := newFakeJanus(t)
+	moderator, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+	alice, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+	bob, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+
+	err = moderator.CreateRoom(&CreateRoomRequest{Request: TypeCreate, Room: Room{RoomID: RoomID, Secret: "adminpwd"}})
+	assert.NoError(t, err)
+
+	aliceEvents := make(chan *VideoRoomEvent, 8)
+	alice.OnVideoRoomEvent(func(event *VideoRoomEvent) { aliceEvents <- event })
+	bobEvents := make(chan *VideoRoomEvent, 8)
+	bob.OnVideoRoomEvent(func(event *VideoRoomEvent) { bobEvents <- event })
+
+	join := &JoinPublisherRequest{Request: TypeJoin, RoomID: RoomID, PeerType: TypePublisher}
+	joined, err := alice.JoinPublisher(join)
+	assert.NoError(t, err)
+	_, err = bob.JoinPublisher(join)
+	assert.NoError(t, err)
+
+	_, err = moderator.Moderate(&ModerateRequest{Request: TypeModerate, RoomID: RoomID, FeedID: joined.FeedID, MID: "0", Mute: true})
+	assert.Equal(t, VideoRoomErrorUnauthorized, VideoRoomErrorCode(err))
+
+	_, err = moderator.Moderate(&ModerateRequest{Request: TypeModerate, Secret: "adminpwd", RoomID: RoomID, FeedID: joined.FeedID, MID: "0", Mute: true})
+	assert.NoError(t, err)
+	for _, events := range []chan *VideoRoomEvent{aliceEvents, bobEvents} {
+		select {
+		case event := <-events:
+			assert.Equal(t, "muted", event.Moderation)
+			assert.Equal(t, joined.FeedID, event.FeedID)
+			assert.Equal(t, "0", event.MID)
+		case <-time.After(time.Second):
+			t.Fatal("moderation event not delivered")
+		}
+	}
+
+	recording, err := moderator.EnableRecording(&EnableRecordingRequest{Request: TypeEnableRecording, Secret: "adminpwd", RoomID: RoomID, Record: true})
+	assert.NoError(t, err)
+	assert.True(t, recording.Record)
+
+	_, err = moderator.Kick(&KickRequest{Request: TypeKick, Secret: "adminpwd", RoomID: RoomID, FeedID: joined.FeedID})
+	assert.NoError(t, err)
+	select {
+	case event := <-aliceEvents:
+		assert.True(t, event.IsKicked())
+	case <-time.After(time.Second):
+		t.Fatal("kicked event not delivered to the kicked participant")
+	}
+	select {
+	case event := <-bobEvents:
+		assert.Equal(t, joined.FeedID, event.Kicked)
+		assert.False(t, event.IsKicked())
+	case <-time.After(time.Second):
+		t.Fatal("kicked event not delivered")
+	}
+
+	_, err = moderator.Kick(&KickRequest{Request: TypeKick, Secret: "adminpwd", RoomID: RoomID, FeedID: joined.FeedID})
+	assert.Equal(t, VideoRoomErrorNoSuchFeed, VideoRoomErrorCode(err))
+}
+
+func Test_RTPForward(t *testing.T) {
+	server := newFakeJanus(t)
+	publisher, err := attachVideoRoomHandle(server)
+	assert.NoError(t, err)
+
+	joined, err := publisher.JoinPublisher(&JoinPublisherRequest{Request: TypeJoin, RoomID: fakejanus.DefaultRoom, PeerType: TypePublisher})
+	assert.NoError(t, err)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(t, err)
+	defer conn.Close()
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	forward := &RTPForwardRequest{
+		Request: TypeRTPForward,
+		RoomID:  fakejanus.DefaultRoom,
+		FeedID:  joined.FeedID,
+		Host:    "127.0.0.1",
+		Streams: []RTPForwardStream{{MID: "0", Port: port, SSRC: 1234, PayloadType: 111}},
+	}
+	_, err = publisher.RTPForward(forward)
+	assert.Equal(t, VideoRoomErrorNoSuchFeed, VideoRoomErrorCode(err), "not publishing yet")
+
+	pc := publishTestAudio(t, publisher)
+	defer pc.Close()
+
+	forwarders, err := publisher.RTPForward(forward)
+	assert.NoError(t, err)
+	assert.Len(t, forwarders, 1)
+	assert.Equal(t, uint32(1234), forwarders[0].SSRC)
+	assert.Equal(t, port, forwarders[0].Port)
+
+	listed, err := publisher.ListForwarders(fakejanus.DefaultRoom, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []PublisherForwarders{{FeedID: joined.FeedID, Forwarders: forwarders}}, listed)
+
+	buf := make([]byte, 1500)
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err := conn.Read(buf)
+	assert.NoError(t, err)
+	packet := rtp.Packet{}
+	assert.NoError(t, packet.Unmarshal(buf[:n]))
+	assert.Equal(t, uint32(1234), packet.SSRC)
+	assert.Equal(t, uint8(111), packet.PayloadType)
+
+	stop := &StopRTPForwardRequest{Request: TypeStopRTPForward, RoomID: fakejanus.DefaultRoom, FeedID: joined.FeedID, StreamID: forwarders[0].StreamID}
+	assert.NoError(t, publisher.StopRTPForward(stop))
+	assert.Equal(t, VideoRoomErrorNoSuchFeed, VideoRoomErrorCode(publisher.StopRTPForward(stop)))
+}
+
+// publishTestAudio publishes an audio track on handle, writing opus silence
+// to it until the test ends.
+func publishTestAudio(t *testing.T, handle *Handle) *webrtc.PeerConnection {
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(t, err)
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "test")
+	assert.NoError(t, err)
+	_, err = pc.AddTrack(track)
+	assert.NoError(t, err)
+
+	description, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+	assert.NoError(t, pc.SetLocalDescription(description))
+	<-gatherComplete
+
+	answer, err := handle.Publish(&PublishRequest{Request: TypePublish},
+		map[string]interface{}{"type": "offer", "sdp": pc.LocalDescription().SDP})
+	assert.NoError(t, err)
+	assert.NoError(t, pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer["sdp"].(string)}))
+
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		tick := time.NewTicker(20 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+				track.WriteSample(media.Sample{Data: []byte{0xf8, 0xff, 0xfe}, Duration: 20 * time.Millisecond})
+			}
+		}
+	}()
+	return pc
+}
+
+// newTestPeer returns a pion peer and, when offer is set, its offer as the
+// jsep of a publish request.
+func newTestPeer(t *testing.T, offer bool) (*webrtc.PeerConnection, map[string]interface{}) {
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(t, err)
+	if !offer {
+		return pc, nil
+	}
+
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "test")
+	assert.NoError(t, err)
+	_, err = pc.AddTrack(track)
+	assert.NoError(t, err)
+
+	description, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pc.SetLocalDescription(description))
+
+	return pc, map[string]interface{}{"type": "offer", "sdp": description.SDP}
+}
+
+func attachVideoRoomHandle(server *fakejanus.Server) (*Handle, error) {
+	client, err := WsConnect(server.WebsocketURL())
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,9 @@
 package janus
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 const (
 	VideoRoomPluginName = "janus.plugin.videoroom"
@@ -9,6 +12,8 @@ const (
 
 	// Request
 	TypeCreate    = "create"
+	TypeEdit      = "edit"
+	TypeAllowed   = "allowed"
 	TypeDestroy   = "destroy"
 	TypeExists    = "exists"
 	TypeList      = "list"
@@ -17,15 +22,27 @@ const (
 	TypePublish   = "publish"
 	TypeUnpublish = "unpublish"
 	TypeStart     = "start"
+	TypeConfigure = "configure"
+
+	TypeListParticipants = "listparticipants"
+	TypeListForwarders   = "listforwarders"
+	TypeRTPForward       = "rtp_forward"
+	TypeStopRTPForward   = "stop_rtp_forward"
+	TypeModerate         = "moderate"
+	TypeKick             = "kick"
+	TypeEnableRecording  = "enable_recording"
 
 	// Response
-	TypeEvent          = "event"
-	Success            = "success"
-	OK                 = "ok"
-	SuccessCreateRoom  = "created"
-	SuccessDestroyRoom = "destroyed"
-	SuccessJoin        = "joined"
-	SuccessAttached    = "attached"
+	TypeEvent           = "event"
+	Success             = "success"
+	OK                  = "ok"
+	SuccessCreateRoom   = "created"
+	SuccessDestroyRoom  = "destroyed"
+	SuccessEditRoom     = "edited"
+	SuccessJoin         = "joined"
+	SuccessAttached     = "attached"
+	SuccessParticipants = "participants"
+	SuccessForwarders   = "forwarders"
 )
 
 type VideoRoomRequestType string
@@ -34,15 +51,47 @@ type VideoRoomResponseType struct {
 	Type string `mapstructure:"videoroom"`
 }
 
+// Videoroom error codes, the ErrorCode of an ErrorResponse.
+const (
+	VideoRoomErrorNoMessage        = 421
+	VideoRoomErrorInvalidJSON      = 422
+	VideoRoomErrorInvalidRequest   = 423
+	VideoRoomErrorJoinFirst        = 424
+	VideoRoomErrorAlreadyJoined    = 425
+	VideoRoomErrorNoSuchRoom       = 426
+	VideoRoomErrorRoomExists       = 427
+	VideoRoomErrorNoSuchFeed       = 428
+	VideoRoomErrorMissingElement   = 429
+	VideoRoomErrorInvalidElement   = 430
+	VideoRoomErrorInvalidSDPType   = 431
+	VideoRoomErrorPublishersFull   = 432
+	VideoRoomErrorUnauthorized     = 433
+	VideoRoomErrorAlreadyPublished = 434
+	VideoRoomErrorNotPublished     = 435
+	VideoRoomErrorIDExists         = 436
+	VideoRoomErrorInvalidSDP       = 437
+	VideoRoomErrorUnknown          = 499
+)
+
 type ErrorResponse struct {
 	ErrorDescription string `mapstructure:"error"`
-	ErrorCode        uint8  `mapstructure:"error_code"`
+	ErrorCode        int    `mapstructure:"error_code"`
 }
 
 func (err *ErrorResponse) Error() string {
 	return fmt.Sprintf("error_code: %d, error_desc: %s", err.ErrorCode, err.ErrorDescription)
 }
 
+// VideoRoomErrorCode returns the error code the videoroom plugin rejected a
+// request with, or 0 when err is not such a rejection.
+func VideoRoomErrorCode(err error) int {
+	var response *ErrorResponse
+	if !errors.As(err, &response) {
+		return 0
+	}
+	return response.ErrorCode
+}
+
 func isUnexpectedResponse(responseKey, expectKey string) bool {
 	return responseKey != expectKey
 }
@@ -51,6 +100,18 @@ func WrapError(description string, errText string) error {
 	return fmt.Errorf("%s : %s", description, errText)
 }
 
+// wrapResponseError is WrapError for a request the plugin answered with an
+// error. It keeps response in the chain for VideoRoomErrorCode.
+func wrapResponseError(description string, response *ErrorResponse) error {
+	return fmt.Errorf("%s : %w", description, response)
+}
+
+// wrapRequestError is WrapError for transport level failures. It keeps err in
+// the chain so callers can still match a *TimeoutError with errors.As.
+func wrapRequestError(description string, err error) error {
+	return fmt.Errorf("%s : %w", description, err)
+}
+
 type Room struct {
 	RoomID              uint64 `json:"room" mapstructure:"room"`
 	Description         string `json:"description,omitempty"`
@@ -154,9 +215,122 @@ type RoomListRequest struct {
 type DestroyRoomRequest struct {
 	Request   VideoRoomRequestType `json:"request"`
 	RoomID    uint64               `json:"room"`
+	Secret    string               `json:"secret,omitempty"`
 	Permanent bool                 `json:"permanent"`
 }
 
+type ListParticipantsRequest struct {
+	Request VideoRoomRequestType `json:"request"`
+	RoomID  uint64               `json:"room"`
+}
+
+// EditRoomRequest changes the settings of a room, only those set. Secret is
+// the current secret of the room, if it has one.
+type EditRoomRequest struct {
+	Request         VideoRoomRequestType `json:"request"`
+	RoomID          uint64               `json:"room"`
+	Secret          string               `json:"secret,omitempty"`
+	NewDescription  string               `json:"new_description,omitempty"`
+	NewIsPrivate    *bool                `json:"new_is_private,omitempty"`
+	NewSecret       string               `json:"new_secret,omitempty"`
+	NewPin          string               `json:"new_pin,omitempty"`
+	NewRequirePvtID *bool                `json:"new_require_pvtid,omitempty"`
+	NewBitrate      int                  `json:"new_bitrate,omitempty"`
+	NewFirFreq      int                  `json:"new_fir_freq,omitempty"`
+	NewPublishers   int                  `json:"new_publishers,omitempty"`
+	NewLockRecord   *bool                `json:"new_lock_record,omitempty"`
+	NewRecDir       string               `json:"new_rec_dir,omitempty"`
+	Permanent       bool                 `json:"permanent,omitempty"`
+}
+
+// The actions of an AllowedRequest. Once enabled, only the tokens allowed can
+// join the room.
+const (
+	AllowedEnable  = "enable"
+	AllowedDisable = "disable"
+	AllowedAdd     = "add"
+	AllowedRemove  = "remove"
+)
+
+// AllowedRequest manages the tokens allowed to join a room, Allowed being the
+// tokens to add or remove.
+type AllowedRequest struct {
+	Request VideoRoomRequestType `json:"request"`
+	RoomID  uint64               `json:"room"`
+	Secret  string               `json:"secret,omitempty"`
+	Action  string               `json:"action"`
+	Allowed []string             `json:"allowed,omitempty"`
+}
+
+// RTPForwardRequest forwards streams of the publisher FeedID over plain RTP,
+// or SRTP when SRTPSuite (32 or 80) and SRTPCrypto, the base64 key, are set.
+// Host is where the streams go unless a stream has its own.
+type RTPForwardRequest struct {
+	Request    VideoRoomRequestType `json:"request"`
+	RoomID     uint64               `json:"room"`
+	Secret     string               `json:"secret,omitempty"`
+	FeedID     uint64               `json:"publisher_id"`
+	Host       string               `json:"host,omitempty"`
+	HostFamily string               `json:"host_family,omitempty"`
+	Streams    []RTPForwardStream   `json:"streams"`
+	SRTPSuite  int                  `json:"srtp_suite,omitempty"`
+	SRTPCrypto string               `json:"srtp_crypto,omitempty"`
+}
+
+// RTPForwardStream is a stream to forward, SSRC and PayloadType replacing
+// those of the publisher when set.
+type RTPForwardStream struct {
+	MID         string `json:"mid"`
+	Host        string `json:"host,omitempty"`
+	HostFamily  string `json:"host_family,omitempty"`
+	Port        int    `json:"port"`
+	RTCPPort    int    `json:"rtcp_port,omitempty"`
+	SSRC        uint32 `json:"ssrc,omitempty"`
+	PayloadType int    `json:"pt,omitempty"`
+	Simulcast   bool   `json:"simulcast,omitempty"`
+}
+
+type StopRTPForwardRequest struct {
+	Request  VideoRoomRequestType `json:"request"`
+	RoomID   uint64               `json:"room"`
+	Secret   string               `json:"secret,omitempty"`
+	FeedID   uint64               `json:"publisher_id"`
+	StreamID uint64               `json:"stream_id"`
+}
+
+type ListForwardersRequest struct {
+	Request VideoRoomRequestType `json:"request"`
+	RoomID  uint64               `json:"room"`
+	Secret  string               `json:"secret,omitempty"`
+}
+
+// ModerateRequest mutes or unmutes the stream MID of the participant FeedID,
+// who can't unmute it while it is moderated.
+type ModerateRequest struct {
+	Request VideoRoomRequestType `json:"request"`
+	Secret  string               `json:"secret,omitempty"`
+	RoomID  uint64               `json:"room"`
+	FeedID  uint64               `json:"id"`
+	MID     string               `json:"mid"`
+	Mute    bool                 `json:"mute"`
+}
+
+type KickRequest struct {
+	Request VideoRoomRequestType `json:"request"`
+	Secret  string               `json:"secret,omitempty"`
+	RoomID  uint64               `json:"room"`
+	FeedID  uint64               `json:"id"`
+}
+
+// EnableRecordingRequest turns the recording of every publisher of a room on
+// or off.
+type EnableRecordingRequest struct {
+	Request VideoRoomRequestType `json:"request"`
+	Secret  string               `json:"secret,omitempty"`
+	RoomID  uint64               `json:"room"`
+	Record  bool                 `json:"record"`
+}
+
 // Publisher API Request
 
 type JoinPublisherRequest struct {
@@ -186,10 +360,34 @@ type UnPublishRequest struct {
 }
 
 type PublishDescription struct {
-	MID         int    `json:"mid"`
+	MID         string `json:"mid"`
 	Description string `json:"description"`
 }
 
+// ConfigureRequest changes the settings of a publisher mid-call. Only the
+// fields set are changed, Record is a pointer so recording can be turned off.
+type ConfigureRequest struct {
+	Request            VideoRoomRequestType `json:"request"`
+	Bitrate            int                  `json:"bitrate,omitempty"`
+	Keyframe           bool                 `json:"keyframe,omitempty"`
+	Record             *bool                `json:"record,omitempty"`
+	FileName           string               `json:"filename,omitempty"`
+	Display            string               `json:"display,omitempty"`
+	AudioActivePackets int                  `json:"audio_active_packets,omitempty"`
+	AudioLevelAverage  int                  `json:"audio_level_average,omitempty"`
+	Streams            []ConfigureStream    `json:"streams,omitempty"`
+	Descriptions       []PublishDescription `json:"descriptions,omitempty"`
+}
+
+// ConfigureStream changes one stream of a publisher, Send false muting it.
+type ConfigureStream struct {
+	MID      string `json:"mid"`
+	Keyframe bool   `json:"keyframe,omitempty"`
+	Send     *bool  `json:"send,omitempty"`
+	MinDelay *int   `json:"min_delay,omitempty"`
+	MaxDelay *int   `json:"max_delay,omitempty"`
+}
+
 type LeaveRequest struct {
 	Request VideoRoomRequestType `json:"request"`
 }
@@ -231,6 +429,20 @@ type RoomListResponse struct {
 	ErrorResponse         `mapstructure:",squash"`
 }
 
+type EditRoomResponse struct {
+	VideoRoomResponseType `mapstructure:",squash"`
+	RoomID                uint64 `mapstructure:"room"`
+	Permanent             bool
+	ErrorResponse         `mapstructure:",squash"`
+}
+
+type AllowedResponse struct {
+	VideoRoomResponseType `mapstructure:",squash"`
+	RoomID                uint64 `mapstructure:"room"`
+	Allowed               []string
+	ErrorResponse         `mapstructure:",squash"`
+}
+
 type DestroyRoomResponse struct {
 	VideoRoomResponseType `mapstructure:",squash"`
 	RoomID                uint64 `mapstructure:"room"`
@@ -238,6 +450,112 @@ type DestroyRoomResponse struct {
 	ErrorResponse         `mapstructure:",squash"`
 }
 
+// Participant is a publisher of a room as listparticipants tells it,
+// IsPublisher being whether it is sending media right now.
+type Participant struct {
+	FeedID      uint64 `mapstructure:"id"`
+	DisplayName string `mapstructure:"display"`
+	IsPublisher bool   `mapstructure:"publisher"`
+	IsTalking   bool   `mapstructure:"talking"`
+}
+
+// Participants are the publishers of a room as listparticipants tells them.
+type Participants []Participant
+
+// Publishers returns the participants sending media.
+func (participants Participants) Publishers() []Publisher {
+	publishers := make([]Publisher, 0, len(participants))
+	for _, participant := range participants {
+		if participant.IsPublisher {
+			publishers = append(publishers, Publisher{
+				FeedID:      participant.FeedID,
+				DisplayName: participant.DisplayName,
+				IsTalking:   participant.IsTalking,
+			})
+		}
+	}
+	return publishers
+}
+
+// Attendees returns the participants joined without sending media.
+func (participants Participants) Attendees() []Attendee {
+	attendees := make([]Attendee, 0, len(participants))
+	for _, participant := range participants {
+		if !participant.IsPublisher {
+			attendees = append(attendees, Attendee{ID: participant.FeedID, DisplayName: participant.DisplayName})
+		}
+	}
+	return attendees
+}
+
+type ListParticipantsResponse struct {
+	VideoRoomResponseType `mapstructure:",squash"`
+	RoomID                uint64 `mapstructure:"room"`
+	Participants          Participants
+	ErrorResponse         `mapstructure:",squash"`
+}
+
+// RTPForwarder is a stream of a publisher Janus forwards over plain RTP.
+type RTPForwarder struct {
+	StreamID       uint64 `mapstructure:"stream_id"`
+	MediaType      string `mapstructure:"type"`
+	Host           string `mapstructure:"host"`
+	Port           int    `mapstructure:"port"`
+	LocalRTCPPort  int    `mapstructure:"local_rtcp_port"`
+	RemoteRTCPPort int    `mapstructure:"remote_rtcp_port"`
+	SSRC           uint32 `mapstructure:"ssrc"`
+	PayloadType    int    `mapstructure:"pt"`
+	Substream      int    `mapstructure:"substream"`
+	SRTP           bool   `mapstructure:"srtp"`
+}
+
+// PublisherForwarders are the forwarders of a publisher, FeedID and
+// DisplayName being those of its Publisher.
+type PublisherForwarders struct {
+	FeedID      uint64 `mapstructure:"publisher_id"`
+	DisplayName string `mapstructure:"display"`
+	Forwarders  []RTPForwarder
+}
+
+type RTPForwardResponse struct {
+	VideoRoomResponseType `mapstructure:",squash"`
+	RoomID                uint64 `mapstructure:"room"`
+	FeedID                uint64 `mapstructure:"publisher_id"`
+	Forwarders            []RTPForwarder
+	ErrorResponse         `mapstructure:",squash"`
+}
+
+type StopRTPForwardResponse struct {
+	VideoRoomResponseType `mapstructure:",squash"`
+	RoomID                uint64 `mapstructure:"room"`
+	FeedID                uint64 `mapstructure:"publisher_id"`
+	StreamID              uint64 `mapstructure:"stream_id"`
+	ErrorResponse         `mapstructure:",squash"`
+}
+
+type ListForwardersResponse struct {
+	VideoRoomResponseType `mapstructure:",squash"`
+	RoomID                uint64 `mapstructure:"room"`
+	Publishers            []PublisherForwarders
+	ErrorResponse         `mapstructure:",squash"`
+}
+
+type ModerateResponse struct {
+	VideoRoomResponseType `mapstructure:",squash"`
+	ErrorResponse         `mapstructure:",squash"`
+}
+
+type KickResponse struct {
+	VideoRoomResponseType `mapstructure:",squash"`
+	ErrorResponse         `mapstructure:",squash"`
+}
+
+type EnableRecordingResponse struct {
+	VideoRoomResponseType `mapstructure:",squash"`
+	Record                bool `mapstructure:"record"`
+	ErrorResponse         `mapstructure:",squash"`
+}
+
 // Publisher API Response
 
 type JoinPublisherResponse struct {
@@ -257,6 +575,14 @@ type PublishResponse struct {
 	ErrorResponse         `mapstructure:",squash"`
 }
 
+type ConfigureResponse struct {
+	VideoRoomResponseType `mapstructure:",squash"`
+	RoomID                uint64 `mapstructure:"room"`
+	Configured            string `mapstructure:"configured"`
+	Jsep                  map[string]interface{}
+	ErrorResponse         `mapstructure:",squash"`
+}
+
 type UnPublishResponse struct {
 	VideoRoomResponseType `mapstructure:",squash"`
 	UnPublished           string `mapstructure:"unpublished"`
@@ -298,3 +624,32 @@ type NewPublisherEvent struct {
 	Publishers            []Publisher
 	ErrorResponse         `mapstructure:",squash"`
 }
+
+// VideoRoomEvent is an asynchronous videoroom notification. Only the fields of
+// the notification at hand are set: Publishers when feeds start publishing,
+// Joining, Leaving or Unpublished when a participant comes or goes, Kicked
+// when a moderator kicks one out, and FeedID, MID and Moderation when a
+// moderator mutes ("muted") or unmutes ("unmuted") the stream of one.
+type VideoRoomEvent struct {
+	VideoRoomResponseType `mapstructure:",squash"`
+	RoomID                uint64 `mapstructure:"room"`
+	Publishers            []Publisher
+	Joining               *Attendee
+	Leaving               uint64 `mapstructure:"-"`
+	Unpublished           uint64 `mapstructure:"-"`
+	Kicked                uint64 `mapstructure:"kicked"`
+	FeedID                uint64 `mapstructure:"id"`
+	MID                   string `mapstructure:"mid"`
+	Moderation            string `mapstructure:"moderation"`
+	Reason                string `mapstructure:"reason"`
+	ErrorResponse         `mapstructure:",squash"`
+
+	// Msg is the event as received
+	Msg *EventMsg `mapstructure:"-"`
+}
+
+// IsKicked reports whether the event tells the handle itself was kicked out
+// of the room.
+func (event *VideoRoomEvent) IsKicked() bool {
+	return event.Msg != nil && event.Msg.Plugindata.Data["leaving"] == OK && event.Reason == "kicked"
+}
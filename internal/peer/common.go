@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/Hwanse/janus-tester/internal/janus"
 	"log"
+	"sync"
 )
 
 type Peer struct {
@@ -12,6 +13,13 @@ type Peer struct {
 	PeerType      string
 	Handle        *janus.Handle
 	DestroyFunc   context.CancelFunc
+
+	// Mids are the kinds of the streams the peer publishes, by mid
+	Mids map[string]string
+
+	// mu guards stats, the samples a StatsSampler took of the peer
+	mu    sync.Mutex
+	stats []StatsSample
 }
 
 func (p *Peer) SetMyFeedID(id uint64) {
@@ -0,0 +1,115 @@
+package peer
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// ForwardStats counts the RTP a ForwardListener received. A gap is a jump
+// forward in the sequence numbers, Lost adding up the packets skipped, and
+// Late counts the packets older than one already received. Only the RTP
+// header is read, so SRTP counts the same.
+type ForwardStats struct {
+	Packets     uint64    `json:"packets"`
+	Bytes       uint64    `json:"bytes"`
+	Gaps        uint64    `json:"gaps"`
+	Lost        uint64    `json:"lost"`
+	Late        uint64    `json:"late"`
+	SSRCChanges uint64    `json:"ssrc_changes"`
+	Invalid     uint64    `json:"invalid"`
+	SSRC        uint32    `json:"ssrc"`
+	PayloadType uint8     `json:"pt"`
+	LastAt      time.Time `json:"last_at"`
+}
+
+// ForwardListener is a local UDP socket receiving the RTP of one Janus
+// forwarder.
+type ForwardListener struct {
+	conn *net.UDPConn
+
+	mu      sync.Mutex
+	stats   ForwardStats
+	lastSeq uint16
+}
+
+// ListenForward listens on a free UDP port of host, see Port.
+func ListenForward(host string) (*ForwardListener, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(host)})
+	if err != nil {
+		return nil, err
+	}
+
+	listener := &ForwardListener{conn: conn}
+	go listener.read()
+	return listener, nil
+}
+
+// Port is the port to forward to.
+func (listener *ForwardListener) Port() int {
+	return listener.conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func (listener *ForwardListener) Stats() ForwardStats {
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	return listener.stats
+}
+
+func (listener *ForwardListener) Close() error {
+	return listener.conn.Close()
+}
+
+func (listener *ForwardListener) read() {
+	buf := make([]byte, 1500)
+	for {
+		n, err := listener.conn.Read(buf)
+		if err != nil {
+			return
+		}
+		listener.count(buf[:n])
+	}
+}
+
+func (listener *ForwardListener) count(packet []byte) {
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+
+	stats := &listener.stats
+	header := rtp.Header{}
+	if _, err := header.Unmarshal(packet); err != nil {
+		stats.Invalid++
+		return
+	}
+
+	first := stats.Packets == 0
+	stats.Packets++
+	stats.Bytes += uint64(len(packet))
+	stats.LastAt = time.Now()
+	stats.PayloadType = header.PayloadType
+
+	if !first && header.SSRC != stats.SSRC {
+		// a new source starts its own sequence numbers
+		stats.SSRCChanges++
+		first = true
+	}
+	stats.SSRC = header.SSRC
+	if first {
+		listener.lastSeq = header.SequenceNumber
+		return
+	}
+
+	diff := header.SequenceNumber - listener.lastSeq
+	switch {
+	case diff == 0 || diff >= 0x8000:
+		stats.Late++
+	case diff > 1:
+		stats.Gaps++
+		stats.Lost += uint64(diff - 1)
+		listener.lastSeq = header.SequenceNumber
+	default:
+		listener.lastSeq = header.SequenceNumber
+	}
+}
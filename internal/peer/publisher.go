@@ -52,6 +52,7 @@ func PublishSampleFile(ctx context.Context, p *Peer) <-chan struct{} {
 	if haveAudioFile {
 		audioEndCtx, err = AttachAudioSample(ctx, iceCtx, peerConnection)
 		if err != nil {
+			iceConnectedCtxCancel()
 			return nil
 		}
 	}
@@ -76,6 +77,11 @@ func PublishSampleFile(ctx context.Context, p *Peer) <-chan struct{} {
 		panic(err)
 	}
 
+	p.Mids = make(map[string]string)
+	for _, transceiver := range peerConnection.GetTransceivers() {
+		p.Mids[transceiver.Mid()] = transceiver.Kind().String()
+	}
+
 	// Block until ICE Gathering is complete, disabling trickle ICE
 	// we do this because we only can exchange one signaling message
 	// in a production application you should exchange ICE Candidates via OnICECandidate
@@ -113,11 +119,13 @@ func AttachAudioSample(ctx context.Context, iceCtx context.Context, pc *webrtc.P
 	// Create a audio track
 	audioTrack, audioTrackErr := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "pion")
 	if audioTrackErr != nil {
+		audioEndCtxCancel()
 		return nil, audioTrackErr
 	}
 
 	rtpSender, err := pc.AddTrack(audioTrack)
-	if audioTrackErr != nil {
+	if err != nil {
+		audioEndCtxCancel()
 		return nil, err
 	}
 
@@ -0,0 +1,159 @@
+package peer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Hwanse/janus-tester/internal/janus"
+)
+
+// StatsSample is what Janus thought of a peer at one point in time. Error is
+// set instead of the stats when handle_info failed.
+type StatsSample struct {
+	At time.Time `json:"at"`
+	janus.HandleStats
+	Error string `json:"error,omitempty"`
+}
+
+// PeerStats is the time series of a peer, as it goes into the run report.
+type PeerStats struct {
+	Key       string        `json:"key"`
+	PeerType  string        `json:"peer_type"`
+	RoomID    uint64        `json:"room"`
+	FeedID    uint64        `json:"feed_id,omitempty"`
+	SessionID uint64        `json:"session_id"`
+	HandleID  uint64        `json:"handle_id"`
+	Samples   []StatsSample `json:"samples"`
+}
+
+// AddStats appends a sample to the time series of the peer.
+func (p *Peer) AddStats(sample StatsSample) {
+	p.mu.Lock()
+	p.stats = append(p.stats, sample)
+	p.mu.Unlock()
+}
+
+// Stats returns the time series of the peer, oldest sample first.
+func (p *Peer) Stats() []StatsSample {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]StatsSample(nil), p.stats...)
+}
+
+// StatsSampler periodically asks the Admin API for the handle_info of the
+// peers added to it and records the stats on each peer. A peer whose handle
+// Janus no longer knows stops being sampled.
+type StatsSampler struct {
+	admin    *janus.Gateway
+	interval time.Duration
+
+	mu    sync.Mutex
+	peers []*sampledPeer
+}
+
+type sampledPeer struct {
+	key  string
+	peer *Peer
+	gone bool
+}
+
+// NewStatsSampler returns a sampler that queries admin, a gateway connected
+// to the Admin API, every interval once Run is called.
+func NewStatsSampler(admin *janus.Gateway, interval time.Duration) *StatsSampler {
+	return &StatsSampler{admin: admin, interval: interval}
+}
+
+// Add starts sampling p. key names the participant the peer belongs to.
+func (sampler *StatsSampler) Add(key string, p *Peer) {
+	sampler.mu.Lock()
+	sampler.peers = append(sampler.peers, &sampledPeer{key: key, peer: p})
+	sampler.mu.Unlock()
+}
+
+// Run samples every peer each interval until ctx is done.
+func (sampler *StatsSampler) Run(ctx context.Context) {
+	tick := time.NewTicker(sampler.interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			sampler.Sample(ctx)
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Sample takes one sample of every peer still sampled, all at once.
+func (sampler *StatsSampler) Sample(ctx context.Context) {
+	sampler.mu.Lock()
+	peers := make([]*sampledPeer, 0, len(sampler.peers))
+	for _, sampled := range sampler.peers {
+		if !sampled.gone {
+			peers = append(peers, sampled)
+		}
+	}
+	sampler.mu.Unlock()
+
+	wg := &sync.WaitGroup{}
+	for _, sampled := range peers {
+		wg.Add(1)
+		go func(sampled *sampledPeer) {
+			defer wg.Done()
+			sampler.sample(ctx, sampled)
+		}(sampled)
+	}
+	wg.Wait()
+}
+
+func (sampler *StatsSampler) sample(ctx context.Context, sampled *sampledPeer) {
+	handle := sampled.peer.Handle
+	sample := StatsSample{At: time.Now()}
+
+	info, err := sampler.admin.HandleInfoCtx(ctx, handle.SessionID(), handle.ID, false)
+	if janus.IsNotFound(err) {
+		sampler.mu.Lock()
+		sampled.gone = true
+		sampler.mu.Unlock()
+		return
+	}
+	if err == nil {
+		var stats *janus.HandleStats
+		if stats, err = info.Stats(); err == nil {
+			sample.HandleStats = *stats
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		sample.Error = err.Error()
+	}
+
+	sampled.peer.AddStats(sample)
+}
+
+// Series returns the time series of every peer ever added, in the order they
+// were added.
+func (sampler *StatsSampler) Series() []PeerStats {
+	sampler.mu.Lock()
+	defer sampler.mu.Unlock()
+
+	series := make([]PeerStats, 0, len(sampler.peers))
+	for _, sampled := range sampler.peers {
+		p := sampled.peer
+		series = append(series, PeerStats{
+			Key:       sampled.key,
+			PeerType:  p.PeerType,
+			RoomID:    p.EnteredRoomID,
+			FeedID:    p.MyFeedID,
+			SessionID: p.Handle.SessionID(),
+			HandleID:  p.Handle.ID,
+			Samples:   p.Stats(),
+		})
+	}
+	return series
+}
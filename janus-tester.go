@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/Hwanse/janus-tester/internal"
 	"github.com/Hwanse/janus-tester/internal/janus"
+	"github.com/Hwanse/janus-tester/internal/peer"
 	"log"
 	"math/rand"
 	"os"
@@ -15,10 +17,97 @@ import (
 	"time"
 )
 
+// requestTimeout bounds every Janus request the tester makes, so a reply
+// dropped by the gateway fails the peer instead of hanging the whole run.
+const requestTimeout = 10 * time.Second
+
+// shutdownTimeout bounds tearing down the sessions at the end of the run.
+const shutdownTimeout = 10 * time.Second
+
+// The values of -rooms.
+const (
+	RoomsAdmin   = "admin"
+	RoomsSession = "session"
+)
+
 func main() {
 
 	fileFlag := flag.String("f", "test-sample.json", "input test scenario sample ")
+	transportFlag := flag.String("transport", "ws", "janus transport to use : ws or http")
+	reconnectFlag := flag.Bool("reconnect", false, "redial and claim the sessions when the gateway connection drops")
+	reportFlag := flag.String("report", "", "write the run report as JSON to this file")
+	connsFlag := flag.Int("conns", 1, "number of gateway connections the sessions are spread over")
+	poolFlag := flag.String("pool", janus.PoolRoundRobin, "how sessions are assigned to connections : round-robin, hash or per-session")
+	logLevelFlag := flag.String("log-level", "info", "gateway log level : debug, info, warn or error")
+	traceFlag := flag.String("trace", "", "record every signaling frame as JSON lines to this file")
+	replayFlag := flag.String("replay", "", "play back a recording made with -trace instead of running the scenario")
+	replaySpeedFlag := flag.Float64("replay-speed", 1, "pace of -replay relative to the recording")
+	minVersionFlag := flag.String("min-version", "", "oldest janus version the run accepts, such as 1.1.0, overrides the scenario")
+	debugFlag := flag.Bool("debug", false, "log every signaling frame, same as -log-level debug")
+	roomsFlag := flag.String("rooms", RoomsSession, "how rooms are set up and torn down : session, through a dedicated session and handle, or admin, through the Admin API message_plugin of -admin-url")
+	statsIntervalFlag := flag.Duration("stats-interval", 0, "sample what janus thinks of every peer through the Admin API handle_info at this interval, 0 to disable")
+
+	connect := ConnectOptions{Headers: envHeaders(EnvHeaders)}
+	flag.StringVar(&connect.URL, "url", envOr(EnvURL, ""), "janus API root such as wss://janus.example.com/ws or unix:///var/run/janus.sock, overrides -transport (env "+EnvURL+")")
+	flag.StringVar(&connect.AdminURL, "admin-url", envOr(EnvAdminURL, ""), "janus Admin API root used by -stats-interval, by default the local websocket one (env "+EnvAdminURL+")")
+	flag.StringVar(&connect.AdminSecret, "admin-secret", envOr(EnvAdminSecret, janus.AdminSecret), "admin_secret of Admin API requests (env "+EnvAdminSecret+")")
+	flag.StringVar(&connect.APISecret, "api-secret", envOr(EnvAPISecret, ""), "apisecret of Janus API requests (env "+EnvAPISecret+")")
+	flag.StringVar(&connect.Token, "token", envOr(EnvToken, ""), "token of Janus API requests, unless the scenario gives the participant one (env "+EnvToken+")")
+	flag.DurationVar(&connect.DialTimeout, "dial-timeout", envDuration(EnvDialTimeout, janus.DefaultDialTimeout), "bound on establishing a gateway connection (env "+EnvDialTimeout+")")
+	flag.StringVar(&connect.TLS.CAFile, "ca-file", envOr(EnvCAFile, ""), "PEM bundle of CAs trusted for wss:// and https:// besides the system ones (env "+EnvCAFile+")")
+	flag.StringVar(&connect.TLS.CertFile, "cert", envOr(EnvCertFile, ""), "PEM client certificate for mutual TLS, with -key (env "+EnvCertFile+")")
+	flag.StringVar(&connect.TLS.KeyFile, "key", envOr(EnvKeyFile, ""), "PEM key of the -cert client certificate (env "+EnvKeyFile+")")
+	flag.StringVar(&connect.TLS.ServerName, "server-name", envOr(EnvServerName, ""), "name used for SNI and checked against the server certificate, by default the host of -url (env "+EnvServerName+")")
+	flag.BoolVar(&connect.TLS.Insecure, "insecure", envBool(EnvInsecure, false), "accept any server certificate, for self-signed local setups (env "+EnvInsecure+")")
+	flag.Var(&connect.Headers, "header", "'Key: Value' header added to the handshake, can be repeated (env "+EnvHeaders+", separated by ';')")
 	flag.Parse()
+	connect.Transport = *transportFlag
+
+	if *roomsFlag != RoomsAdmin && *roomsFlag != RoomsSession {
+		fmt.Printf("unknown -rooms '%s'\n", *roomsFlag)
+		return
+	}
+
+	gatewayOptions, err := connect.GatewayOptions()
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	logLevel, err := janus.ParseLevel(*logLevelFlag)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if *debugFlag {
+		logLevel = janus.LevelDebug
+	}
+	logger := janus.NewStdLogger(os.Stderr, logLevel)
+
+	var trace *janus.JSONLTrace
+	if *traceFlag != "" {
+		trace, err = janus.NewJSONLTrace(*traceFlag)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer trace.Close()
+	}
+
+	report := NewReport()
+
+	if *replayFlag != "" {
+		result, err := ReplayRecording(report, *replayFlag, gatewayOptions, *replaySpeedFlag, logger, trace)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		report.Replay = result
+		report.Finish(janus.TransactionStats{})
+		writeReport(report, *reportFlag)
+		return
+	}
 
 	fmt.Println("read sample file : ", *fileFlag)
 
@@ -37,82 +126,271 @@ func main() {
 
 	fmt.Printf("%+v \n", scenario)
 
-	url := fmt.Sprintf("ws://%s:%s/", janus.JanusLocalHost, janus.JanusWebsocketPort)
-	gateway, err := janus.WsConnect(url)
-	if err != nil {
-		fmt.Println(err.Error())
-		return
+	requirements := scenario.Requirements()
+	if *minVersionFlag != "" {
+		requirements.MinVersion = *minVersionFlag
 	}
 
-	session, err := gateway.Create()
+	ctx, destroy := context.WithCancel(context.Background())
+	defer destroy()
+
+	pool, err := janus.NewGatewayPool(*connsFlag, *poolFlag, func() (*janus.Gateway, error) {
+		gateway, err := janus.ConnectWithOptions(gatewayOptions)
+		if err != nil {
+			return nil, err
+		}
+		gateway.SetRequestTimeout(requestTimeout)
+		gateway.SetLogger(logger)
+
+		// over HTTP the connection is only opened by this first request
+		info, err := gateway.CheckCapabilities(requirements)
+		report.AddConnection(gatewayOptions.URL, gateway.HandshakeTiming())
+		if info != nil {
+			report.SetJanus(info)
+		}
+		if err != nil {
+			gateway.Close()
+			return nil, err
+		}
+		if trace != nil {
+			gateway.SetTraceSink(trace)
+		}
+
+		if *reconnectFlag {
+			if err := gateway.EnableReconnect(janus.DefaultReconnectPolicy); err != nil {
+				return nil, err
+			}
+			go report.WatchReconnects(ctx, gateway)
+		}
+		return gateway, nil
+	})
 	if err != nil {
 		fmt.Println(err.Error())
+		var capability *janus.CapabilityError
+		if errors.As(err, &capability) {
+			report.Finish(janus.TransactionStats{})
+			writeReport(report, *reportFlag)
+		}
 		return
 	}
+	defer pool.Close()
+
+	var (
+		admin    *janus.Gateway
+		tokens   *TokenProvisioner
+		rooms    RoomAPI
+		roomList = make([]uint64, 0)
+		secrets  = make(map[uint64]*RoomSecret)
+		wg       = &sync.WaitGroup{}
+		tornDown bool
+	)
+	// teardown leaves nothing behind on Janus, whether the run ended or it
+	// failed to start halfway
+	teardown := func() {
+		if tornDown {
+			return
+		}
+		tornDown = true
 
-	go func(ctx context.Context, session *janus.Session) {
-		tick := time.NewTicker(20 * time.Second)
-		defer tick.Stop()
+		destroy()
+		wg.Wait()
 
-		for {
-			select {
-			case <-tick.C:
-				if _, err := session.KeepAlive(); err != nil {
-					log.Println("failed to session keepalive : ", err.Error())
-					return
-				}
+		for _, id := range roomList {
+			if err := RemoveRoom(rooms, id, secrets[id].Get()); err != nil {
+				log.Printf("failed to remove room %d : %s", id, err.Error())
+			}
+		}
 
-			case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		report.Shutdown = pool.Shutdown(shutdownCtx)
+		cancel()
+		if tokens != nil {
+			report.Tokens = revokeTokens(tokens)
+		}
+		if admin != nil {
+			admin.Close()
+		}
+	}
+	defer teardown()
+
+	if *roomsFlag == RoomsAdmin || *statsIntervalFlag > 0 || scenario.TokenAuth {
+		admin, err = ConnectAdmin(connect, logger)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+	}
+
+	if scenario.TokenAuth {
+		tokens = NewTokenProvisioner(admin)
+		if err := tokens.Provision(&scenario); err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+	}
+
+	switch *roomsFlag {
+	case RoomsAdmin:
+		rooms = janus.NewRoomManager(admin)
+	case RoomsSession:
+		controlToken := ""
+		if tokens != nil {
+			if controlToken, err = tokens.Add(); err != nil {
+				fmt.Println(err.Error())
 				return
 			}
 		}
-	}(context.Background(), session)
+		rooms, err = ControlHandle(ctx, pool, report, "admin", controlToken)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+	}
 
-	handle, err := session.Attach(janus.VideoRoomPluginName)
-	if err != nil {
-		fmt.Println(err.Error())
-		return
+	var sampler *peer.StatsSampler
+	if *statsIntervalFlag > 0 {
+		sampler = peer.NewStatsSampler(admin, *statsIntervalFlag)
+		go sampler.Run(ctx)
 	}
 
-	ctx, destroy := context.WithCancel(context.Background())
-	roomList := make([]uint64, 0)
-	wg := &sync.WaitGroup{}
+	rosters := make([]*Roster, 0)
 	endSignal := make(chan os.Signal, 1)
 	signal.Notify(endSignal, os.Interrupt)
 
 	for _, roomScenario := range scenario.RoomScenarios {
-		roomID, err := CreateRoom(handle, roomScenario.PublisherLimitCount)
+		roomID, err := CreateRoom(rooms, roomScenario.PublisherLimitCount)
 		if err != nil {
 			fmt.Println(err.Error())
 			return
 		}
 		roomList = append(roomList, roomID)
+		secret := &RoomSecret{}
+		secrets[roomID] = secret
+
+		occupancy := NewOccupancy()
+		if len(roomScenario.Checkpoints) > 0 {
+			wg.Add(1)
+			go RunCheckpoints(ctx, rooms, report, roomID, occupancy, wg, roomScenario.Checkpoints)
+		}
+
+		if roomScenario.RTPForward != nil {
+			wg.Add(1)
+			go RunForwarders(ctx, rooms, report, roomID, secret, wg, roomScenario.RTPForward)
+		}
+
+		if len(roomScenario.RoomChanges) > 0 {
+			wg.Add(1)
+			go RunRoomChanges(ctx, rooms, report, roomID, secret, wg, roomScenario.RoomChanges)
+		}
+
+		var roster *Roster
+		if len(roomScenario.Moderation) > 0 {
+			roster = NewRoster(roomID)
+			rosters = append(rosters, roster)
+
+			moderatorToken := ""
+			if tokens != nil {
+				if moderatorToken, err = tokens.Add(); err != nil {
+					fmt.Println(err.Error())
+					return
+				}
+			}
+			wg.Add(1)
+			key := fmt.Sprintf("%d/moderator", roomID)
+			go RunModerator(ctx, pool, report, key, moderatorToken, roomID, secret, roster, wg, roomScenario.Moderation)
+		}
 
 		for i := 0; i < roomScenario.ActivePublisherCount; i++ {
 			wg.Add(1)
-			go AttachPublisher(ctx, gateway, roomID, wg, roomScenario.Sequences)
+			key := fmt.Sprintf("%d/%s/%d", roomID, janus.TypePublisher, i)
+			go AttachPublisher(ctx, pool, report, sampler, occupancy, roster, i, key, roomScenario.PublisherToken(i), roomID, wg, roomScenario.Sequences)
 		}
 
 		for i := 0; i < roomScenario.SubscriberCount; i++ {
 			wg.Add(1)
-			go AttachSubscriber(ctx, gateway, roomID, wg)
+			key := fmt.Sprintf("%d/%s/%d", roomID, janus.TypeSubscriber, i)
+			go AttachSubscriber(ctx, pool, report, sampler, occupancy, key, roomScenario.SubscriberToken(i), roomID, wg)
 		}
 	}
 
 	<-endSignal
 	log.Println("process end signal, destroy all peers & rooms")
 
-	destroy()
-	wg.Wait()
+	teardown()
+	if sampler != nil {
+		report.Peers = sampler.Series()
+	}
+	for _, roster := range rosters {
+		report.Moderation = append(report.Moderation, roster.Record())
+	}
 
-	for _, id := range roomList {
-		RemoveRoom(handle, id)
+	report.Finish(pool.TransactionStats())
+	writeReport(report, *reportFlag)
+}
+
+// writeReport writes the report to path, unless no -report was given.
+func writeReport(report *Report, path string) {
+	if path == "" {
+		return
+	}
+	if err := report.Write(path); err != nil {
+		fmt.Println(err.Error())
 	}
 }
 
+// revokeTokens revokes the tokens of a token_auth run, within shutdownTimeout.
+func revokeTokens(tokens *TokenProvisioner) *TokenRecord {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return tokens.Revoke(ctx)
+}
+
+// ConnectAdmin connects to the Admin API given by the connection flags.
+func ConnectAdmin(connect ConnectOptions, logger janus.Logger) (*janus.Gateway, error) {
+	options, err := connect.AdminGatewayOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	admin, err := janus.ConnectWithOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	admin.SetRequestTimeout(requestTimeout)
+	admin.SetLogger(logger)
+	return admin, nil
+}
+
 type Scenario struct {
 	Description   string
 	RoomScenarios []RoomScenario `json:"room_scenarios"`
+
+	// Require is what the scenario needs from Janus on top of the videoroom
+	// plugin, checked on every connection before the run starts.
+	Require *janus.Requirements `json:"requirements"`
+
+	// TokenAuth provisions a token limited to the videoroom plugin for every
+	// participant through the Admin API before the run, for a Janus with
+	// token_auth enabled, and revokes them at teardown. Participants the
+	// scenario gives a token keep theirs.
+	TokenAuth bool `json:"token_auth"`
+}
+
+// Requirements returns what the scenario needs from Janus, the videoroom
+// plugin at least.
+func (scenario Scenario) Requirements() janus.Requirements {
+	requirements := janus.Requirements{}
+	if scenario.Require != nil {
+		requirements = *scenario.Require
+	}
+
+	for _, plugin := range requirements.Plugins {
+		if plugin == janus.VideoRoomPluginName {
+			return requirements
+		}
+	}
+	requirements.Plugins = append([]string{janus.VideoRoomPluginName}, requirements.Plugins...)
+	return requirements
 }
 
 type RoomScenario struct {
@@ -121,14 +399,140 @@ type RoomScenario struct {
 	SubscriberCount      int        `json:"subscriber_count"`
 	JoinTimeInterval     int        `json:"join_time_interval"`
 	Sequences            []Sequence `json:"sequence"`
+
+	// PublisherTokens and SubscriberTokens are the tokens of the
+	// participants, in order, for a Janus with token_auth enabled. Those
+	// left without one use the token of the connection.
+	PublisherTokens  []string `json:"publisher_tokens"`
+	SubscriberTokens []string `json:"subscriber_tokens"`
+
+	// Moderation, when set, adds a moderator to the room that runs these
+	// actions on the publishers, which check they get the matching events.
+	Moderation []ModerationAction `json:"moderation"`
+
+	// Checkpoints are the times, in seconds after the room was set up, to
+	// check the publishers and attendees Janus reports in the room against
+	// those the tester joined.
+	Checkpoints []int `json:"checkpoints"`
+
+	// RoomChanges edit the room or its allowed tokens mid-run.
+	RoomChanges []RoomChange `json:"room_changes"`
+
+	// RTPForward, when set, forwards the publishers of the room to local
+	// listeners that check the media keeps coming.
+	RTPForward *ForwardScenario `json:"rtp_forward"`
+}
+
+// PublisherToken returns the token of the i-th publisher, or "" when it has
+// none.
+func (scenario RoomScenario) PublisherToken(i int) string {
+	if i < len(scenario.PublisherTokens) {
+		return scenario.PublisherTokens[i]
+	}
+	return ""
+}
+
+// SubscriberToken returns the token of the i-th subscriber, or "" when it has
+// none.
+func (scenario RoomScenario) SubscriberToken(i int) string {
+	if i < len(scenario.SubscriberTokens) {
+		return scenario.SubscriberTokens[i]
+	}
+	return ""
 }
 
+// Sequence is a command a publisher runs WaitTime seconds after publishing.
+// The fields after WaitTime are the arguments of the configure commands,
+// Mid picking a single stream to mute or describe instead of all of them.
 type Sequence struct {
 	Command  string `json:"command"`
 	WaitTime int    `json:"wait_time"`
+
+	Mid         string `json:"mid"`
+	Bitrate     int    `json:"bitrate"`
+	Display     string `json:"display"`
+	Description string `json:"description"`
+	FileName    string `json:"filename"`
+}
+
+// ReplayRecording plays the recording at path back on a new gateway
+// connection. The replay is itself traced when trace is set, so two runs can
+// be compared frame by frame.
+func ReplayRecording(report *Report, path string, options janus.GatewayOptions, speed float64, logger janus.Logger, trace *janus.JSONLTrace) (*janus.ReplayResult, error) {
+	frames, err := janus.ReadRecording(path)
+	if err != nil {
+		return nil, err
+	}
+
+	gateway, err := janus.ConnectWithOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	defer gateway.Close()
+	gateway.SetLogger(logger)
+	if trace != nil {
+		gateway.SetTraceSink(trace)
+	}
+
+	if info, err := gateway.Info(); err == nil {
+		report.SetJanus(info)
+	}
+
+	log.Printf("replaying %d frames from %s", len(frames), path)
+	return janus.Replay(context.Background(), gateway, frames, janus.ReplayOptions{
+		Speed:        speed,
+		ReplyTimeout: requestTimeout,
+	})
+}
+
+// RoomAPI sets rooms up and tears them down, a *janus.RoomManager or the
+// *janus.Handle of a control session.
+type RoomAPI interface {
+	CreateRoom(req *janus.CreateRoomRequest) error
+	DestroyRoom(req *janus.DestroyRoomRequest) error
+	EditRoom(req *janus.EditRoomRequest) error
+	Allowed(req *janus.AllowedRequest) ([]string, error)
+	ListParticipants(roomID uint64) (janus.Participants, error)
+	RTPForward(req *janus.RTPForwardRequest) ([]janus.RTPForwarder, error)
+	StopRTPForward(req *janus.StopRTPForwardRequest) error
 }
 
-func CreateRoom(handle *janus.Handle, publisherLimitCount int) (uint64, error) {
+// ControlHandle creates the session the rooms are managed through with
+// -rooms session, keeps it alive until ctx is done and attaches it to the
+// videoroom plugin.
+func ControlHandle(ctx context.Context, pool *janus.GatewayPool, report *Report, key string, token string) (*janus.Handle, error) {
+	gateway, err := pool.Gateway("")
+	if err != nil {
+		return nil, err
+	}
+	session, err := gateway.CreateWithToken(token)
+	if err != nil {
+		return nil, err
+	}
+	go report.WatchSession(ctx, key, session)
+
+	go func(ctx context.Context, session *janus.Session) {
+		tick := time.NewTicker(20 * time.Second)
+		defer tick.Stop()
+
+		for {
+			select {
+			case <-tick.C:
+				if _, err := session.KeepAlive(); err != nil {
+					log.Println("failed to session keepalive : ", err.Error())
+					return
+				}
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}(ctx, session)
+
+	return session.Attach(janus.VideoRoomPluginName)
+}
+
+func CreateRoom(rooms RoomAPI, publisherLimitCount int) (uint64, error) {
 	rand.Seed(time.Now().UnixNano())
 
 	roomID := uint64(rand.Uint32())
@@ -145,7 +549,7 @@ func CreateRoom(handle *janus.Handle, publisherLimitCount int) (uint64, error) {
 		},
 	}
 
-	err := handle.CreateRoom(req)
+	err := rooms.CreateRoom(req)
 	if err != nil {
 		return 0, err
 	}
@@ -153,57 +557,88 @@ func CreateRoom(handle *janus.Handle, publisherLimitCount int) (uint64, error) {
 	return roomID, nil
 }
 
-func RemoveRoom(handle *janus.Handle, roomID uint64) error {
+// RemoveRoom destroys roomID, whose secret is secret.
+func RemoveRoom(rooms RoomAPI, roomID uint64, secret string) error {
 	req := &janus.DestroyRoomRequest{
 		Request: janus.TypeDestroy,
 		RoomID:  roomID,
+		Secret:  secret,
 	}
 
-	return handle.DestroyRoom(req)
+	return rooms.DestroyRoom(req)
 }
 
-func AttachSubscriber(ctx context.Context, gateway *janus.Gateway, roomID uint64, wg *sync.WaitGroup) {
-	session, err := gateway.Create()
+func AttachSubscriber(ctx context.Context, pool *janus.GatewayPool, report *Report, sampler *peer.StatsSampler, occupancy *Occupancy, key string, token string, roomID uint64, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	gateway, err := pool.Gateway(key)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	session, err := gateway.CreateWithToken(token)
 	if err != nil {
 		fmt.Println(err.Error())
 		return
 	}
+	go report.WatchSession(ctx, key, session)
 
 	client := internal.NewClient(session)
+	client.Sampler, client.Key = sampler, key
 
 	client.JoinRoom(ctx, roomID)
 	go client.KeepAliveLoop(ctx)
+	// a subscriber joins as a publisher that never publishes, an attendee
+	occupancy.Join(client.FindMyPublisherPeer().MyFeedID)
 
 	client.KeepConnection(ctx)
-	defer func() {
-		client.LeaveRoom()
-		wg.Done()
-	}()
+	defer client.LeaveRoom()
 }
 
-func AttachPublisher(ctx context.Context, gateway *janus.Gateway, roomID uint64, wg *sync.WaitGroup, sequences []Sequence) {
-	session, err := gateway.Create()
+func AttachPublisher(ctx context.Context, pool *janus.GatewayPool, report *Report, sampler *peer.StatsSampler, occupancy *Occupancy, roster *Roster, index int, key string, token string, roomID uint64, wg *sync.WaitGroup, sequences []Sequence) {
+	defer wg.Done()
+
+	gateway, err := pool.Gateway(key)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	session, err := gateway.CreateWithToken(token)
 	if err != nil {
 		fmt.Println(err.Error())
 		return
 	}
+	go report.WatchSession(ctx, key, session)
 
 	client := internal.NewClient(session)
+	client.Sampler, client.Key = sampler, key
+	client.OnPublishing = occupancy.Publishing
+	client.OnModerated = func(feed uint64, event string) {
+		if event == "kicked" {
+			occupancy.Leave(feed)
+		}
+		if roster != nil {
+			roster.Observe(feed, event)
+		}
+	}
 
 	client.JoinRoom(ctx, roomID)
 	go client.KeepAliveLoop(ctx)
+	feed := client.FindMyPublisherPeer().MyFeedID
+	occupancy.Join(feed)
+	if roster != nil {
+		roster.Join(index, feed)
+	}
 
 	client.TestPublishStream(ctx)
 
 	for _, seq := range sequences {
+		seq := seq
 		go TestSequence(ctx, &seq, &client)
 	}
 
 	client.KeepConnection(ctx)
-	defer func() {
-		client.LeaveRoom()
-		wg.Done()
-	}()
+	defer client.LeaveRoom()
 }
 
 func TestSequence(ctx context.Context, seq *Sequence, client *internal.Client) {
@@ -219,10 +654,47 @@ func TestSequence(ctx context.Context, seq *Sequence, client *internal.Client) {
 			return
 
 		case <-timer.C:
-			if seq.Command == "audio_off" {
-				client.UnpublishStream()
+			if err := RunSequence(seq, client); err != nil {
+				log.Printf("failed to run sequence %s : %s", seq.Command, err.Error())
 			}
 			return
 		}
 	}
 }
+
+// RunSequence runs the command of seq on the publisher of client.
+func RunSequence(seq *Sequence, client *internal.Client) error {
+	switch seq.Command {
+	case "audio_off":
+		client.UnpublishStream()
+		return nil
+	case "audio_mute", "audio_unmute":
+		return client.MuteStream("audio", seq.Mid, seq.Command == "audio_mute")
+	case "video_mute", "video_unmute":
+		return client.MuteStream("video", seq.Mid, seq.Command == "video_mute")
+	case "bitrate":
+		return client.Configure(&janus.ConfigureRequest{Bitrate: seq.Bitrate})
+	case "record_on", "record_off":
+		record := seq.Command == "record_on"
+		return client.Configure(&janus.ConfigureRequest{Record: &record, FileName: seq.FileName})
+	case "display":
+		return client.Configure(&janus.ConfigureRequest{Display: seq.Display})
+	case "description":
+		mids := []string{seq.Mid}
+		if seq.Mid == "" {
+			mids = mids[:0]
+			if p := client.FindMyPublisherPeer(); p != nil {
+				for mid := range p.Mids {
+					mids = append(mids, mid)
+				}
+			}
+		}
+		req := &janus.ConfigureRequest{}
+		for _, mid := range mids {
+			req.Descriptions = append(req.Descriptions, janus.PublishDescription{MID: mid, Description: seq.Description})
+		}
+		return client.Configure(req)
+	default:
+		return errors.New("unknown command")
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/Hwanse/janus-tester/internal/janus"
+)
+
+// ModerationAction is a request the moderator of a room sends WaitTime
+// seconds after it attached. Command is "mute", "unmute", "kick", "record_on"
+// or "record_off".
+type ModerationAction struct {
+	Command  string `json:"command"`
+	WaitTime int    `json:"wait_time"`
+
+	// Target is the index of the publisher to mute, unmute or kick, a random
+	// publisher of the room when unset.
+	Target *int `json:"target"`
+
+	// Mid is the stream to mute or unmute, "0" when unset.
+	Mid string `json:"mid"`
+}
+
+// ModerationRecord counts what the moderator of a room did, and whether the
+// publishers it targeted got the matching events.
+type ModerationRecord struct {
+	RoomID     uint64 `json:"room"`
+	Actions    int    `json:"actions"`
+	Failed     int    `json:"failed"`
+	Expected   int    `json:"expected_events"`
+	Received   int    `json:"received_events"`
+	Missing    int    `json:"missing_events"`
+	Unexpected int    `json:"unexpected_events"`
+}
+
+// Roster keeps the publishers of a room a moderator can target by index, and
+// the moderation events ("muted", "unmuted" or "kicked") each is awaiting.
+type Roster struct {
+	mu       sync.Mutex
+	feeds    map[int]uint64
+	expected map[uint64][]string
+	record   ModerationRecord
+}
+
+func NewRoster(roomID uint64) *Roster {
+	return &Roster{
+		feeds:    make(map[int]uint64),
+		expected: make(map[uint64][]string),
+		record:   ModerationRecord{RoomID: roomID},
+	}
+}
+
+// Join makes the publisher of index, with feed id feed, a target.
+func (roster *Roster) Join(index int, feed uint64) {
+	roster.mu.Lock()
+	defer roster.mu.Unlock()
+	roster.feeds[index] = feed
+}
+
+// Observe records a moderation event the publisher of feed got.
+func (roster *Roster) Observe(feed uint64, event string) {
+	roster.mu.Lock()
+	defer roster.mu.Unlock()
+
+	if !roster.remove(feed, event) {
+		log.Printf("room %d : unexpected %s event for feed %d", roster.record.RoomID, event, feed)
+		roster.record.Unexpected++
+		return
+	}
+	roster.record.Received++
+}
+
+// Record returns the counters of the room, the events still awaited being
+// missing.
+func (roster *Roster) Record() ModerationRecord {
+	roster.mu.Lock()
+	defer roster.mu.Unlock()
+
+	record := roster.record
+	for _, events := range roster.expected {
+		record.Missing += len(events)
+	}
+	return record
+}
+
+// target returns the feed id of the publisher of index, or of a random
+// publisher when index is nil.
+func (roster *Roster) target(index *int) (uint64, error) {
+	roster.mu.Lock()
+	defer roster.mu.Unlock()
+
+	if index != nil {
+		feed, ok := roster.feeds[*index]
+		if !ok {
+			return 0, fmt.Errorf("no publisher %d in the room", *index)
+		}
+		return feed, nil
+	}
+
+	feeds := make([]uint64, 0, len(roster.feeds))
+	for _, feed := range roster.feeds {
+		feeds = append(feeds, feed)
+	}
+	if len(feeds) == 0 {
+		return 0, errors.New("no publisher in the room")
+	}
+	return feeds[rand.Intn(len(feeds))], nil
+}
+
+// expect awaits event for feed. It is called before the request is sent, as
+// the event may come before the response.
+func (roster *Roster) expect(feed uint64, event string) {
+	roster.mu.Lock()
+	defer roster.mu.Unlock()
+	roster.expected[feed] = append(roster.expected[feed], event)
+	roster.record.Expected++
+}
+
+// cancel takes back an expect whose request failed.
+func (roster *Roster) cancel(feed uint64, event string) {
+	roster.mu.Lock()
+	defer roster.mu.Unlock()
+	if roster.remove(feed, event) {
+		roster.record.Expected--
+	}
+}
+
+// kicked stops targeting the publisher of feed.
+func (roster *Roster) kicked(feed uint64) {
+	roster.mu.Lock()
+	defer roster.mu.Unlock()
+	for index, joined := range roster.feeds {
+		if joined == feed {
+			delete(roster.feeds, index)
+		}
+	}
+}
+
+// remove removes the first event awaited by feed, roster.mu must be held.
+func (roster *Roster) remove(feed uint64, event string) bool {
+	events := roster.expected[feed]
+	for i := range events {
+		if events[i] == event {
+			roster.expected[feed] = append(events[:i], events[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (roster *Roster) result(err error) {
+	roster.mu.Lock()
+	defer roster.mu.Unlock()
+	roster.record.Actions++
+	if err != nil {
+		roster.record.Failed++
+	}
+}
+
+// RunModerator attaches the moderator of roomID on a session of its own and
+// runs actions against the publishers of roster, until ctx is done.
+func RunModerator(ctx context.Context, pool *janus.GatewayPool, report *Report, key string, token string, roomID uint64, secret *RoomSecret, roster *Roster, wg *sync.WaitGroup, actions []ModerationAction) {
+	defer wg.Done()
+
+	handle, err := ControlHandle(ctx, pool, report, key, token)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer handle.Detach()
+
+	actionWg := &sync.WaitGroup{}
+	for _, action := range actions {
+		actionWg.Add(1)
+		go func(action ModerationAction) {
+			defer actionWg.Done()
+
+			timer := time.NewTimer(time.Duration(action.WaitTime) * time.Second)
+			defer timer.Stop()
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+
+			err := Moderate(handle, roomID, secret.Get(), roster, action)
+			if err != nil {
+				log.Printf("failed to run moderation %s in room %d : %s", action.Command, roomID, err.Error())
+			}
+			roster.result(err)
+		}(action)
+	}
+	actionWg.Wait()
+	<-ctx.Done()
+}
+
+// Moderate sends the request of action about roomID, whose secret is secret,
+// over handle.
+func Moderate(handle *janus.Handle, roomID uint64, secret string, roster *Roster, action ModerationAction) error {
+	switch action.Command {
+	case "mute", "unmute":
+		feed, err := roster.target(action.Target)
+		if err != nil {
+			return err
+		}
+		mid := action.Mid
+		if mid == "" {
+			mid = "0"
+		}
+
+		mute := action.Command == "mute"
+		event := "unmuted"
+		if mute {
+			event = "muted"
+		}
+		roster.expect(feed, event)
+		_, err = handle.Moderate(&janus.ModerateRequest{
+			Request: janus.TypeModerate,
+			Secret:  secret,
+			RoomID:  roomID,
+			FeedID:  feed,
+			MID:     mid,
+			Mute:    mute,
+		})
+		if err != nil {
+			roster.cancel(feed, event)
+		}
+		return err
+
+	case "kick":
+		feed, err := roster.target(action.Target)
+		if err != nil {
+			return err
+		}
+
+		roster.expect(feed, "kicked")
+		_, err = handle.Kick(&janus.KickRequest{Request: janus.TypeKick, Secret: secret, RoomID: roomID, FeedID: feed})
+		if err != nil {
+			roster.cancel(feed, "kicked")
+			return err
+		}
+		roster.kicked(feed)
+		return nil
+
+	case "record_on", "record_off":
+		record := action.Command == "record_on"
+		response, err := handle.EnableRecording(&janus.EnableRecordingRequest{
+			Request: janus.TypeEnableRecording,
+			Secret:  secret,
+			RoomID:  roomID,
+			Record:  record,
+		})
+		if err != nil {
+			return err
+		}
+		if response.Record != record {
+			return fmt.Errorf("recording is %t", response.Record)
+		}
+		return nil
+	}
+
+	return errors.New("unknown command")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// moderationEvent is a moderation event of a feed in the roster tests.
+type moderationEvent struct {
+	feed  uint64
+	event string
+}
+
+func Test_Roster_Record(t *testing.T) {
+	tests := []struct {
+		name    string
+		expect  []moderationEvent
+		cancel  []moderationEvent
+		observe []moderationEvent
+		want    ModerationRecord
+	}{
+		{
+			name:    "received",
+			expect:  []moderationEvent{{1, "muted"}, {2, "kicked"}},
+			observe: []moderationEvent{{2, "kicked"}, {1, "muted"}},
+			want:    ModerationRecord{Expected: 2, Received: 2},
+		},
+		{
+			name:   "missing",
+			expect: []moderationEvent{{1, "muted"}, {1, "unmuted"}},
+			want:   ModerationRecord{Expected: 2, Missing: 2},
+		},
+		{
+			name:    "unexpected",
+			observe: []moderationEvent{{1, "kicked"}},
+			want:    ModerationRecord{Unexpected: 1},
+		},
+		{
+			name:    "other event of the feed",
+			expect:  []moderationEvent{{1, "muted"}},
+			observe: []moderationEvent{{1, "unmuted"}},
+			want:    ModerationRecord{Expected: 1, Missing: 1, Unexpected: 1},
+		},
+		{
+			name:    "event of another feed",
+			expect:  []moderationEvent{{1, "muted"}},
+			observe: []moderationEvent{{2, "muted"}},
+			want:    ModerationRecord{Expected: 1, Missing: 1, Unexpected: 1},
+		},
+		{
+			name:    "repeated event",
+			expect:  []moderationEvent{{1, "muted"}, {1, "muted"}},
+			observe: []moderationEvent{{1, "muted"}},
+			want:    ModerationRecord{Expected: 2, Received: 1, Missing: 1},
+		},
+		{
+			name:    "duplicate event",
+			expect:  []moderationEvent{{1, "muted"}},
+			observe: []moderationEvent{{1, "muted"}, {1, "muted"}},
+			want:    ModerationRecord{Expected: 1, Received: 1, Unexpected: 1},
+		},
+		{
+			name:   "cancelled",
+			expect: []moderationEvent{{1, "muted"}, {1, "kicked"}},
+			cancel: []moderationEvent{{1, "kicked"}, {2, "kicked"}},
+			want:   ModerationRecord{Expected: 1, Missing: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			roster := NewRoster(1234)
+			for _, expected := range test.expect {
+				roster.expect(expected.feed, expected.event)
+			}
+			for _, cancelled := range test.cancel {
+				roster.cancel(cancelled.feed, cancelled.event)
+			}
+			for _, observed := range test.observe {
+				roster.Observe(observed.feed, observed.event)
+			}
+
+			test.want.RoomID = 1234
+			assert.Equal(t, test.want, roster.Record())
+		})
+	}
+}
+
+func Test_Roster_Actions(t *testing.T) {
+	roster := NewRoster(1234)
+	roster.result(nil)
+	roster.result(errors.New("no publisher in the room"))
+
+	record := roster.Record()
+	assert.Equal(t, 2, record.Actions)
+	assert.Equal(t, 1, record.Failed)
+}
+
+func Test_Roster_Target(t *testing.T) {
+	roster := NewRoster(1234)
+	_, err := roster.target(nil)
+	assert.Error(t, err)
+
+	roster.Join(0, 10)
+	roster.Join(1, 11)
+
+	first, second, third := 0, 1, 2
+	feed, err := roster.target(&first)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(10), feed)
+	_, err = roster.target(&third)
+	assert.Error(t, err)
+
+	// a kicked publisher is no longer a target
+	roster.kicked(10)
+	_, err = roster.target(&first)
+	assert.Error(t, err)
+	feed, err = roster.target(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(11), feed)
+	feed, err = roster.target(&second)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(11), feed)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hwanse/janus-tester/internal/janus"
+)
+
+// The environment variables that stand in for the connection flags, so the
+// tester can be pointed at another Janus without changing the command line.
+const (
+	EnvURL         = "JANUS_URL"
+	EnvAdminURL    = "JANUS_ADMIN_URL"
+	EnvAdminSecret = "JANUS_ADMIN_SECRET"
+	EnvAPISecret   = "JANUS_API_SECRET"
+	EnvToken       = "JANUS_TOKEN"
+	EnvHeaders     = "JANUS_HEADERS"
+	EnvDialTimeout = "JANUS_DIAL_TIMEOUT"
+	EnvCAFile      = "JANUS_CA_FILE"
+	EnvCertFile    = "JANUS_CERT_FILE"
+	EnvKeyFile     = "JANUS_KEY_FILE"
+	EnvServerName  = "JANUS_SERVER_NAME"
+	EnvInsecure    = "JANUS_INSECURE"
+)
+
+// ConnectOptions are the connection flags of the tester.
+type ConnectOptions struct {
+	Transport   string
+	URL         string
+	AdminURL    string
+	AdminSecret string
+	APISecret   string
+	Token       string
+	Headers     HeaderFlag
+	DialTimeout time.Duration
+	TLS         janus.TLSOptions
+}
+
+// HeaderFlag collects repeated "Key: Value" flags.
+type HeaderFlag []string
+
+func (headers *HeaderFlag) String() string {
+	return strings.Join(*headers, ", ")
+}
+
+func (headers *HeaderFlag) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("header '%s' is not 'Key: Value'", value)
+	}
+	*headers = append(*headers, value)
+	return nil
+}
+
+// envOr returns the environment variable key, or fallback when it is unset.
+func envOr(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// envDuration is envOr for durations such as "5s".
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Printf("ignoring %s : %s\n", key, err.Error())
+		return fallback
+	}
+	return duration
+}
+
+// envBool is envOr for booleans such as "true" or "1".
+func envBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		fmt.Printf("ignoring %s : %s\n", key, err.Error())
+		return fallback
+	}
+	return parsed
+}
+
+// envHeaders reads headers separated by newlines or semicolons.
+func envHeaders(key string) HeaderFlag {
+	headers := HeaderFlag{}
+	for _, header := range strings.FieldsFunc(os.Getenv(key), func(r rune) bool { return r == '\n' || r == ';' }) {
+		if err := headers.Set(strings.TrimSpace(header)); err != nil {
+			fmt.Printf("ignoring %s : %s\n", key, err.Error())
+		}
+	}
+	return headers
+}
+
+// GatewayOptions turns the flags into the options of janus.Connect. Without
+// a URL, the default endpoint of the transport on this machine is used.
+func (options ConnectOptions) GatewayOptions() (janus.GatewayOptions, error) {
+	gatewayOptions := janus.DefaultGatewayOptions()
+	gatewayOptions.AdminSecret = options.AdminSecret
+	gatewayOptions.APISecret = options.APISecret
+	gatewayOptions.Token = options.Token
+	gatewayOptions.DialTimeout = options.DialTimeout
+
+	switch {
+	case options.URL != "":
+		gatewayOptions.URL = options.URL
+	case options.Transport == "ws":
+		gatewayOptions.URL = janus.DefaultURL
+	case options.Transport == "http":
+		gatewayOptions.URL = fmt.Sprintf("http://%s:%s/janus", janus.JanusLocalHost, janus.JanusHttpPort)
+	default:
+		return gatewayOptions, fmt.Errorf("unknown transport '%s'", options.Transport)
+	}
+
+	if options.TLS != (janus.TLSOptions{}) {
+		config, err := options.TLS.Config()
+		if err != nil {
+			return gatewayOptions, err
+		}
+		gatewayOptions.TLSConfig = config
+	}
+
+	for _, header := range options.Headers {
+		parts := strings.SplitN(header, ":", 2)
+		janus.WithHeader(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))(&gatewayOptions)
+	}
+	return gatewayOptions, nil
+}
+
+// AdminGatewayOptions are GatewayOptions for the Admin API at AdminURL, or
+// the default websocket Admin API on this machine.
+func (options ConnectOptions) AdminGatewayOptions() (janus.GatewayOptions, error) {
+	gatewayOptions, err := options.GatewayOptions()
+	if err != nil {
+		return gatewayOptions, err
+	}
+
+	gatewayOptions.URL = janus.DefaultAdminURL
+	if options.AdminURL != "" {
+		gatewayOptions.URL = options.AdminURL
+	}
+	gatewayOptions.Subprotocol = janus.WebsocketAdminSubProtocol
+	return gatewayOptions, nil
+}
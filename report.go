@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Hwanse/janus-tester/internal/janus"
+	"github.com/Hwanse/janus-tester/internal/peer"
+)
+
+// Report collects what happened during a run. It is printed when the tester
+// exits and, with -report, written as JSON so runs can be compared.
+type Report struct {
+	mu sync.Mutex
+
+	StartedAt    time.Time              `json:"started_at"`
+	Janus        *JanusRecord           `json:"janus,omitempty"`
+	FinishedAt   time.Time              `json:"finished_at"`
+	Connections  []ConnectionRecord     `json:"connections,omitempty"`
+	Reconnects   []ReconnectRecord      `json:"reconnects,omitempty"`
+	Expired      []SessionRecord        `json:"expired_sessions,omitempty"`
+	Transactions janus.TransactionStats `json:"transactions"`
+	Replay       *janus.ReplayResult    `json:"replay,omitempty"`
+	Shutdown     *janus.ShutdownSummary `json:"shutdown,omitempty"`
+	Tokens       *TokenRecord           `json:"tokens,omitempty"`
+	Moderation   []ModerationRecord     `json:"moderation,omitempty"`
+	Checkpoints  []CheckpointRecord     `json:"checkpoints,omitempty"`
+	RoomChanges  []RoomChangeRecord     `json:"room_changes,omitempty"`
+	Forwards     []ForwardRecord        `json:"forwards,omitempty"`
+
+	// Peers are the stats Janus gave of every peer over the run, with
+	// -stats-interval.
+	Peers []peer.PeerStats `json:"peers,omitempty"`
+}
+
+// JanusRecord is the Janus the run talked to, so results can be compared
+// across upgrades.
+type JanusRecord struct {
+	Name          string   `json:"name"`
+	Version       int      `json:"version"`
+	VersionString string   `json:"version_string"`
+	Plugins       []string `json:"plugins"`
+}
+
+// ConnectionRecord is a gateway connection opened for the run, with the time
+// each step of its handshake took.
+type ConnectionRecord struct {
+	At        time.Time `json:"at"`
+	URL       string    `json:"url"`
+	ConnectMs float64   `json:"connect_ms"`
+	TLSMs     float64   `json:"tls_ms"`
+	UpgradeMs float64   `json:"upgrade_ms"`
+	TotalMs   float64   `json:"total_ms"`
+}
+
+// TokenRecord counts the tokens a token_auth run stored and revoked through
+// the Admin API, and how long each took in all.
+type TokenRecord struct {
+	Provisioned int     `json:"provisioned"`
+	Revoked     int     `json:"revoked"`
+	Failed      int     `json:"failed"`
+	ProvisionMs float64 `json:"provision_ms"`
+	RevokeMs    float64 `json:"revoke_ms"`
+}
+
+// ReconnectRecord is one step of a gateway connection recovery.
+type ReconnectRecord struct {
+	At         time.Time `json:"at"`
+	State      string    `json:"state"`
+	Attempt    int       `json:"attempt"`
+	DowntimeMs int64     `json:"downtime_ms"`
+	Claimed    int       `json:"claimed"`
+	Lost       int       `json:"lost"`
+	Resent     int       `json:"resent"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// SessionRecord is a session Janus expired during the run.
+type SessionRecord struct {
+	At      time.Time `json:"at"`
+	Session uint64    `json:"session_id"`
+	Key     string    `json:"key"`
+}
+
+func NewReport() *Report {
+	return &Report{StartedAt: time.Now()}
+}
+
+// SetJanus records the info of the Janus the run talks to. A connection
+// that lands on a different version is logged, only the first is kept.
+func (r *Report) SetJanus(info *janus.InfoMsg) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Janus != nil {
+		if r.Janus.VersionString != info.VersionString {
+			log.Printf("connection to %s %s, the run started on %s", info.Name, info.VersionString, r.Janus.VersionString)
+		}
+		return
+	}
+
+	plugins := make([]string, 0, len(info.Plugins))
+	for plugin := range info.Plugins {
+		plugins = append(plugins, plugin)
+	}
+	sort.Strings(plugins)
+	r.Janus = &JanusRecord{
+		Name:          info.Name,
+		Version:       info.Version,
+		VersionString: info.VersionString,
+		Plugins:       plugins,
+	}
+	log.Printf("janus : %s %s", info.Name, info.VersionString)
+}
+
+// AddConnection records a gateway connection and its handshake timing.
+func (r *Report) AddConnection(url string, timing janus.HandshakeTiming) {
+	record := ConnectionRecord{
+		At:        time.Now(),
+		URL:       url,
+		ConnectMs: milliseconds(timing.Connect),
+		TLSMs:     milliseconds(timing.TLS),
+		UpgradeMs: milliseconds(timing.Upgrade),
+		TotalMs:   milliseconds(timing.Total),
+	}
+	log.Printf("connected to %s : connect %s, tls %s, upgrade %s, total %s",
+		url, timing.Connect, timing.TLS, timing.Upgrade, timing.Total)
+
+	r.mu.Lock()
+	r.Connections = append(r.Connections, record)
+	r.mu.Unlock()
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// AddCheckpoint records the result of a checkpoint.
+func (r *Report) AddCheckpoint(record CheckpointRecord) {
+	r.mu.Lock()
+	r.Checkpoints = append(r.Checkpoints, record)
+	r.mu.Unlock()
+}
+
+// AddRoomChange records a room change.
+func (r *Report) AddRoomChange(record RoomChangeRecord) {
+	r.mu.Lock()
+	r.RoomChanges = append(r.RoomChanges, record)
+	r.mu.Unlock()
+}
+
+// AddForward records a forwarder at the end of the run.
+func (r *Report) AddForward(record ForwardRecord) {
+	r.mu.Lock()
+	r.Forwards = append(r.Forwards, record)
+	r.mu.Unlock()
+}
+
+// WatchReconnects records the reconnect events of gateway until ctx is done.
+func (r *Report) WatchReconnects(ctx context.Context, gateway *janus.Gateway) {
+	events := gateway.ReconnectEvents()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case event := <-events:
+			record := ReconnectRecord{
+				At:         time.Now(),
+				State:      event.State,
+				Attempt:    event.Attempt,
+				DowntimeMs: event.Downtime.Milliseconds(),
+				Claimed:    len(event.Claimed),
+				Lost:       len(event.Lost),
+				Resent:     event.Resent,
+			}
+			if event.Err != nil {
+				record.Error = event.Err.Error()
+			}
+			log.Printf("gateway %s : attempt %d, downtime %s, claimed %d, lost %d, resent %d",
+				event.State, event.Attempt, event.Downtime, record.Claimed, record.Lost, record.Resent)
+
+			r.mu.Lock()
+			r.Reconnects = append(r.Reconnects, record)
+			r.mu.Unlock()
+		}
+	}
+}
+
+// WatchSession records the session when Janus expires it before ctx is done.
+// key names the participant the session belongs to.
+func (r *Report) WatchSession(ctx context.Context, key string, session *janus.Session) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-session.Done():
+	}
+
+	if !errors.Is(session.Err(), janus.ErrSessionExpired) {
+		return
+	}
+	log.Printf("session %d of %s expired by janus", session.ID, key)
+
+	r.mu.Lock()
+	r.Expired = append(r.Expired, SessionRecord{At: time.Now(), Session: session.ID, Key: key})
+	r.mu.Unlock()
+}
+
+// Finish stamps the end of the run with the final transaction counters and
+// prints the report.
+func (r *Report) Finish(transactions janus.TransactionStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.FinishedAt = time.Now()
+	r.Transactions = transactions
+	fmt.Printf("run finished after %s, %d reconnect events\n", r.FinishedAt.Sub(r.StartedAt), len(r.Reconnects))
+	if r.Janus != nil {
+		fmt.Printf("janus : %s %s\n", r.Janus.Name, r.Janus.VersionString)
+	}
+	fmt.Printf("transactions : %d pending, %d completed, %d abandoned, %d expired, %d failed, %d orphan responses\n",
+		r.Transactions.Pending, r.Transactions.Completed, r.Transactions.Abandoned, r.Transactions.Expired, r.Transactions.Failed, r.Transactions.Orphans)
+	if len(r.Expired) > 0 {
+		fmt.Printf("sessions expired by janus : %d\n", len(r.Expired))
+	}
+
+	if r.Tokens != nil {
+		fmt.Printf("tokens : %d provisioned in %.1f ms, %d revoked in %.1f ms, %d failed\n",
+			r.Tokens.Provisioned, r.Tokens.ProvisionMs, r.Tokens.Revoked, r.Tokens.RevokeMs, r.Tokens.Failed)
+	}
+
+	if len(r.Checkpoints) > 0 {
+		mismatches := 0
+		for _, checkpoint := range r.Checkpoints {
+			if !checkpoint.Match {
+				mismatches++
+			}
+		}
+		fmt.Printf("checkpoints : %d, %d mismatches\n", len(r.Checkpoints), mismatches)
+		for _, checkpoint := range r.Checkpoints {
+			if !checkpoint.Match {
+				fmt.Printf("  %s\n", checkpoint)
+			}
+		}
+	}
+
+	if len(r.RoomChanges) > 0 {
+		fmt.Printf("room changes : %d\n", len(r.RoomChanges))
+		for _, change := range r.RoomChanges {
+			if change.Error != "" {
+				fmt.Printf("  %s of room %d failed : %s\n", change.Request, change.RoomID, change.Error)
+			}
+		}
+	}
+
+	if len(r.Forwards) > 0 {
+		fmt.Printf("rtp forwards : %d\n", len(r.Forwards))
+		for _, forward := range r.Forwards {
+			if forward.Error != "" {
+				fmt.Printf("  room %d publisher %d failed : %s\n", forward.RoomID, forward.FeedID, forward.Error)
+				continue
+			}
+			fmt.Printf("  room %d publisher %d stream %d : ok %t, %d packets %d bytes, %d gaps %d lost, %d late, %d ssrc changes\n",
+				forward.RoomID, forward.FeedID, forward.StreamID, forward.OK, forward.Packets, forward.Bytes, forward.Gaps, forward.Lost, forward.Late, forward.SSRCChanges)
+		}
+	}
+
+	for _, moderation := range r.Moderation {
+		fmt.Printf("moderation of room %d : %d actions, %d failed, %d/%d events received, %d missing, %d unexpected\n",
+			moderation.RoomID, moderation.Actions, moderation.Failed, moderation.Received, moderation.Expected, moderation.Missing, moderation.Unexpected)
+	}
+
+	if r.Shutdown != nil {
+		fmt.Printf("shutdown : %s\n", r.Shutdown)
+		for _, failure := range r.Shutdown.Failures {
+			fmt.Printf("  %s of session %d handle %d : %s\n", failure.Request, failure.Session, failure.Handle, failure.Error)
+		}
+	}
+
+	if len(r.Peers) > 0 {
+		fmt.Printf("peer stats : %d peers\n", len(r.Peers))
+		for _, stats := range r.Peers {
+			if len(stats.Samples) == 0 {
+				fmt.Printf("  %s %s handle %d : no samples\n", stats.Key, stats.PeerType, stats.HandleID)
+				continue
+			}
+			last := stats.Samples[len(stats.Samples)-1]
+			if last.Error != "" {
+				fmt.Printf("  %s %s handle %d : %d samples, last failed : %s\n", stats.Key, stats.PeerType, stats.HandleID, len(stats.Samples), last.Error)
+				continue
+			}
+			fmt.Printf("  %s %s handle %d : %d samples, ice %s, dtls %s, in %d bytes %d packets, out %d bytes %d packets, nacks %d/%d, lost %d/%d, rtt %d ms\n",
+				stats.Key, stats.PeerType, stats.HandleID, len(stats.Samples), last.ICEState, last.DTLSState,
+				last.BytesIn, last.PacketsIn, last.BytesOut, last.PacketsOut, last.NacksIn, last.NacksOut, last.Lost, last.LostByRemote, last.RTT)
+		}
+	}
+
+	if r.Replay != nil {
+		fmt.Printf("replay : %d sent, %d answered, %d failed, %d mismatches\n",
+			r.Replay.Sent, r.Replay.Answered, r.Replay.Failed, len(r.Replay.Mismatches))
+		for _, mismatch := range r.Replay.Mismatches {
+			fmt.Printf("  #%d %s : recorded '%s', replayed '%s' %s\n",
+				mismatch.Index, mismatch.Request, mismatch.Recorded, mismatch.Replayed, mismatch.Reason)
+		}
+	}
+}
+
+// Write stores the report as indented JSON at path.
+func (r *Report) Write(path string) error {
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Hwanse/janus-tester/internal/janus"
+)
+
+// RoomChange changes the settings of a room WaitTime seconds after it was
+// set up, while its participants are connected. Either Edit or Allowed is
+// set, in the form of the Janus request, the room and its secret being filled
+// in by the runner.
+type RoomChange struct {
+	WaitTime int                    `json:"wait_time"`
+	Edit     *janus.EditRoomRequest `json:"edit"`
+	Allowed  *janus.AllowedRequest  `json:"allowed"`
+}
+
+// RoomSecret is the current secret of a room of the run, which a room change
+// may replace mid-run. Every request that needs the secret reads it here.
+type RoomSecret struct {
+	mu     sync.Mutex
+	secret string
+}
+
+func (secret *RoomSecret) Get() string {
+	secret.mu.Lock()
+	defer secret.mu.Unlock()
+	return secret.secret
+}
+
+// change runs fn with the current secret and keeps the one it returns. The
+// requests needing the secret wait meanwhile, so none goes out with a secret
+// Janus just replaced.
+func (secret *RoomSecret) change(fn func(current string) string) {
+	secret.mu.Lock()
+	defer secret.mu.Unlock()
+	secret.secret = fn(secret.secret)
+}
+
+// RoomChangeRecord is a room change of the run and how Janus took it.
+type RoomChangeRecord struct {
+	At      time.Time `json:"at"`
+	RoomID  uint64    `json:"room"`
+	Request string    `json:"request"`
+	Allowed []string  `json:"allowed,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// RunRoomChanges applies changes to roomID, in order, until ctx is done.
+// The secret a change sets replaces secret, for every request about the room.
+func RunRoomChanges(ctx context.Context, rooms RoomAPI, report *Report, roomID uint64, secret *RoomSecret, wg *sync.WaitGroup, changes []RoomChange) {
+	defer wg.Done()
+
+	start := time.Now()
+	for _, change := range changes {
+		timer := time.NewTimer(time.Until(start.Add(time.Duration(change.WaitTime) * time.Second)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		var record RoomChangeRecord
+		secret.change(func(current string) string {
+			record = ChangeRoom(rooms, roomID, current, change)
+			if record.Error == "" && change.Edit != nil && change.Edit.NewSecret != "" {
+				return change.Edit.NewSecret
+			}
+			return current
+		})
+		if record.Error != "" {
+			log.Printf("failed to %s room %d : %s", record.Request, roomID, record.Error)
+		}
+		report.AddRoomChange(record)
+	}
+}
+
+// ChangeRoom sends the request of change about roomID, with secret unless
+// the change carries one.
+func ChangeRoom(rooms RoomAPI, roomID uint64, secret string, change RoomChange) RoomChangeRecord {
+	record := RoomChangeRecord{At: time.Now(), RoomID: roomID}
+
+	var err error
+	switch {
+	case change.Edit != nil:
+		req := *change.Edit
+		req.Request, req.RoomID = janus.TypeEdit, roomID
+		if req.Secret == "" {
+			req.Secret = secret
+		}
+		record.Request = janus.TypeEdit
+		err = rooms.EditRoom(&req)
+
+	case change.Allowed != nil:
+		req := *change.Allowed
+		req.Request, req.RoomID = janus.TypeAllowed, roomID
+		if req.Secret == "" {
+			req.Secret = secret
+		}
+		record.Request = janus.TypeAllowed + " " + req.Action
+		record.Allowed, err = rooms.Allowed(&req)
+
+	default:
+		err = errors.New("neither edit nor allowed")
+	}
+
+	if err != nil {
+		record.Error = err.Error()
+	}
+	return record
+}
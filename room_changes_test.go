@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/Hwanse/janus-tester/internal/fakejanus"
+	"github.com/Hwanse/janus-tester/internal/janus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RunRoomChanges_Secret(t *testing.T) {
+	server := fakejanus.NewServer()
+	defer server.Close()
+
+	gateway, err := janus.WsConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer gateway.Close()
+	session, err := gateway.Create()
+	assert.NoError(t, err)
+	rooms, err := session.Attach(janus.VideoRoomPluginName)
+	assert.NoError(t, err)
+
+	roomID, err := CreateRoom(rooms, 4)
+	assert.NoError(t, err)
+	joined, err := rooms.JoinPublisher(&janus.JoinPublisherRequest{Request: janus.TypeJoin, RoomID: roomID, PeerType: janus.TypePublisher})
+	assert.NoError(t, err)
+
+	report := NewReport()
+	secret := &RoomSecret{}
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	RunRoomChanges(context.Background(), rooms, report, roomID, secret, wg, []RoomChange{
+		{Edit: &janus.EditRoomRequest{NewSecret: "first"}},
+		{Edit: &janus.EditRoomRequest{NewSecret: "second"}},
+		{Allowed: &janus.AllowedRequest{Action: janus.AllowedDisable}},
+	})
+
+	assert.Len(t, report.RoomChanges, 3)
+	for _, change := range report.RoomChanges {
+		assert.Empty(t, change.Error)
+	}
+	assert.Equal(t, "second", secret.Get())
+
+	// the other requests about the room carry the secret a change set
+	roster := NewRoster(roomID)
+	roster.Join(0, joined.FeedID)
+	assert.NoError(t, Moderate(rooms, roomID, secret.Get(), roster, ModerationAction{Command: "record_on"}))
+	assert.NoError(t, Moderate(rooms, roomID, secret.Get(), roster, ModerationAction{Command: "kick"}))
+
+	err = RemoveRoom(rooms, roomID, "")
+	assert.Equal(t, janus.VideoRoomErrorUnauthorized, janus.VideoRoomErrorCode(err))
+	assert.NoError(t, RemoveRoom(rooms, roomID, secret.Get()))
+}
@@ -2,46 +2,201 @@ package test
 
 import (
 	"context"
-	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
 	"github.com/Hwanse/janus-tester/internal"
+	"github.com/Hwanse/janus-tester/internal/fakejanus"
 	"github.com/Hwanse/janus-tester/internal/janus"
+	"github.com/Hwanse/janus-tester/internal/peer"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
 	"github.com/stretchr/testify/assert"
-	"testing"
-	"time"
 )
 
+// clientTestDuration is how long each client stays in the room.
+const clientTestDuration = 3 * time.Second
+
 func Test_JoinClient(t *testing.T) {
-	url := fmt.Sprintf("ws://%s:%s/", janus.JanusLocalHost, janus.JanusWebsocketPort)
-	gateway, err := janus.WsConnect(url)
+	server := fakejanus.NewServer()
+	defer server.Close()
+
+	gateway, err := janus.WsConnect(server.WebsocketURL())
 	assert.NoError(t, err)
+	defer gateway.Close()
 
 	session, err := gateway.Create()
 	assert.NoError(t, err)
 
 	client := internal.NewClient(session)
-	ctx, _ := context.WithTimeout(context.Background(), time.Minute*3)
+	ctx, cancel := context.WithTimeout(context.Background(), clientTestDuration)
+	defer cancel()
 
-	client.JoinRoom(ctx, 1234)
+	client.JoinRoom(ctx, fakejanus.DefaultRoom)
 	go client.KeepAliveLoop(ctx)
 
+	publisher := client.FindMyPublisherPeer()
+	assert.NotNil(t, publisher)
+	assert.NotZero(t, publisher.MyFeedID)
+	assert.Equal(t, janus.Participants{{FeedID: publisher.MyFeedID}}, listTestParticipants(t, session))
+
 	client.KeepConnection(ctx)
 }
 
 func Test_PublishStream(t *testing.T) {
-	url := fmt.Sprintf("ws://%s:%s/", janus.JanusLocalHost, janus.JanusWebsocketPort)
-	gateway, err := janus.WsConnect(url)
+	writeTestAudioFile(t)
+
+	server := fakejanus.NewServer()
+	defer server.Close()
+
+	gateway, err := janus.WsConnect(server.WebsocketURL())
 	assert.NoError(t, err)
+	defer gateway.Close()
 
 	session, err := gateway.Create()
 	assert.NoError(t, err)
 
 	client := internal.NewClient(session)
-	ctx, _ := context.WithTimeout(context.Background(), time.Minute*3)
+	ctx, cancel := context.WithTimeout(context.Background(), clientTestDuration)
+	defer cancel()
+
+	// only called once the answer of the publish was applied
+	published := make([]uint64, 0)
+	client.OnPublishing = func(feed uint64, publishing bool) {
+		assert.True(t, publishing)
+		published = append(published, feed)
+	}
 
-	client.JoinRoom(ctx, 1234)
+	client.JoinRoom(ctx, fakejanus.DefaultRoom)
 	go client.KeepAliveLoop(ctx)
 
 	client.TestPublishStream(ctx)
 
+	publisher := client.FindMyPublisherPeer()
+	assert.NotZero(t, publisher.MyFeedID)
+	assert.Equal(t, []uint64{publisher.MyFeedID}, published)
+	assert.Equal(t, map[string]string{"0": "audio"}, publisher.Mids)
+	assert.Equal(t, janus.Participants{{FeedID: publisher.MyFeedID, IsPublisher: true}}, listTestParticipants(t, session))
+
 	client.KeepConnection(ctx)
 }
+
+// listTestParticipants lists the participants the fake holds in its default
+// room, over a handle of its own on session.
+func listTestParticipants(t *testing.T, session *janus.Session) janus.Participants {
+	handle, err := session.Attach(janus.VideoRoomPluginName)
+	assert.NoError(t, err)
+	defer handle.Detach()
+
+	participants, err := handle.ListParticipants(fakejanus.DefaultRoom)
+	assert.NoError(t, err)
+	return participants
+}
+
+func Test_StatsSampler(t *testing.T) {
+	server := fakejanus.NewServer()
+	defer server.Close()
+
+	admin, err := janus.WsAdminConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer admin.Close()
+
+	gateway, err := janus.WsConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer gateway.Close()
+
+	session, err := gateway.Create()
+	assert.NoError(t, err)
+
+	sampler := peer.NewStatsSampler(admin, time.Hour)
+	client := internal.NewClient(session)
+	client.Sampler, client.Key = sampler, "publisher"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client.JoinRoom(ctx, fakejanus.DefaultRoom)
+	sampler.Sample(ctx)
+	sampler.Sample(ctx)
+
+	series := sampler.Series()
+	assert.Len(t, series, 1)
+	assert.Equal(t, "publisher", series[0].Key)
+	assert.Equal(t, janus.TypePublisher, series[0].PeerType)
+	assert.Equal(t, session.ID, series[0].SessionID)
+	assert.Len(t, series[0].Samples, 2)
+	assert.Empty(t, series[0].Samples[0].Error)
+
+	// a detached handle is no longer sampled
+	_, err = client.Peers[0].Handle.Detach()
+	assert.NoError(t, err)
+	sampler.Sample(ctx)
+	sampler.Sample(ctx)
+	assert.Len(t, sampler.Series()[0].Samples, 2)
+}
+
+func Test_ForwardListener(t *testing.T) {
+	listener, err := peer.ListenForward("127.0.0.1")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	conn, err := net.Dial("udp", net.JoinHostPort("127.0.0.1", strconv.Itoa(listener.Port())))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	send := func(ssrc uint32, seq uint16) {
+		packet := rtp.Packet{Header: rtp.Header{Version: 2, PayloadType: 111, SequenceNumber: seq, SSRC: ssrc}, Payload: []byte{0xf8, 0xff, 0xfe}}
+		data, err := packet.Marshal()
+		assert.NoError(t, err)
+		_, err = conn.Write(data)
+		assert.NoError(t, err)
+	}
+	// 65535 wraps to 0, 2 to 4 are skipped before 2 comes late, and a new
+	// source starts over
+	for _, seq := range []uint16{65534, 65535, 0, 1, 5, 2} {
+		send(1000, seq)
+	}
+	send(2000, 300)
+	send(2000, 301)
+	conn.Write([]byte{0x80})
+
+	assert.Eventually(t, func() bool {
+		stats := listener.Stats()
+		return stats.Packets+stats.Invalid == 9
+	}, time.Second, 10*time.Millisecond)
+
+	stats := listener.Stats()
+	assert.Equal(t, uint64(8), stats.Packets)
+	assert.Equal(t, uint64(1), stats.Gaps)
+	assert.Equal(t, uint64(3), stats.Lost)
+	assert.Equal(t, uint64(1), stats.Late)
+	assert.Equal(t, uint64(1), stats.SSRCChanges)
+	assert.Equal(t, uint64(1), stats.Invalid)
+	assert.Equal(t, uint32(2000), stats.SSRC)
+	assert.Equal(t, uint8(111), stats.PayloadType)
+}
+
+// writeTestAudioFile moves the test into a temporary directory holding the
+// output.ogg the publisher plays, a second of opus silence.
+func writeTestAudioFile(t *testing.T) {
+	dir, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(dir) })
+
+	ogg, err := oggwriter.New("output.ogg", 48000, 2)
+	assert.NoError(t, err)
+	defer ogg.Close()
+
+	silence := []byte{0xf8, 0xff, 0xfe}
+	for i := 0; i < 50; i++ {
+		err := ogg.WriteRTP(&rtp.Packet{
+			Header:  rtp.Header{Version: 2, SequenceNumber: uint16(i), Timestamp: uint32(i * 960)},
+			Payload: silence,
+		})
+		assert.NoError(t, err)
+	}
+}
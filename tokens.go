@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Hwanse/janus-tester/internal/janus"
+	"github.com/rs/xid"
+)
+
+// TokenProvisioner stores a token for every participant of a token_auth
+// scenario through the Admin API, and revokes them when the run is over.
+type TokenProvisioner struct {
+	admin *janus.Gateway
+
+	mu     sync.Mutex
+	tokens []string
+	record TokenRecord
+}
+
+func NewTokenProvisioner(admin *janus.Gateway) *TokenProvisioner {
+	return &TokenProvisioner{admin: admin}
+}
+
+// Provision stores a token limited to the videoroom plugin for every
+// participant the scenario gives no token.
+func (provisioner *TokenProvisioner) Provision(scenario *Scenario) error {
+	start := time.Now()
+	defer func() {
+		provisioner.mu.Lock()
+		provisioner.record.ProvisionMs = milliseconds(time.Since(start))
+		provisioner.mu.Unlock()
+	}()
+
+	var err error
+	for i := range scenario.RoomScenarios {
+		room := &scenario.RoomScenarios[i]
+		if room.PublisherTokens, err = provisioner.fill(room.PublisherTokens, room.ActivePublisherCount); err != nil {
+			return err
+		}
+		if room.SubscriberTokens, err = provisioner.fill(room.SubscriberTokens, room.SubscriberCount); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("provisioned %d tokens in %s", provisioner.Record().Provisioned, time.Since(start))
+	return nil
+}
+
+// fill returns tokens grown to count, with a new token in place of every
+// empty one.
+func (provisioner *TokenProvisioner) fill(tokens []string, count int) ([]string, error) {
+	for len(tokens) < count {
+		tokens = append(tokens, "")
+	}
+	for i := range tokens {
+		if tokens[i] != "" {
+			continue
+		}
+		token, err := provisioner.Add()
+		if err != nil {
+			return tokens, err
+		}
+		tokens[i] = token
+	}
+	return tokens, nil
+}
+
+// Add stores a new token limited to the videoroom plugin and returns it.
+func (provisioner *TokenProvisioner) Add() (string, error) {
+	token := "janus-tester-" + xid.New().String()
+	if _, err := provisioner.admin.AddToken(token, []string{janus.VideoRoomPluginName}); err != nil {
+		provisioner.mu.Lock()
+		provisioner.record.Failed++
+		provisioner.mu.Unlock()
+		return "", err
+	}
+
+	provisioner.mu.Lock()
+	provisioner.tokens = append(provisioner.tokens, token)
+	provisioner.record.Provisioned++
+	provisioner.mu.Unlock()
+	return token, nil
+}
+
+// Revoke removes every token Provision stored and returns what provisioning
+// and revoking took. It gives up on the tokens left once ctx is done.
+func (provisioner *TokenProvisioner) Revoke(ctx context.Context) *TokenRecord {
+	provisioner.mu.Lock()
+	tokens := provisioner.tokens
+	provisioner.tokens = nil
+	provisioner.mu.Unlock()
+
+	start := time.Now()
+	revoked, failed := 0, 0
+	for _, token := range tokens {
+		if _, err := provisioner.admin.RemoveTokenCtx(ctx, token); err != nil {
+			log.Printf("failed to revoke token %s : %s", token, err.Error())
+			failed++
+			continue
+		}
+		revoked++
+	}
+
+	provisioner.mu.Lock()
+	defer provisioner.mu.Unlock()
+	provisioner.record.Revoked += revoked
+	provisioner.record.Failed += failed
+	provisioner.record.RevokeMs = milliseconds(time.Since(start))
+	record := provisioner.record
+	return &record
+}
+
+// Record returns the counters of the tokens so far.
+func (provisioner *TokenProvisioner) Record() TokenRecord {
+	provisioner.mu.Lock()
+	defer provisioner.mu.Unlock()
+	return provisioner.record
+}
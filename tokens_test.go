@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Hwanse/janus-tester/internal/fakejanus"
+	"github.com/Hwanse/janus-tester/internal/janus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TokenProvisioner(t *testing.T) {
+	server := fakejanus.NewServer()
+	defer server.Close()
+	server.TokenAuth = true
+
+	admin, err := janus.WsAdminConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer admin.Close()
+
+	scenario := Scenario{RoomScenarios: []RoomScenario{
+		{ActivePublisherCount: 2, SubscriberCount: 1, PublisherTokens: []string{"given"}},
+		{ActivePublisherCount: 1},
+	}}
+
+	provisioner := NewTokenProvisioner(admin)
+	assert.NoError(t, provisioner.Provision(&scenario))
+
+	// the token the scenario gives is kept, every other participant gets one
+	rooms := scenario.RoomScenarios
+	assert.Equal(t, "given", rooms[0].PublisherToken(0))
+	assert.NotEmpty(t, rooms[0].PublisherToken(1))
+	assert.NotEmpty(t, rooms[0].SubscriberToken(0))
+	assert.NotEmpty(t, rooms[1].PublisherToken(0))
+	assert.Empty(t, rooms[1].SubscriberTokens)
+	assert.Equal(t, 3, provisioner.Record().Provisioned)
+
+	stored, err := admin.ListTokens()
+	assert.NoError(t, err)
+	assert.Len(t, stored, 3)
+	for _, token := range stored {
+		assert.Equal(t, []string{janus.VideoRoomPluginName}, token.AllowedPlugins)
+	}
+
+	// a token removed behind the provisioner's back fails to be revoked
+	_, err = admin.RemoveToken(rooms[1].PublisherToken(0))
+	assert.NoError(t, err)
+
+	record := provisioner.Revoke(context.Background())
+	assert.Equal(t, 3, record.Provisioned)
+	assert.Equal(t, 2, record.Revoked)
+	assert.Equal(t, 1, record.Failed)
+
+	stored, err = admin.ListTokens()
+	assert.NoError(t, err)
+	assert.Empty(t, stored)
+
+	// nothing is left to revoke twice
+	assert.Equal(t, 2, provisioner.Revoke(context.Background()).Revoked)
+}
+
+func Test_TokenProvisioner_AddFails(t *testing.T) {
+	server := fakejanus.NewServer()
+	defer server.Close()
+
+	admin, err := janus.WsAdminConnect(server.WebsocketURL())
+	assert.NoError(t, err)
+	defer admin.Close()
+
+	// without token_auth Janus refuses to store tokens
+	provisioner := NewTokenProvisioner(admin)
+	scenario := Scenario{RoomScenarios: []RoomScenario{{ActivePublisherCount: 2}}}
+	assert.Error(t, provisioner.Provision(&scenario))
+
+	record := provisioner.Record()
+	assert.Zero(t, record.Provisioned)
+	assert.Equal(t, 1, record.Failed)
+}